@@ -0,0 +1,224 @@
+package appx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	packageManifest = "AppxManifest.xml"
+	bundleManifest  = "AppxMetadata/AppxBundleManifest.xml"
+)
+
+// Extensions are the file types Nexus treats as MSIX/AppX packages.
+var Extensions = []string{".msix", ".appx", ".msixbundle", ".appxbundle"}
+
+// IsPackage reports whether the file name has an MSIX/AppX extension.
+func IsPackage(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Manifest is the identity of a package or bundle. For bundles the
+// display names come from the first application package inside it and
+// Architectures lists every architecture the bundle ships.
+type Manifest struct {
+	Name      string
+	Publisher string
+	Version   string
+	// Architecture is the processor architecture the package needs. A
+	// bundle shipping several is neutral, as Windows installs the one that
+	// matches.
+	Architecture         string
+	Architectures        []string
+	DisplayName          string
+	PublisherDisplayName string
+	Bundle               bool
+}
+
+// Title returns the display name, falling back to the identity name when
+// the manifest only references a localised resource.
+func (m *Manifest) Title() string {
+	if m.DisplayName != "" && !strings.HasPrefix(m.DisplayName, "ms-resource:") {
+		return m.DisplayName
+	}
+	return m.Name
+}
+
+// PublisherName returns the publisher display name, or the common name of
+// the signing publisher when there is none.
+func (m *Manifest) PublisherName() string {
+	if m.PublisherDisplayName != "" && !strings.HasPrefix(m.PublisherDisplayName, "ms-resource:") {
+		return m.PublisherDisplayName
+	}
+	for _, part := range strings.Split(m.Publisher, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok && strings.EqualFold(key, "CN") {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return m.Publisher
+}
+
+type identity struct {
+	Name                  string `xml:"Name,attr"`
+	Publisher             string `xml:"Publisher,attr"`
+	Version               string `xml:"Version,attr"`
+	ProcessorArchitecture string `xml:"ProcessorArchitecture,attr"`
+}
+
+type packageXML struct {
+	Identity   identity `xml:"Identity"`
+	Properties struct {
+		DisplayName          string `xml:"DisplayName"`
+		PublisherDisplayName string `xml:"PublisherDisplayName"`
+	} `xml:"Properties"`
+}
+
+type bundleXML struct {
+	Identity identity `xml:"Identity"`
+	Packages []struct {
+		Type         string `xml:"Type,attr"`
+		Architecture string `xml:"Architecture,attr"`
+		FileName     string `xml:"FileName,attr"`
+	} `xml:"Packages>Package"`
+}
+
+// ReadManifest reads the identity from the AppxManifest.xml of a package,
+// or the AppxBundleManifest.xml of a bundle, at path.
+func ReadManifest(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return readManifest(f, stat.Size())
+}
+
+func readManifest(ra io.ReaderAt, size int64) (*Manifest, error) {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %v", err)
+	}
+
+	if f := findFile(zr, packageManifest); f != nil {
+		var pkg packageXML
+		if err := decodeXML(f, &pkg); err != nil {
+			return nil, err
+		}
+		arch := pkg.Identity.ProcessorArchitecture
+		if arch == "" {
+			arch = "neutral"
+		}
+		return &Manifest{
+			Name:                 pkg.Identity.Name,
+			Publisher:            pkg.Identity.Publisher,
+			Version:              pkg.Identity.Version,
+			Architecture:         arch,
+			Architectures:        []string{arch},
+			DisplayName:          pkg.Properties.DisplayName,
+			PublisherDisplayName: pkg.Properties.PublisherDisplayName,
+		}, nil
+	}
+
+	f := findFile(zr, bundleManifest)
+	if f == nil {
+		return nil, fmt.Errorf("%s not found in package", packageManifest)
+	}
+	var bundle bundleXML
+	if err := decodeXML(f, &bundle); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Name:      bundle.Identity.Name,
+		Publisher: bundle.Identity.Publisher,
+		Version:   bundle.Identity.Version,
+		Bundle:    true,
+	}
+	for _, p := range bundle.Packages {
+		if p.Type != "" && p.Type != "application" {
+			continue
+		}
+		if p.Architecture != "" && !contains(m.Architectures, p.Architecture) {
+			m.Architectures = append(m.Architectures, p.Architecture)
+		}
+		if m.DisplayName == "" {
+			if inner, err := readInnerManifest(ra, zr, p.FileName); err == nil {
+				m.DisplayName = inner.DisplayName
+				m.PublisherDisplayName = inner.PublisherDisplayName
+			}
+		}
+	}
+	m.Architecture = "neutral"
+	if len(m.Architectures) == 1 {
+		m.Architecture = m.Architectures[0]
+	}
+
+	return m, nil
+}
+
+// readInnerManifest reads the manifest of a package stored in a bundle.
+// Bundles store their packages uncompressed, so the inner zip is read in
+// place rather than copied out.
+func readInnerManifest(ra io.ReaderAt, zr *zip.Reader, name string) (*Manifest, error) {
+	f := findFile(zr, name)
+	if f == nil {
+		return nil, fmt.Errorf("%s not found in bundle", name)
+	}
+	if f.Method != zip.Store {
+		return nil, fmt.Errorf("%s is compressed", name)
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64)
+	return readManifest(io.NewSectionReader(ra, offset, size), size)
+}
+
+func findFile(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func decodeXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", f.Name, err)
+	}
+	return nil
+}
+
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
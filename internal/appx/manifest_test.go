@@ -0,0 +1,176 @@
+package appx
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// zipBytes returns a zip file of the given names and contents. Names
+// ending in .msix or .appx are stored uncompressed, as bundles do.
+func zipBytes(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		method := zip.Deflate
+		if IsPackage(files[i]) {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: files[i], Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func packageXMLFor(name, arch, displayName, publisherDisplayName string) string {
+	archAttr := ""
+	if arch != "" {
+		archAttr = fmt.Sprintf(` ProcessorArchitecture="%s"`, arch)
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<Package xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10">
+  <Identity Name="%s" Publisher="CN=Contoso Software, O=Contoso Corporation, C=US" Version="1.2.3.0"%s />
+  <Properties>
+    <DisplayName>%s</DisplayName>
+    <PublisherDisplayName>%s</PublisherDisplayName>
+  </Properties>
+</Package>`, name, archAttr, displayName, publisherDisplayName)
+}
+
+func bundleXMLFor(packages ...string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<Bundle xmlns="http://schemas.microsoft.com/appx/2013/bundle" SchemaVersion="5.0">
+  <Identity Name="Contoso.Tool" Publisher="CN=Contoso Software, O=Contoso Corporation, C=US" Version="2.0.0.0" />
+  <Packages>
+` + strings.Join(packages, "\n") + `
+  </Packages>
+</Bundle>`
+}
+
+func readBytes(t *testing.T, data []byte) *Manifest {
+	t.Helper()
+	m, err := readManifest(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	return m
+}
+
+func TestReadManifestPackage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool.msix")
+	os.WriteFile(path, zipBytes(t,
+		"AppxManifest.xml", packageXMLFor("Contoso.Tool", "x64", "Contoso Tool", "Contoso"),
+		"Tool.exe", "MZ",
+	), 0644)
+
+	m, err := ReadManifest(path)
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+	want := Manifest{
+		Name:                 "Contoso.Tool",
+		Publisher:            "CN=Contoso Software, O=Contoso Corporation, C=US",
+		Version:              "1.2.3.0",
+		Architecture:         "x64",
+		Architectures:        []string{"x64"},
+		DisplayName:          "Contoso Tool",
+		PublisherDisplayName: "Contoso",
+	}
+	if fmt.Sprint(*m) != fmt.Sprint(want) {
+		t.Errorf("ReadManifest = %+v, want %+v", *m, want)
+	}
+	if m.Title() != "Contoso Tool" || m.PublisherName() != "Contoso" {
+		t.Errorf("Title, PublisherName = %q, %q", m.Title(), m.PublisherName())
+	}
+}
+
+func TestReadManifestResources(t *testing.T) {
+	// Display names that point at resources fall back to the identity, and
+	// a package without an architecture is neutral.
+	m := readBytes(t, zipBytes(t, "AppxManifest.xml",
+		packageXMLFor("Contoso.Tool", "", "ms-resource:AppName", "ms-resource:Publisher")))
+	if m.Title() != "Contoso.Tool" || m.PublisherName() != "Contoso Software" {
+		t.Errorf("Title, PublisherName = %q, %q", m.Title(), m.PublisherName())
+	}
+	if m.Architecture != "neutral" || !slices.Equal(m.Architectures, []string{"neutral"}) {
+		t.Errorf("Architecture = %q, Architectures = %q", m.Architecture, m.Architectures)
+	}
+}
+
+func TestReadManifestBundle(t *testing.T) {
+	x64 := zipBytes(t, "AppxManifest.xml", packageXMLFor("Contoso.Tool", "x64", "Contoso Tool", "Contoso"))
+	arm64 := zipBytes(t, "AppxManifest.xml", packageXMLFor("Contoso.Tool", "arm64", "Contoso Tool (ARM)", "Contoso"))
+	entry := func(typ, arch, file string) string {
+		return fmt.Sprintf(`    <Package Type="%s" Version="2.0.0.0" Architecture="%s" FileName="%s" />`, typ, arch, file)
+	}
+
+	tests := []struct {
+		name          string
+		bundle        []byte
+		architecture  string
+		architectures []string
+		displayName   string
+	}{
+		{"several architectures", zipBytes(t,
+			"AppxMetadata/AppxBundleManifest.xml", bundleXMLFor(
+				entry("application", "x64", "Tool_x64.msix"),
+				entry("application", "arm64", "Tool_arm64.msix"),
+				entry("resource", "", "Tool_language-de.msix"),
+				entry("application", "x64", "Tool_x64_extra.msix"),
+			),
+			"Tool_x64.msix", string(x64),
+			"Tool_arm64.msix", string(arm64),
+		), "neutral", []string{"x64", "arm64"}, "Contoso Tool"},
+		{"one architecture", zipBytes(t,
+			"AppxMetadata/AppxBundleManifest.xml", bundleXMLFor(entry("application", "arm64", "Tool_arm64.msix")),
+			"Tool_arm64.msix", string(arm64),
+		), "arm64", []string{"arm64"}, "Contoso Tool (ARM)"},
+		{"missing inner package", zipBytes(t,
+			"AppxMetadata/AppxBundleManifest.xml", bundleXMLFor(entry("application", "x86", "Tool_x86.msix")),
+		), "x86", []string{"x86"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := readBytes(t, tt.bundle)
+			if !m.Bundle || m.Name != "Contoso.Tool" || m.Version != "2.0.0.0" {
+				t.Errorf("Bundle, Name, Version = %v, %q, %q", m.Bundle, m.Name, m.Version)
+			}
+			if m.Architecture != tt.architecture || !slices.Equal(m.Architectures, tt.architectures) {
+				t.Errorf("Architecture = %q, Architectures = %q; want %q, %q", m.Architecture, m.Architectures, tt.architecture, tt.architectures)
+			}
+			if m.DisplayName != tt.displayName {
+				t.Errorf("DisplayName = %q, want %q", m.DisplayName, tt.displayName)
+			}
+		})
+	}
+}
+
+func TestReadManifestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a zip", []byte("MZ")},
+		{"no manifest", zipBytes(t, "Tool.exe", "MZ")},
+		{"bad XML", zipBytes(t, "AppxManifest.xml", "<Package><Identity")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := readManifest(bytes.NewReader(tt.data), int64(len(tt.data))); err == nil {
+				t.Errorf("readManifest = %+v, want an error", *m)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nexus/internal/msi"
+	"nexus/internal/pe"
+)
+
+// What checking a signature can find.
+const (
+	Unsigned  = "unsigned"
+	Invalid   = "invalid"   // the signature or the file digest does not check out
+	Untrusted = "untrusted" // intact, but the signer does not chain to a trusted root
+	Trusted   = "trusted"
+)
+
+// Signature is what was found when checking the Authenticode signature of
+// a file.
+type Signature struct {
+	Status string
+
+	// Problem says why the signature is invalid or untrusted.
+	Problem string
+
+	Subject      string
+	Issuer       string
+	Publisher    string // common name of the signer, or else its organization
+	Organization string
+	Digest       string // digest algorithm the file was signed with
+
+	// Timestamp is when a timestamping authority saw the signature. It is
+	// zero when the signature was not timestamped.
+	Timestamp time.Time
+}
+
+// Supported reports whether the signature of the file at path can be
+// checked: PE files and Windows Installer databases and patches.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exe", ".dll", ".msi", ".msp":
+		return true
+	}
+	return false
+}
+
+// Verify checks the Authenticode signature of the file at path. The signer
+// is trusted when its certificate chains to roots, or to the system roots
+// when roots is nil, and may be used for code signing at the time of the
+// timestamp, or now when there is none. An error means the file could not
+// be read; a broken signature is reported in the Signature.
+func Verify(path string, roots *x509.CertPool) (*Signature, error) {
+	var raw []byte
+	var hashContent func(h crypto.Hash) ([]byte, error)
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".exe", ".dll":
+		raw, err = pe.ReadSignature(path)
+		hashContent = func(h crypto.Hash) ([]byte, error) { return pe.HashSignedContent(path, h) }
+	case ".msi", ".msp":
+		raw, err = msi.ReadDigitalSignature(path)
+		hashContent = func(h crypto.Hash) ([]byte, error) { return msi.HashSignedContent(path, h) }
+	default:
+		return nil, fmt.Errorf("signatures of %s files cannot be checked", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signature: %v", err)
+	}
+	if raw == nil {
+		return &Signature{Status: Unsigned}, nil
+	}
+
+	sig := &Signature{}
+	if err := sig.verify(raw, hashContent, roots); err != nil {
+		sig.Status = Invalid
+		sig.Problem = err.Error()
+	}
+	return sig, nil
+}
+
+// verify fills in s from the signature raw. It returns an error when the
+// signature is broken; an intact signature from an untrusted signer is a
+// status, not an error.
+func (s *Signature) verify(raw []byte, hashContent func(h crypto.Hash) ([]byte, error), roots *x509.CertPool) error {
+	sd, err := parseSignedData(raw)
+	if err != nil {
+		return err
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidSpcIndirectData) {
+		return fmt.Errorf("not an Authenticode signature")
+	}
+	signedContent, err := sd.ContentInfo.inner()
+	if err != nil {
+		return err
+	}
+	var content spcIndirectDataContent
+	if _, err := asn1.Unmarshal(signedContent.FullBytes, &content); err != nil {
+		return fmt.Errorf("failed to parse signed content: %v", err)
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse certificates: %v", err)
+	}
+	si := sd.SignerInfos[0]
+	if signer := findCertificate(certs, si.IssuerAndSerialNumber); signer != nil {
+		s.Subject = signer.Subject.String()
+		s.Issuer = signer.Issuer.String()
+		if len(signer.Subject.Organization) > 0 {
+			s.Organization = signer.Subject.Organization[0]
+		}
+		s.Publisher = signer.Subject.CommonName
+		if s.Publisher == "" {
+			s.Publisher = s.Organization
+		}
+	}
+
+	// The file must hash to the digest in the signed content.
+	fileHash, err := hashFor(content.MessageDigest.Algorithm)
+	if err != nil {
+		return err
+	}
+	s.Digest = fileHash.String()
+	fileDigest, err := hashContent(fileHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(fileDigest, content.MessageDigest.Digest) {
+		return fmt.Errorf("the file was modified after it was signed")
+	}
+
+	// The signed content is hashed without its own tag and length.
+	signer, err := checkSigner(si, certs, signedContent.Bytes)
+	if err != nil {
+		return err
+	}
+
+	// A timestamp lets a signature outlive the signer's certificate, so it
+	// only counts when the timestamping authority is trusted too.
+	s.Timestamp = timestamp(si, certs, roots)
+
+	if err := verifyChain(signer, certs, roots, x509.ExtKeyUsageCodeSigning, s.Timestamp); err != nil {
+		s.Status = Untrusted
+		s.Problem = err.Error()
+	} else {
+		s.Status = Trusted
+	}
+	return nil
+}
+
+// checkSigner checks that the authenticated attributes of si carry the
+// digest of content and are signed by si's certificate, which it returns.
+func checkSigner(si signerInfo, certs []*x509.Certificate, content []byte) (*x509.Certificate, error) {
+	cert := findCertificate(certs, si.IssuerAndSerialNumber)
+	if cert == nil {
+		return nil, fmt.Errorf("the signer's certificate is missing")
+	}
+	h, err := hashFor(si.DigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := parseAttributes(si.AuthenticatedAttributes)
+	if err != nil {
+		return nil, err
+	}
+	var messageDigest []byte
+	if found, err := findAttribute(attrs, oidMessageDigest, &messageDigest); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("the signature has no message digest")
+	}
+	if !bytes.Equal(digest(h, content), messageDigest) {
+		return nil, fmt.Errorf("the signed content does not match its message digest")
+	}
+
+	// The attributes are signed as a SET, not with the [0] tag they are
+	// stored under.
+	signed := append([]byte(nil), si.AuthenticatedAttributes.FullBytes...)
+	signed[0] = 0x31
+	if err := checkSignature(cert.PublicKey, h, signed, si.EncryptedDigest); err != nil {
+		return nil, fmt.Errorf("bad signature: %v", err)
+	}
+	return cert, nil
+}
+
+// timestamp returns the time in the countersignature of si, either a
+// PKCS#9 countersignature or an RFC 3161 timestamp token, when it is over
+// this signature and from a trusted timestamping authority. It is zero
+// otherwise.
+func timestamp(si signerInfo, certs []*x509.Certificate, roots *x509.CertPool) time.Time {
+	attrs, err := parseAttributes(si.UnauthenticatedAttributes)
+	if err != nil {
+		return time.Time{}
+	}
+
+	var counter signerInfo
+	if found, err := findAttribute(attrs, oidCounterSignature, &counter); found && err == nil {
+		tsa, err := checkSigner(counter, certs, si.EncryptedDigest)
+		if err != nil {
+			return time.Time{}
+		}
+		counterAttrs, _ := parseAttributes(counter.AuthenticatedAttributes)
+		var signingTime time.Time
+		if found, err := findAttribute(counterAttrs, oidSigningTime, &signingTime); !found || err != nil {
+			return time.Time{}
+		}
+		if verifyChain(tsa, certs, roots, x509.ExtKeyUsageTimeStamping, signingTime) != nil {
+			return time.Time{}
+		}
+		return signingTime
+	}
+
+	var token asn1.RawValue
+	if found, err := findAttribute(attrs, oidRFC3161Countersign, &token); found && err == nil {
+		sd, err := parseSignedData(token.FullBytes)
+		if err != nil || !sd.ContentInfo.ContentType.Equal(oidTSTInfo) {
+			return time.Time{}
+		}
+		tsaCerts, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return time.Time{}
+		}
+		// The TSTInfo is DER inside an OCTET STRING.
+		content, err := sd.ContentInfo.inner()
+		if err != nil {
+			return time.Time{}
+		}
+		tsa, err := checkSigner(sd.SignerInfos[0], tsaCerts, content.Bytes)
+		if err != nil {
+			return time.Time{}
+		}
+		var info tstInfo
+		if _, err := asn1.Unmarshal(content.Bytes, &info); err != nil {
+			return time.Time{}
+		}
+		h, err := hashFor(info.MessageImprint.Algorithm)
+		if err != nil || !bytes.Equal(info.MessageImprint.Digest, digest(h, si.EncryptedDigest)) {
+			return time.Time{}
+		}
+		if verifyChain(tsa, tsaCerts, roots, x509.ExtKeyUsageTimeStamping, info.GenTime) != nil {
+			return time.Time{}
+		}
+		return info.GenTime
+	}
+	return time.Time{}
+}
+
+// verifyChain checks that cert chains to roots through certs and may be
+// used for usage at the time at, or now when at is zero.
+func verifyChain(cert *x509.Certificate, certs []*x509.Certificate, roots *x509.CertPool, usage x509.ExtKeyUsage, at time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+		CurrentTime:   at,
+	})
+	return err
+}
+
+func findCertificate(certs []*x509.Certificate, id issuerAndSerial) *x509.Certificate {
+	for _, c := range certs {
+		if c.SerialNumber.Cmp(id.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, id.Issuer.FullBytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+func checkSignature(pub any, h crypto.Hash, signed, sig []byte) error {
+	d := digest(h, signed)
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, h, d, sig)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, d, sig) {
+			return fmt.Errorf("ECDSA verification failure")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
@@ -0,0 +1,203 @@
+package authenticode
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func verify(t *testing.T, path string, roots *x509.CertPool) *Signature {
+	t.Helper()
+	sig, err := Verify(path, roots)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	return sig
+}
+
+func checkStatus(t *testing.T, sig *Signature, status, problem string) {
+	t.Helper()
+	if sig.Status != status {
+		t.Errorf("Status = %q (%s), want %q", sig.Status, sig.Problem, status)
+	}
+	if !strings.Contains(sig.Problem, problem) {
+		t.Errorf("Problem = %q, want it to mention %q", sig.Problem, problem)
+	}
+}
+
+func TestVerifyPE(t *testing.T) {
+	root, roots := newRoot(t, "Test Root")
+	_, otherRoots := newRoot(t, "Other Root")
+	now := time.Now()
+	ecdsaSigner := root.issue(t, leaf("Nexus Test", "Nexus", now.Add(-time.Hour), now.Add(time.Hour), x509.ExtKeyUsageCodeSigning), false)
+	rsaSigner := root.issue(t, leaf("", "Nexus RSA", now.Add(-time.Hour), now.Add(time.Hour), x509.ExtKeyUsageCodeSigning), true)
+
+	image := testPE()
+	sign := func(signer testCert) []byte {
+		return signPE(image, authenticodeSignature(t, peDigest(image), oidSpcPeImageData, signer, []*x509.Certificate{signer.cert}, nil))
+	}
+	tampered := sign(ecdsaSigner)
+	tampered[peSectionData] ^= 0xFF
+	rechecksummed := sign(ecdsaSigner)
+	le.PutUint32(rechecksummed[peChecksum:], 0xCAFEF00D)
+
+	tests := []struct {
+		name      string
+		file      []byte
+		roots     *x509.CertPool
+		status    string
+		problem   string
+		publisher string
+	}{
+		{"ecdsa", sign(ecdsaSigner), roots, Trusted, "", "Nexus Test"},
+		{"rsa", sign(rsaSigner), roots, Trusted, "", "Nexus RSA"},
+		{"other root", sign(ecdsaSigner), otherRoots, Untrusted, "unknown authority", "Nexus Test"},
+		{"tampered", tampered, roots, Invalid, "modified", "Nexus Test"},
+		{"checksum", rechecksummed, roots, Trusted, "", "Nexus Test"},
+		{"unsigned", image, roots, Unsigned, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := verify(t, writeFile(t, "setup.exe", tt.file), tt.roots)
+			checkStatus(t, sig, tt.status, tt.problem)
+			if sig.Publisher != tt.publisher {
+				t.Errorf("Publisher = %q, want %q", sig.Publisher, tt.publisher)
+			}
+			if tt.status != Unsigned && sig.Digest != "SHA-256" {
+				t.Errorf("Digest = %q, want SHA-256", sig.Digest)
+			}
+		})
+	}
+}
+
+func TestVerifyMSI(t *testing.T) {
+	root, roots := newRoot(t, "Test Root")
+	now := time.Now()
+	signer := root.issue(t, leaf("Nexus Test", "Nexus", now.Add(-time.Hour), now.Add(time.Hour), x509.ExtKeyUsageCodeSigning), false)
+
+	// Names that sort differently as UTF-16 than as UTF-8, one a prefix of
+	// another, and a stream too large for the mini stream.
+	streams := []testStream{
+		{name: "\x05SummaryInformation", data: []byte("summary"), created: 1, modified: 2},
+		{name: "䡀㬿", data: []byte("string pool"), modified: 3},
+		{name: "Binary.a", data: []byte("a")},
+		{name: "Binary.ab", data: bytes.Repeat([]byte("ab"), 5000), state: 7},
+		{name: "\U0001F600", data: []byte("emoji")},
+	}
+
+	sign := func(streams []testStream, ex bool) []testStream {
+		digest, prehash := msiDigest(streams, ex)
+		signed := append([]testStream(nil), streams...)
+		signed = append(signed, testStream{name: signatureStreamName, data: authenticodeSignature(t, digest, oidSpcSipInfo, signer, []*x509.Certificate{signer.cert}, nil)})
+		if ex {
+			signed = append(signed, testStream{name: signatureExStreamName, data: prehash})
+		}
+		return signed
+	}
+	reversed := func(streams []testStream) []testStream {
+		out := append([]testStream(nil), streams...)
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+		return out
+	}
+
+	for _, ex := range []bool{false, true} {
+		name := "plain"
+		if ex {
+			name = "extended"
+		}
+		t.Run(name, func(t *testing.T) {
+			signed := sign(streams, ex)
+
+			tampered := sign(streams, ex)
+			tampered[3].data = bytes.Clone(tampered[3].data)
+			tampered[3].data[4000] ^= 0xFF
+
+			// Only an extended signature covers the directory metadata.
+			touched := sign(streams, ex)
+			touched[2].modified = 42
+			touchedStatus, touchedProblem := Trusted, ""
+			if ex {
+				touchedStatus, touchedProblem = Invalid, "metadata"
+			}
+
+			tests := []struct {
+				name    string
+				streams []testStream
+				status  string
+				problem string
+			}{
+				{"signed", signed, Trusted, ""},
+				{"directory order", reversed(signed), Trusted, ""},
+				{"tampered", tampered, Invalid, "modified"},
+				{"touched", touched, touchedStatus, touchedProblem},
+				{"unsigned", streams, Unsigned, ""},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					sig := verify(t, writeFile(t, "setup.msi", writeCFB(tt.streams)), roots)
+					checkStatus(t, sig, tt.status, tt.problem)
+				})
+			}
+		})
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	root, roots := newRoot(t, "Test Root")
+	otherRoot, _ := newRoot(t, "Other Root")
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// The signer's certificate expired a week ago, but the signature was
+	// made while it was valid.
+	expired := root.issue(t, leaf("Nexus Test", "Nexus", now.Add(-20*day), now.Add(-7*day), x509.ExtKeyUsageCodeSigning), false)
+	signedAt := now.Add(-10 * day)
+	tsa := root.issue(t, leaf("Test TSA", "Nexus", now.Add(-25*day), now.Add(25*day), x509.ExtKeyUsageTimeStamping), true)
+	untrustedTSA := otherRoot.issue(t, leaf("Other TSA", "Other", now.Add(-25*day), now.Add(25*day), x509.ExtKeyUsageTimeStamping), false)
+	wrongKey := root.issue(t, leaf("Nexus Test", "Nexus", now.Add(-time.Hour), now.Add(time.Hour), x509.ExtKeyUsageCodeSigning), false)
+
+	image := testPE()
+	tests := []struct {
+		name      string
+		signer    testCert
+		cert      *x509.Certificate
+		ts        *testTimestamp
+		status    string
+		problem   string
+		timestamp time.Time
+	}{
+		{"timestamped", expired, expired.cert, &testTimestamp{tsa, signedAt}, Trusted, "", signedAt},
+		{"not timestamped", expired, expired.cert, nil, Untrusted, "expired", time.Time{}},
+		{"untrusted authority", expired, expired.cert, &testTimestamp{untrustedTSA, signedAt}, Untrusted, "expired", time.Time{}},
+		{"after expiry", expired, expired.cert, &testTimestamp{tsa, now.Add(-day)}, Untrusted, "expired", now.Add(-day)},
+		{"wrong key", wrongKey, expired.cert, nil, Invalid, "bad signature", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The certificate is the one the signature names, which is not
+			// necessarily the signer's.
+			signer := testCert{tt.cert, tt.signer.key}
+			raw := authenticodeSignature(t, peDigest(image), oidSpcPeImageData, signer, []*x509.Certificate{tt.cert}, tt.ts)
+			sig := verify(t, writeFile(t, "setup.exe", signPE(image, raw)), roots)
+			checkStatus(t, sig, tt.status, tt.problem)
+			if !sig.Timestamp.Equal(tt.timestamp.Truncate(time.Second)) {
+				t.Errorf("Timestamp = %v, want %v", sig.Timestamp, tt.timestamp.Truncate(time.Second))
+			}
+		})
+	}
+}
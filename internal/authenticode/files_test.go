@@ -0,0 +1,289 @@
+package authenticode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"unicode/utf16"
+)
+
+// The helpers below build small PE and MSI files, and compute their
+// Authenticode digests independently of the pe and msi packages, so the
+// tests check those packages rather than repeat them.
+
+var le = binary.LittleEndian
+
+// Offsets in the PE built by testPE.
+const (
+	peChecksum      = 0x98 + 64           // optional header + 64
+	peSecurityEntry = 0x98 + 112 + 4*8    // data directories + entry 4
+	peSectionData   = 0x200               // raw data of .text
+	peImageSize     = peSectionData + 512 // the file without a signature
+)
+
+// testPE returns a minimal PE32+ image with a single .text section.
+func testPE() []byte {
+	b := make([]byte, peImageSize)
+	copy(b, "MZ")
+	le.PutUint32(b[0x3C:], 0x80)
+	copy(b[0x80:], "PE\x00\x00")
+
+	coff := b[0x84:]
+	le.PutUint16(coff[0:], 0x8664) // AMD64
+	le.PutUint16(coff[2:], 1)      // sections
+	le.PutUint16(coff[16:], 240)   // size of the optional header
+	le.PutUint16(coff[18:], 0x22)  // executable, large address aware
+
+	opt := b[0x98:]
+	le.PutUint16(opt[0:], 0x20B) // PE32+
+	le.PutUint32(opt[16:], 0x1000)
+	le.PutUint64(opt[24:], 0x140000000)
+	le.PutUint32(opt[32:], 0x1000)
+	le.PutUint32(opt[36:], 0x200)
+	le.PutUint32(opt[56:], 0x2000)
+	le.PutUint32(opt[60:], 0x200)
+	le.PutUint32(opt[64:], 0x12345678) // checksum
+	le.PutUint16(opt[68:], 3)          // console
+	le.PutUint32(opt[108:], 16)        // data directories
+
+	section := b[0x98+240:]
+	copy(section, ".text")
+	le.PutUint32(section[8:], 0x10)
+	le.PutUint32(section[12:], 0x1000)
+	le.PutUint32(section[16:], 512)
+	le.PutUint32(section[20:], peSectionData)
+	le.PutUint32(section[36:], 0x60000020)
+
+	copy(b[peSectionData:], []byte{0x31, 0xC0, 0xC3}) // xor eax, eax; ret
+	return b
+}
+
+// peDigest hashes an unsigned image the way Authenticode does: everything
+// but the checksum and the security directory entry.
+func peDigest(image []byte) []byte {
+	h := sha256.New()
+	h.Write(image[:peChecksum])
+	h.Write(image[peChecksum+4 : peSecurityEntry])
+	h.Write(image[peSecurityEntry+8:])
+	return h.Sum(nil)
+}
+
+// signPE appends signature to image in a WIN_CERTIFICATE and points the
+// security directory at it.
+func signPE(image, signature []byte) []byte {
+	cert := le.AppendUint32(nil, uint32(8+len(signature)))
+	cert = le.AppendUint16(cert, 0x0200)
+	cert = le.AppendUint16(cert, winCertTypePKCSSignedData)
+	cert = append(cert, signature...)
+	for len(cert)%8 != 0 {
+		cert = append(cert, 0)
+	}
+
+	signed := append(bytes.Clone(image), cert...)
+	le.PutUint32(signed[peSecurityEntry:], uint32(len(image)))
+	le.PutUint32(signed[peSecurityEntry+4:], uint32(len(cert)))
+	return signed
+}
+
+const winCertTypePKCSSignedData = 2
+
+// testStream is a stream of a compound file with the directory metadata
+// an extended MSI signature covers.
+type testStream struct {
+	name     string
+	data     []byte
+	state    uint32
+	created  uint64
+	modified uint64
+}
+
+// msiCLSID is the class ID of the root storage of an MSI database.
+var msiCLSID = [16]byte{0x84, 0x10, 0x0C, 0x00, 0, 0, 0, 0, 0xC0, 0, 0, 0, 0, 0, 0, 0x46}
+
+const (
+	signatureStreamName   = "\x05DigitalSignature"
+	signatureExStreamName = "\x05MsiDigitalSignatureEx"
+)
+
+func utf16Name(name string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(name)) {
+		b = le.AppendUint16(b, c)
+	}
+	return b
+}
+
+// msiDigest hashes streams the way Authenticode does for an MSI: the
+// contents in the order of their UTF-16 names, then the root CLSID. With
+// ex, the digest of the directory metadata goes first; it is returned too,
+// since it is the content of the MsiDigitalSignatureEx stream.
+func msiDigest(streams []testStream, ex bool) (digest, prehash []byte) {
+	order := append([]testStream(nil), streams...)
+	sort.Slice(order, func(i, j int) bool {
+		a := append(utf16Name(order[i].name), 0, 0)
+		b := append(utf16Name(order[j].name), 0, 0)
+		if diff := bytes.Compare(a[:min(len(a), len(b))], b[:min(len(a), len(b))]); diff != 0 {
+			return diff < 0
+		}
+		return len(a) < len(b)
+	})
+
+	h := sha256.New()
+	if ex {
+		m := sha256.New()
+		m.Write(msiCLSID[:])
+		m.Write(make([]byte, 4)) // root state bits
+		for _, s := range order {
+			m.Write(utf16Name(s.name))
+			m.Write(le.AppendUint32(nil, uint32(len(s.data))))
+			m.Write(le.AppendUint32(nil, s.state))
+			m.Write(le.AppendUint64(nil, s.created))
+			m.Write(le.AppendUint64(nil, s.modified))
+		}
+		prehash = m.Sum(nil)
+		h.Write(prehash)
+	}
+	for _, s := range order {
+		h.Write(s.data)
+	}
+	h.Write(msiCLSID[:])
+	return h.Sum(nil), prehash
+}
+
+// writeCFB returns a version 3 compound file with streams below its root,
+// in the order given. Streams under 4096 bytes go in the mini stream.
+func writeCFB(streams []testStream) []byte {
+	const (
+		sectorSize  = 512
+		miniSize    = 64
+		endOfChain  = 0xFFFFFFFE
+		freeSector  = 0xFFFFFFFF
+		fatSector   = 0xFFFFFFFD
+		noStreamID  = 0xFFFFFFFF
+		miniCutoff  = 4096
+		fatPerSect  = sectorSize / 4
+		headerDIFAT = 109
+	)
+
+	var sectors []byte
+	var fat []uint32
+	alloc := func(data []byte) uint32 {
+		if len(data) == 0 {
+			return endOfChain
+		}
+		start := uint32(len(fat))
+		n := (len(data) + sectorSize - 1) / sectorSize
+		for i := 0; i < n; i++ {
+			sector := make([]byte, sectorSize)
+			copy(sector, data[i*sectorSize:])
+			sectors = append(sectors, sector...)
+			fat = append(fat, start+uint32(i)+1)
+		}
+		fat[len(fat)-1] = endOfChain
+		return start
+	}
+
+	var mini []byte
+	var miniFat []uint32
+	starts := make([]uint32, len(streams))
+	for i, s := range streams {
+		switch {
+		case len(s.data) == 0:
+			starts[i] = endOfChain
+		case len(s.data) < miniCutoff:
+			start := uint32(len(miniFat))
+			n := (len(s.data) + miniSize - 1) / miniSize
+			padded := make([]byte, n*miniSize)
+			copy(padded, s.data)
+			mini = append(mini, padded...)
+			for j := 0; j < n; j++ {
+				miniFat = append(miniFat, start+uint32(j)+1)
+			}
+			miniFat[len(miniFat)-1] = endOfChain
+			starts[i] = start
+		default:
+			starts[i] = alloc(s.data)
+		}
+	}
+	miniStart := alloc(mini)
+	var miniFatData []byte
+	for _, next := range miniFat {
+		miniFatData = le.AppendUint32(miniFatData, next)
+	}
+	miniFatStart := alloc(miniFatData)
+
+	entry := func(name string, kind byte, right, child uint32, clsid [16]byte, s testStream, start uint32, size uint64) []byte {
+		b := make([]byte, 128)
+		if name != "" {
+			raw := utf16Name(name)
+			copy(b, raw)
+			le.PutUint16(b[0x40:], uint16(len(raw)+2))
+		}
+		b[0x42] = kind
+		b[0x43] = 1 // black
+		le.PutUint32(b[0x44:], noStreamID)
+		le.PutUint32(b[0x48:], right)
+		le.PutUint32(b[0x4C:], child)
+		copy(b[0x50:], clsid[:])
+		le.PutUint32(b[0x60:], s.state)
+		le.PutUint64(b[0x64:], s.created)
+		le.PutUint64(b[0x6C:], s.modified)
+		le.PutUint32(b[0x74:], start)
+		le.PutUint64(b[0x78:], size)
+		return b
+	}
+	child := uint32(noStreamID)
+	if len(streams) > 0 {
+		child = 1
+	}
+	dir := entry("Root Entry", 5, noStreamID, child, msiCLSID, testStream{}, miniStart, uint64(len(mini)))
+	for i, s := range streams {
+		right := uint32(noStreamID)
+		if i+1 < len(streams) {
+			right = uint32(i + 2)
+		}
+		dir = append(dir, entry(s.name, 2, right, noStreamID, [16]byte{}, s, starts[i], uint64(len(s.data)))...)
+	}
+	for len(dir)%sectorSize != 0 {
+		dir = append(dir, entry("", 0, noStreamID, noStreamID, [16]byte{}, testStream{}, 0, 0)...)
+	}
+	dirStart := alloc(dir)
+
+	fatSectors := 1
+	for fatSectors*fatPerSect < len(fat)+fatSectors {
+		fatSectors++
+	}
+	fatStart := uint32(len(fat))
+	for i := 0; i < fatSectors; i++ {
+		fat = append(fat, fatSector)
+	}
+	for len(fat) < fatSectors*fatPerSect {
+		fat = append(fat, freeSector)
+	}
+	for _, next := range fat {
+		sectors = le.AppendUint32(sectors, next)
+	}
+
+	header := make([]byte, sectorSize)
+	copy(header, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1})
+	le.PutUint16(header[0x18:], 0x3E)
+	le.PutUint16(header[0x1A:], 3)
+	le.PutUint16(header[0x1C:], 0xFFFE)
+	le.PutUint16(header[0x1E:], 9)
+	le.PutUint16(header[0x20:], 6)
+	le.PutUint32(header[0x2C:], uint32(fatSectors))
+	le.PutUint32(header[0x30:], dirStart)
+	le.PutUint32(header[0x38:], miniCutoff)
+	le.PutUint32(header[0x3C:], miniFatStart)
+	le.PutUint32(header[0x40:], uint32((len(miniFatData)+sectorSize-1)/sectorSize))
+	le.PutUint32(header[0x44:], endOfChain)
+	for i := 0; i < headerDIFAT; i++ {
+		next := uint32(freeSector)
+		if i < fatSectors {
+			next = fatStart + uint32(i)
+		}
+		le.PutUint32(header[0x4C+i*4:], next)
+	}
+	return append(header, sectors...)
+}
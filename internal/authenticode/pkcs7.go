@@ -0,0 +1,177 @@
+package authenticode
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSpcIndirectData    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidMessageDigest      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidTSTInfo            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidRFC3161Countersign = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// The structures below are the parts of PKCS#7 (RFC 2315) and Authenticode
+// that verification needs. Anything else is kept raw or skipped.
+
+// contentInfo keeps its content with the [0] EXPLICIT tag around it; see
+// inner.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// inner returns the content without its tag.
+func (ci contentInfo) inner() (asn1.RawValue, error) {
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &v); err != nil {
+		return v, fmt.Errorf("failed to parse %v content: %v", ci.ContentType, err)
+	}
+	return v, nil
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// spcIndirectDataContent is what an Authenticode signature signs: a
+// description of the file, which is skipped, and the digest of the file.
+type spcIndirectDataContent struct {
+	Data          asn1.RawValue
+	MessageDigest digestInfo
+}
+
+type digestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+// tstInfo is the start of an RFC 3161 timestamp token, up to the time.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint digestInfo
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// parseSignedData unwraps a ContentInfo holding a SignedData.
+func parseSignedData(der []byte) (*signedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("not a PKCS#7 signature: %v", err)
+	} else if len(trimZeros(rest)) > 0 {
+		return nil, fmt.Errorf("trailing data after the PKCS#7 signature")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content is %v, not SignedData", ci.ContentType)
+	}
+	content, err := ci.inner()
+	if err != nil {
+		return nil, err
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(content.FullBytes, &sd); err != nil {
+		return nil, fmt.Errorf("failed to parse SignedData: %v", err)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one signer, found %d", len(sd.SignerInfos))
+	}
+	return &sd, nil
+}
+
+// trimZeros drops the padding that the PE certificate table and some
+// signing tools leave after the signature.
+func trimZeros(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// parseAttributes reads the attributes in an [0] or [1] IMPLICIT SET.
+func parseAttributes(raw asn1.RawValue) ([]attribute, error) {
+	var attrs []attribute
+	for rest := raw.Bytes; len(rest) > 0; {
+		var a attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &a); err != nil {
+			return nil, fmt.Errorf("failed to parse attributes: %v", err)
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs, nil
+}
+
+// findAttribute unmarshals the first value of the attribute of type oid
+// into out, and reports whether there was one.
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier, out any) (bool, error) {
+	for _, a := range attrs {
+		if a.Type.Equal(oid) {
+			if _, err := asn1.Unmarshal(a.Values.Bytes, out); err != nil {
+				return true, fmt.Errorf("failed to parse attribute %v: %v", oid, err)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hashFor maps a digest algorithm identifier to its hash.
+func hashFor(alg pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	switch {
+	case alg.Algorithm.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case alg.Algorithm.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case alg.Algorithm.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case alg.Algorithm.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", alg.Algorithm)
+}
+
+func digest(h crypto.Hash, data []byte) []byte {
+	w := h.New()
+	w.Write(data)
+	return w.Sum(nil)
+}
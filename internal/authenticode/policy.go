@@ -0,0 +1,53 @@
+package authenticode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Levels of signature policy.
+const (
+	PolicyReport  = "report"  // record the signature, block nothing
+	PolicySigned  = "signed"  // block unsigned installers and broken signatures
+	PolicyTrusted = "trusted" // also block signers that are not trusted
+)
+
+// Policy decides which installers may be packaged.
+type Policy struct {
+	Level string
+
+	// Publishers, when set, are the only signers allowed, matched against
+	// the common name or organization of the signer. Setting them implies
+	// at least PolicySigned.
+	Publishers []string
+}
+
+// Check returns why the installer with signature s may not be packaged, or
+// nil when it may.
+func (p Policy) Check(s *Signature) error {
+	enforced := p.Level == PolicySigned || p.Level == PolicyTrusted || len(p.Publishers) > 0
+	switch {
+	case !enforced:
+		return nil
+	case s.Status == Unsigned:
+		return fmt.Errorf("the installer is not signed")
+	case s.Status == Invalid:
+		return fmt.Errorf("the signature is invalid: %s", s.Problem)
+	case s.Status == Untrusted && p.Level == PolicyTrusted:
+		return fmt.Errorf("the signer is not trusted: %s", s.Problem)
+	}
+	if len(p.Publishers) > 0 && !p.allows(s) {
+		return fmt.Errorf("%s is not a trusted publisher", s.Publisher)
+	}
+	return nil
+}
+
+func (p Policy) allows(s *Signature) bool {
+	for _, name := range p.Publishers {
+		name = strings.TrimSpace(name)
+		if strings.EqualFold(name, s.Publisher) || (s.Organization != "" && strings.EqualFold(name, s.Organization)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package authenticode
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// The helpers below sign files the way Authenticode signing tools do, with
+// certificates from a throwaway PKI, so the verifier can be tested without
+// real signed installers.
+
+var (
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidSpcPeImageData  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 15}
+	oidSpcSipInfo      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 30}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidTimestampPolicy = asn1.ObjectIdentifier{1, 2, 3, 4}
+
+	testSerial int64
+)
+
+// testCert is a certificate with its private key.
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newRoot creates a self-signed root and a pool holding only it.
+func newRoot(t *testing.T, name string) (testCert, *x509.CertPool) {
+	t.Helper()
+	now := time.Now()
+	root := newCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-30 * 24 * time.Hour),
+		NotAfter:              now.Add(30 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, false)
+	pool := x509.NewCertPool()
+	pool.AddCert(root.cert)
+	return root, pool
+}
+
+// issue creates a certificate from template signed by ca, with an RSA key
+// when useRSA is set and an ECDSA key otherwise.
+func (ca testCert) issue(t *testing.T, template *x509.Certificate, useRSA bool) testCert {
+	t.Helper()
+	return newCert(t, template, &ca, useRSA)
+}
+
+// leaf returns a template for an end-entity certificate valid from
+// notBefore to notAfter for usage.
+func leaf(name, org string, notBefore, notAfter time.Time, usage ...x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name, Organization: []string{org}},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: usage,
+	}
+}
+
+func newCert(t *testing.T, template *x509.Certificate, ca *testCert, useRSA bool) testCert {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	if useRSA {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	template.SerialNumber = big.NewInt(testSerial)
+
+	parent, parentKey := template, key
+	if ca != nil {
+		parent, parentKey = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testCert{cert, key}
+}
+
+func marshal(t *testing.T, v any) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func tagged(class, tag int, content ...[]byte) asn1.RawValue {
+	return asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: bytes.Join(content, nil)}
+}
+
+func newAttribute(t *testing.T, oid asn1.ObjectIdentifier, value any) []byte {
+	t.Helper()
+	return marshal(t, attribute{Type: oid, Values: tagged(asn1.ClassUniversal, asn1.TagSet, marshal(t, value))})
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// buildSignedData builds a ContentInfo holding a SignedData over content, which
+// is the DER of a contentType. messageDigest is the SHA-256 of hashed, the
+// part of the content the format signs. unauthenticated, when set, returns
+// the unauthenticated attributes for the finished signature.
+func buildSignedData(t *testing.T, contentType asn1.ObjectIdentifier, content, hashed []byte, signer testCert, certs []*x509.Certificate, unauthenticated func(encryptedDigest []byte) [][]byte) []byte {
+	t.Helper()
+	attrs := bytes.Join([][]byte{
+		newAttribute(t, oidContentType, contentType),
+		newAttribute(t, oidMessageDigest, sha256Sum(hashed)),
+	}, nil)
+	toSign := marshal(t, tagged(asn1.ClassUniversal, asn1.TagSet, attrs))
+	sig, err := signer.key.Sign(rand.Reader, sha256Sum(toSign), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	algorithm := oidECDSAWithSHA256
+	if _, ok := signer.key.(*rsa.PrivateKey); ok {
+		algorithm = oidRSAEncryption
+	}
+	si := signerInfo{
+		Version: 1,
+		IssuerAndSerialNumber: issuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: signer.cert.RawIssuer},
+			SerialNumber: signer.cert.SerialNumber,
+		},
+		DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		AuthenticatedAttributes:   tagged(asn1.ClassContextSpecific, 0, attrs),
+		DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: algorithm},
+		EncryptedDigest:           sig,
+	}
+	if unauthenticated != nil {
+		si.UnauthenticatedAttributes = tagged(asn1.ClassContextSpecific, 1, unauthenticated(sig)...)
+	}
+
+	var raw [][]byte
+	for _, c := range certs {
+		raw = append(raw, c.Raw)
+	}
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      contentInfo{ContentType: contentType, Content: tagged(asn1.ClassContextSpecific, 0, content)},
+		Certificates:     tagged(asn1.ClassContextSpecific, 0, raw...),
+		SignerInfos:      []signerInfo{si},
+	}
+	return marshal(t, contentInfo{
+		ContentType: oidSignedData,
+		Content:     tagged(asn1.ClassContextSpecific, 0, marshal(t, sd)),
+	})
+}
+
+// testTimestamp is an RFC 3161 timestamping authority and the time it
+// vouches for.
+type testTimestamp struct {
+	tsa testCert
+	at  time.Time
+}
+
+// countersign returns the RFC 3161 timestamp token attribute over the
+// signature encryptedDigest.
+func (ts testTimestamp) countersign(t *testing.T, encryptedDigest []byte) []byte {
+	t.Helper()
+	info := marshal(t, tstInfo{
+		Version:        1,
+		Policy:         oidTimestampPolicy,
+		MessageImprint: digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, Digest: sha256Sum(encryptedDigest)},
+		SerialNumber:   big.NewInt(1),
+		GenTime:        ts.at.UTC().Truncate(time.Second),
+	})
+	token := buildSignedData(t, oidTSTInfo, marshal(t, info), info, ts.tsa, []*x509.Certificate{ts.tsa.cert}, nil)
+	return marshal(t, attribute{Type: oidRFC3161Countersign, Values: tagged(asn1.ClassUniversal, asn1.TagSet, token)})
+}
+
+// authenticodeSignature signs digest, the SHA-256 of a file as Authenticode
+// hashes it. data describes the kind of file.
+func authenticodeSignature(t *testing.T, digest []byte, data asn1.ObjectIdentifier, signer testCert, certs []*x509.Certificate, ts *testTimestamp) []byte {
+	t.Helper()
+	content := marshal(t, spcIndirectDataContent{
+		Data:          asn1.RawValue{FullBytes: marshal(t, struct{ Type asn1.ObjectIdentifier }{data})},
+		MessageDigest: digestInfo{Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, Digest: digest},
+	})
+	// The signed content is hashed without its own tag and length.
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(content, &seq); err != nil {
+		t.Fatal(err)
+	}
+
+	var unauthenticated func([]byte) [][]byte
+	if ts != nil {
+		unauthenticated = func(encryptedDigest []byte) [][]byte {
+			return [][]byte{ts.countersign(t, encryptedDigest)}
+		}
+	}
+	return buildSignedData(t, oidSpcIndirectData, content, seq.Bytes, signer, certs, unauthenticated)
+}
@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexus/internal/checksum"
+)
+
+// DirName is the folder in the downloads directory the cache lives in.
+// Inside it, index holds one JSON entry per URL, named after the SHA-256
+// of the URL; blobs holds the downloaded files, named after the SHA-256 of
+// their content, so two URLs serving the same file share one copy; and
+// partial holds downloads in progress.
+const DirName = "cache"
+
+// Cache is the download cache in a downloads directory.
+type Cache struct {
+	dir string
+}
+
+// Entry is what the cache knows about one URL.
+type Entry struct {
+	URL          string    `json:"url"`
+	File         string    `json:"file"`
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Used         time.Time `json:"used"`
+}
+
+// Open returns the cache in the downloads directory dir.
+func Open(dir string) *Cache {
+	return &Cache{dir: filepath.Join(dir, DirName)}
+}
+
+// Dir is where the cache lives.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+func key(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) indexPath(url string) string {
+	return filepath.Join(c.dir, "index", key(url)+".json")
+}
+
+// Path is the cached file of e.
+func (c *Cache) Path(e *Entry) string {
+	return filepath.Join(c.dir, "blobs", e.File)
+}
+
+// DownloadPath is where a download of url goes until it is stored. ext
+// keeps the extension the installer is recognised by.
+func (c *Cache) DownloadPath(url, ext string) string {
+	return filepath.Join(c.dir, "partial", key(url)+ext)
+}
+
+// Lookup returns the entry for url, or nil when the URL is not cached or
+// its file is gone.
+func (c *Cache) Lookup(url string) *Entry {
+	e, err := readEntry(c.indexPath(url))
+	if err != nil || e.URL != url {
+		return nil
+	}
+	if _, err := os.Stat(c.Path(e)); err != nil {
+		return nil
+	}
+	return e
+}
+
+// Store moves the finished download of url at file into the cache and
+// records it with the validators the server sent.
+func (c *Cache) Store(url, file, etag, lastModified string) (*Entry, error) {
+	sum, err := checksum.File(file, checksum.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Entry{
+		URL:          url,
+		File:         sum + strings.ToLower(filepath.Ext(file)),
+		SHA256:       sum,
+		Size:         info.Size(),
+		ETag:         etag,
+		LastModified: lastModified,
+		Fetched:      time.Now(),
+	}
+	e.Used = e.Fetched
+
+	blob := c.Path(e)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	// A blob with this name already has this content, unless it was
+	// damaged, so replacing it is always safe.
+	if err := os.Rename(file, blob); err != nil {
+		return nil, fmt.Errorf("failed to move download into the cache: %v", err)
+	}
+	return e, c.write(e)
+}
+
+// Touch records that e was used, after the server confirmed it is current,
+// along with any new validators the server sent.
+func (c *Cache) Touch(e *Entry, etag, lastModified string) error {
+	if etag != "" {
+		e.ETag = etag
+	}
+	if lastModified != "" {
+		e.LastModified = lastModified
+	}
+	e.Used = time.Now()
+	return c.write(e)
+}
+
+// Verify checks that the cached file of e still has the content it was
+// stored with.
+func (c *Cache) Verify(e *Entry) error {
+	sum, err := checksum.File(c.Path(e), checksum.SHA256)
+	if err != nil {
+		return err
+	}
+	if sum != e.SHA256 {
+		return fmt.Errorf("cached copy of %s is damaged", e.URL)
+	}
+	return nil
+}
+
+// Remove forgets url. Its file is left for Prune, since another URL may
+// share it.
+func (c *Cache) Remove(url string) error {
+	if err := os.Remove(c.indexPath(url)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Entries lists the cached URLs, most recently used first.
+func (c *Cache) Entries() ([]*Entry, error) {
+	files, err := os.ReadDir(filepath.Join(c.dir, "index"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %v", err)
+	}
+
+	var entries []*Entry
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		if e, err := readEntry(filepath.Join(c.dir, "index", f.Name())); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Used.After(entries[j].Used)
+	})
+	return entries, nil
+}
+
+// Pruned is what Prune removed.
+type Pruned struct {
+	Entries int
+	Files   int
+	Bytes   int64
+}
+
+// Prune forgets URLs not used for longer than maxAge, then the least
+// recently used ones until the cached files fit in maxSize, and deletes the
+// files no URL refers to any more. Downloads left unfinished for longer
+// than maxAge are deleted too. A negative limit is no limit.
+func (c *Cache) Prune(maxSize int64, maxAge time.Duration) (Pruned, error) {
+	var pruned Pruned
+	entries, err := c.Entries()
+	if err != nil {
+		return pruned, err
+	}
+
+	now := time.Now()
+	kept := map[string]bool{}
+	var size int64
+	full := false
+	for _, e := range entries {
+		_, statErr := os.Stat(c.Path(e))
+		stale := maxAge >= 0 && now.Sub(e.Used) > maxAge
+		if !kept[e.File] && maxSize >= 0 && size+e.Size > maxSize {
+			full = true
+		}
+		// Once the cache is full, an entry whose file is already kept costs
+		// nothing, so only entries that would add a file are dropped.
+		if statErr != nil || stale || (full && !kept[e.File]) {
+			if err := c.Remove(e.URL); err != nil {
+				return pruned, err
+			}
+			pruned.Entries++
+			continue
+		}
+		if !kept[e.File] {
+			size += e.Size
+		}
+		kept[e.File] = true
+	}
+
+	blobs, _ := os.ReadDir(filepath.Join(c.dir, "blobs"))
+	for _, b := range blobs {
+		if kept[b.Name()] {
+			continue
+		}
+		removed, err := removeFile(filepath.Join(c.dir, "blobs", b.Name()))
+		if err != nil {
+			return pruned, err
+		}
+		pruned.Files++
+		pruned.Bytes += removed
+	}
+
+	if maxAge >= 0 {
+		partials, _ := os.ReadDir(filepath.Join(c.dir, "partial"))
+		for _, p := range partials {
+			info, err := p.Info()
+			if err != nil || now.Sub(info.ModTime()) <= maxAge {
+				continue
+			}
+			removed, err := removeFile(filepath.Join(c.dir, "partial", p.Name()))
+			if err != nil {
+				return pruned, err
+			}
+			pruned.Files++
+			pruned.Bytes += removed
+		}
+	}
+	return pruned, nil
+}
+
+func removeFile(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return 0, fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	return info.Size(), nil
+}
+
+func readEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	// The file is named after the checksum, so an entry where they disagree
+	// was damaged or edited by hand.
+	if len(e.SHA256) != sha256.Size*2 || !strings.HasPrefix(e.File, e.SHA256) || filepath.Base(e.File) != e.File {
+		return nil, fmt.Errorf("invalid cache entry %s", path)
+	}
+	return &e, nil
+}
+
+// write saves e to the index through a temporary file, so a crash never
+// leaves half an entry.
+func (c *Cache) write(e *Entry) error {
+	p := c.indexPath(e.URL)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+// ParseSize reads a size such as 500M, 2GB or 1.5GiB. Units are powers of
+// 1024, and a plain number is bytes.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 && i == len(s)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", s[i]) + 1))
+		s = s[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s, expected something like 500M or 2G", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// ParseAge reads an age such as 30d, 2w or 12h.
+func ParseAge(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %s, expected something like 30d, 2w or 12h", value)
+		}
+		return time.Duration(n * float64(unit)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %s, expected something like 30d, 2w or 12h", value)
+	}
+	return d, nil
+}
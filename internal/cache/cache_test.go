@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// store caches data as the download of url, last used age ago.
+func store(t *testing.T, c *Cache, url, data string, age time.Duration) *Entry {
+	t.Helper()
+	file := c.DownloadPath(url, ".msi")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.Store(url, file, "", "")
+	if err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	e.Used = time.Now().Add(-age)
+	if err := c.write(e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestPruneSize(t *testing.T) {
+	c := Open(t.TempDir())
+	store(t, c, "https://example.com/a.msi", "aaaaaaaa", 1*time.Hour)
+	// The same file under a second URL, used after the cache is full.
+	store(t, c, "https://example.com/large.msi", "llllllllllllllll", 2*time.Hour)
+	store(t, c, "https://mirror.example.com/a.msi", "aaaaaaaa", 3*time.Hour)
+	store(t, c, "https://example.com/b.msi", "bbbbbbbb", 4*time.Hour)
+
+	pruned, err := c.Prune(12, -1)
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if pruned.Entries != 2 || pruned.Files != 2 || pruned.Bytes != 24 {
+		t.Errorf("Prune = %+v, want 2 entries and 2 files of 24 bytes", pruned)
+	}
+	for url, want := range map[string]bool{
+		"https://example.com/a.msi":        true,
+		"https://mirror.example.com/a.msi": true,
+		"https://example.com/large.msi":    false,
+		"https://example.com/b.msi":        false,
+	} {
+		if got := c.Lookup(url) != nil; got != want {
+			t.Errorf("Lookup(%s) cached = %v, want %v", url, got, want)
+		}
+	}
+}
+
+func TestInvalidEntry(t *testing.T) {
+	c := Open(t.TempDir())
+	e := store(t, c, "https://example.com/a.msi", "aaaaaaaa", 0)
+
+	for _, sum := range []string{"", "abc", e.SHA256[:63] + "0"} {
+		broken := *e
+		broken.SHA256 = sum
+		if err := c.write(&broken); err != nil {
+			t.Fatal(err)
+		}
+		if c.Lookup(e.URL) != nil {
+			t.Errorf("Lookup with sha256 %q returned an entry", sum)
+		}
+		if entries, err := c.Entries(); err != nil || len(entries) != 0 {
+			t.Errorf("Entries with sha256 %q = %d, %v, want none", sum, len(entries), err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Algorithms that an expected checksum can use.
+const (
+	SHA256 = "SHA-256"
+	SHA512 = "SHA-512"
+)
+
+// Sum is the hash an installer is expected to have. The zero Sum expects
+// nothing.
+type Sum struct {
+	Algorithm string
+	Hex       string
+}
+
+// Parse reads an expected checksum. The algorithm follows from the length
+// of the hex digest, and may also be given as a sha256: or sha512: prefix.
+// An empty value is the zero Sum.
+func Parse(value string) (Sum, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Sum{}, nil
+	}
+
+	algorithm := ""
+	if prefix, digest, found := strings.Cut(value, ":"); found {
+		switch strings.ToLower(strings.ReplaceAll(prefix, "-", "")) {
+		case "sha256":
+			algorithm = SHA256
+		case "sha512":
+			algorithm = SHA512
+		default:
+			return Sum{}, fmt.Errorf("unsupported checksum algorithm %s, expected sha256 or sha512", prefix)
+		}
+		value = digest
+	}
+
+	value = strings.ToLower(value)
+	if _, err := hex.DecodeString(value); err != nil {
+		return Sum{}, fmt.Errorf("checksum is not a hex digest")
+	}
+	switch {
+	case len(value) == 64 && algorithm != SHA512:
+		algorithm = SHA256
+	case len(value) == 128 && algorithm != SHA256:
+		algorithm = SHA512
+	default:
+		return Sum{}, fmt.Errorf("checksum must be a SHA-256 (64 hex digits) or SHA-512 (128 hex digits) digest")
+	}
+	return Sum{Algorithm: algorithm, Hex: value}, nil
+}
+
+// IsZero reports whether no checksum is expected.
+func (s Sum) IsZero() bool {
+	return s.Hex == ""
+}
+
+func (s Sum) String() string {
+	if s.IsZero() {
+		return ""
+	}
+	return strings.ToLower(strings.ReplaceAll(s.Algorithm, "-", "")) + ":" + s.Hex
+}
+
+// Check fails unless digest, in the same algorithm, is the expected one.
+func (s Sum) Check(digest string) error {
+	if !strings.EqualFold(digest, s.Hex) {
+		return fmt.Errorf("%s mismatch: expected %s, got %s", s.Algorithm, s.Hex, digest)
+	}
+	return nil
+}
+
+// File returns the hex digest of the file at path.
+func File(path, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case SHA256:
+		h = sha256.New()
+	case SHA512:
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm %s", algorithm)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,516 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables that override the configured and default locations.
+const (
+	EnvHome      = "NEXUS_HOME"
+	EnvConfig    = "NEXUS_CONFIG"
+	EnvPackages  = "NEXUS_PACKAGES_DIR"
+	EnvDownloads = "NEXUS_DOWNLOADS_DIR"
+)
+
+// Defaults for the settings that are not locations.
+const (
+	DefaultMSIArgs         = "/qn /norestart"
+	DefaultCompany         = "Nexus"
+	DefaultDownloadRetries = 5
+	DefaultConnectTimeout  = 30 * time.Second
+	DefaultReadTimeout     = time.Minute
+	DefaultSignaturePolicy = "report"
+)
+
+// SignaturePolicies are the values signature_policy accepts: record the
+// installer's signature only, require a valid one, or require one that
+// chains to a trusted root.
+var SignaturePolicies = []string{"report", "signed", "trusted"}
+
+// Config is the contents of config.json. Empty values fall back to the
+// defaults.
+type Config struct {
+	PackagesDir  string `json:"packages_dir,omitempty"`
+	DownloadsDir string `json:"downloads_dir,omitempty"`
+	MSIArgs      string `json:"msi_args,omitempty"`
+	EXEArgs      string `json:"exe_args,omitempty"`
+	Company      string `json:"company,omitempty"`
+	Proxy        string `json:"proxy,omitempty"`
+	NoProxy      string `json:"no_proxy,omitempty"`
+
+	DownloadRetries string `json:"download_retries,omitempty"`
+	ConnectTimeout  string `json:"connect_timeout,omitempty"`
+	ReadTimeout     string `json:"read_timeout,omitempty"`
+
+	SignaturePolicy   string `json:"signature_policy,omitempty"`
+	TrustedPublishers string `json:"trusted_publishers,omitempty"`
+	TrustedRoots      string `json:"trusted_roots,omitempty"`
+}
+
+// Key is a setting that `nexus config` can read and change.
+type Key struct {
+	Name        string
+	Description string
+	env         string
+	field       func(c *Config) *string
+	resolve     func(c *Config) string
+	check       func(value string) (string, error)
+}
+
+// Keys are the settings in the order they are listed.
+var Keys = []Key{
+	{
+		Name:        "packages_dir",
+		Description: "Where packages are created",
+		env:         EnvPackages,
+		field:       func(c *Config) *string { return &c.PackagesDir },
+		resolve:     (*Config).Packages,
+		check:       absPath,
+	},
+	{
+		Name:        "downloads_dir",
+		Description: "Where downloaded installers are kept",
+		env:         EnvDownloads,
+		field:       func(c *Config) *string { return &c.DownloadsDir },
+		resolve:     (*Config).Downloads,
+		check:       absPath,
+	},
+	{
+		Name:        "msi_args",
+		Description: "Install arguments for MSI installers",
+		field:       func(c *Config) *string { return &c.MSIArgs },
+		resolve:     (*Config).MSIInstallArgs,
+	},
+	{
+		Name:        "exe_args",
+		Description: "Install arguments for EXE installers whose framework is not recognised",
+		field:       func(c *Config) *string { return &c.EXEArgs },
+		resolve:     func(c *Config) string { return c.EXEArgs },
+	},
+	{
+		Name:        "company",
+		Description: "Company name the scripts log under, in C:\\ProgramData\\<company>",
+		field:       func(c *Config) *string { return &c.Company },
+		resolve:     (*Config).CompanyName,
+	},
+	{
+		Name:        "proxy",
+		Description: "Proxy URL for downloads, instead of HTTPS_PROXY and HTTP_PROXY",
+		field:       func(c *Config) *string { return &c.Proxy },
+		resolve:     func(c *Config) string { return c.Proxy },
+		check:       proxyURL,
+	},
+	{
+		Name:        "no_proxy",
+		Description: "Comma-separated hosts that bypass the proxy",
+		field:       func(c *Config) *string { return &c.NoProxy },
+		resolve:     func(c *Config) string { return c.NoProxy },
+	},
+	{
+		Name:        "download_retries",
+		Description: "How many times a failed download is retried",
+		field:       func(c *Config) *string { return &c.DownloadRetries },
+		resolve:     func(c *Config) string { return strconv.Itoa(c.RetryLimit()) },
+		check:       count,
+	},
+	{
+		Name:        "connect_timeout",
+		Description: "How long to wait for a download server to connect and respond",
+		field:       func(c *Config) *string { return &c.ConnectTimeout },
+		resolve:     func(c *Config) string { return c.DialTimeout().String() },
+		check:       duration,
+	},
+	{
+		Name:        "read_timeout",
+		Description: "How long a download may receive nothing before it is retried",
+		field:       func(c *Config) *string { return &c.ReadTimeout },
+		resolve:     func(c *Config) string { return c.StallTimeout().String() },
+		check:       duration,
+	},
+	{
+		Name:        "signature_policy",
+		Description: "Which installers may be packaged: report, signed or trusted",
+		field:       func(c *Config) *string { return &c.SignaturePolicy },
+		resolve:     (*Config).SignatureLevel,
+		check:       signaturePolicy,
+	},
+	{
+		Name:        "trusted_publishers",
+		Description: "Comma-separated signers allowed to publish installers, by common name or organization",
+		field:       func(c *Config) *string { return &c.TrustedPublishers },
+		resolve:     func(c *Config) string { return c.TrustedPublishers },
+	},
+	{
+		Name:        "trusted_roots",
+		Description: "PEM file of code signing roots to trust instead of the system roots",
+		field:       func(c *Config) *string { return &c.TrustedRoots },
+		resolve:     func(c *Config) string { return c.TrustedRoots },
+		check:       pemFile,
+	},
+}
+
+// LookupKey finds a setting by name.
+func LookupKey(name string) (Key, error) {
+	for _, k := range Keys {
+		if strings.EqualFold(k.Name, name) {
+			return k, nil
+		}
+	}
+	var names []string
+	for _, k := range Keys {
+		names = append(names, k.Name)
+	}
+	return Key{}, fmt.Errorf("unknown setting %s, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Value is the setting as Nexus uses it, with defaults and environment
+// overrides applied.
+func (k Key) Value(c *Config) string {
+	return k.resolve(c)
+}
+
+// Stored is the setting as written in config.json.
+func (k Key) Stored(c *Config) string {
+	return *k.field(c)
+}
+
+// Source says where Value comes from: an environment variable,
+// config.json or the default.
+func (k Key) Source(c *Config) string {
+	if k.env != "" && os.Getenv(k.env) != "" {
+		return "$" + k.env
+	}
+	if k.Stored(c) != "" {
+		return "config.json"
+	}
+	return "default"
+}
+
+// Set changes the setting. An empty value goes back to the default.
+func (k Key) Set(c *Config, value string) error {
+	value = strings.TrimSpace(value)
+	if value != "" && k.check != nil {
+		var err error
+		if value, err = k.check(value); err != nil {
+			return err
+		}
+	}
+	*k.field(c) = value
+	return nil
+}
+
+func absPath(value string) (string, error) {
+	p, err := filepath.Abs(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %s: %v", value, err)
+	}
+	return p, nil
+}
+
+func proxyURL(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid proxy URL %s, expected something like http://proxy:8080", value)
+	}
+	return value, nil
+}
+
+func count(value string) (string, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid count %s, expected a whole number", value)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// duration accepts Go durations such as 90s or 2m, and plain numbers as
+// seconds.
+func duration(value string) (string, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		value = strconv.Itoa(n) + "s"
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("invalid duration %s, expected something like 30s or 2m", value)
+	}
+	return d.String(), nil
+}
+
+func signaturePolicy(value string) (string, error) {
+	for _, p := range SignaturePolicies {
+		if strings.EqualFold(value, p) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("invalid signature policy %s, expected one of %s", value, strings.Join(SignaturePolicies, ", "))
+}
+
+func pemFile(value string) (string, error) {
+	p, err := absPath(value)
+	if err != nil {
+		return "", err
+	}
+	if _, err := readRoots(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func readRoots(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted roots: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// HTTPClient is the client downloads go through. It uses the configured
+// proxy, or the proxy environment variables when none is set, and the
+// connect timeout. There is no overall timeout, since a large installer
+// can take as long as it takes; stalls are caught by the read timeout.
+func (c *Config) HTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: c.DialTimeout(), KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = c.DialTimeout()
+	transport.ResponseHeaderTimeout = c.DialTimeout()
+	if c.Proxy != "" {
+		proxy, _ := url.Parse(c.Proxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), c.NoProxy) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// bypassProxy matches host against a NO_PROXY style list, where an entry
+// also covers its subdomains.
+func bypassProxy(host, noProxy string) bool {
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || strings.EqualFold(host, entry) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// DataDir is the root of everything Nexus stores: $NEXUS_HOME when set,
+// otherwise %ProgramData%\Nexus on Windows, ~/Library/Application
+// Support/Nexus on macOS and $XDG_DATA_HOME/nexus elsewhere.
+func DataDir() string {
+	if dir := os.Getenv(EnvHome); dir != "" {
+		return dir
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		root := os.Getenv("ProgramData")
+		if root == "" {
+			root = `C:\ProgramData`
+		}
+		return filepath.Join(root, "Nexus")
+	case "darwin":
+		return filepath.Join(homeDir(), "Library", "Application Support", "Nexus")
+	}
+
+	root := os.Getenv("XDG_DATA_HOME")
+	if root == "" {
+		root = filepath.Join(homeDir(), ".local", "share")
+	}
+	return filepath.Join(root, "nexus")
+}
+
+// Path is the location of config.json: $NEXUS_CONFIG when set, the data
+// directory on Windows, macOS or with $NEXUS_HOME, and
+// $XDG_CONFIG_HOME/nexus elsewhere.
+func Path() string {
+	if p := os.Getenv(EnvConfig); p != "" {
+		return p
+	}
+	if os.Getenv(EnvHome) != "" || runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return filepath.Join(DataDir(), "config.json")
+	}
+
+	root := os.Getenv("XDG_CONFIG_HOME")
+	if root == "" {
+		root = filepath.Join(homeDir(), ".config")
+	}
+	return filepath.Join(root, "nexus", "config.json")
+}
+
+// DefaultPackagesDir is where packages go when nothing is configured.
+func DefaultPackagesDir() string {
+	return filepath.Join(DataDir(), subdir("Packages"))
+}
+
+// DefaultDownloadsDir is where downloads go when nothing is configured.
+func DefaultDownloadsDir() string {
+	return filepath.Join(DataDir(), subdir("Downloads"))
+}
+
+// Load reads config.json. A missing file is an empty configuration.
+func Load() (*Config, error) {
+	c := &Config{}
+	data, err := os.ReadFile(Path())
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return &Config{}, fmt.Errorf("failed to parse %s: %v", Path(), err)
+	}
+	return c, nil
+}
+
+// Save writes the configuration back to config.json.
+func (c *Config) Save() error {
+	p := Path()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// Packages resolves the packages directory from the environment, the
+// configuration and the platform default, in that order.
+func (c *Config) Packages() string {
+	return resolve(EnvPackages, c.PackagesDir, DefaultPackagesDir())
+}
+
+// Downloads resolves the downloads directory the same way as Packages.
+func (c *Config) Downloads() string {
+	return resolve(EnvDownloads, c.DownloadsDir, DefaultDownloadsDir())
+}
+
+// Trash is where replaced and deleted packages are kept until they are
+// restored.
+func (c *Config) Trash() string {
+	return filepath.Join(DataDir(), subdir("Trash"))
+}
+
+// MSIInstallArgs are the msiexec arguments MSI packages install with.
+func (c *Config) MSIInstallArgs() string {
+	return or(c.MSIArgs, DefaultMSIArgs)
+}
+
+// CompanyName is the company the generated scripts log under.
+func (c *Config) CompanyName() string {
+	return or(c.Company, DefaultCompany)
+}
+
+// RetryLimit is how many times a failed download is retried.
+func (c *Config) RetryLimit() int {
+	if n, err := strconv.Atoi(c.DownloadRetries); err == nil && n >= 0 {
+		return n
+	}
+	return DefaultDownloadRetries
+}
+
+// DialTimeout is how long a download server has to accept the connection
+// and send the response headers.
+func (c *Config) DialTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.ConnectTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultConnectTimeout
+}
+
+// StallTimeout is how long a download may go without receiving any data
+// before the attempt is abandoned and retried.
+func (c *Config) StallTimeout() time.Duration {
+	if d, err := time.ParseDuration(c.ReadTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultReadTimeout
+}
+
+// SignatureLevel is how strictly installer signatures are enforced.
+func (c *Config) SignatureLevel() string {
+	return or(c.SignaturePolicy, DefaultSignaturePolicy)
+}
+
+// Publishers are the signers installers must come from. None means any.
+func (c *Config) Publishers() []string {
+	var names []string
+	for _, name := range strings.Split(c.TrustedPublishers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CodeSigningRoots are the roots signatures are checked against: the
+// trusted_roots file, or nil for the system roots.
+func (c *Config) CodeSigningRoots() (*x509.CertPool, error) {
+	if c.TrustedRoots == "" {
+		return nil, nil
+	}
+	return readRoots(c.TrustedRoots)
+}
+
+// Dirs are the directories Nexus needs to exist before it runs.
+func (c *Config) Dirs() []string {
+	return []string{DataDir(), c.Packages(), c.Downloads()}
+}
+
+func resolve(env, configured, fallback string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	if configured != "" {
+		return configured
+	}
+	return fallback
+}
+
+// subdir keeps the capitalised folder names Windows and macOS users expect
+// and uses lower case under XDG.
+func subdir(name string) string {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+func homeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+	return "."
+}
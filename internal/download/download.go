@@ -0,0 +1,368 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// PartialSuffix is added to the name of a file while it is downloading.
+// The file only gets its real name once the whole body has arrived.
+const PartialSuffix = ".partial"
+
+// validatorSuffix is added to the partial file name for the file holding
+// the ETag or Last-Modified the download was started with, so a later run
+// only resumes it if the file on the server has not changed.
+const validatorSuffix = ".validator"
+
+// maxBackoff caps the wait between attempts.
+const maxBackoff = 30 * time.Second
+
+// after waits between attempts. Tests replace it.
+var after = time.After
+
+// Options control how a file is downloaded.
+type Options struct {
+	Client *http.Client
+
+	// Retries is how many times a failed attempt is retried. Network
+	// errors, stalls, 5xx responses, 408 and 429 are retried; other
+	// responses fail straight away.
+	Retries int
+
+	// StallTimeout abandons an attempt that receives nothing for this
+	// long. Zero means no limit.
+	StallTimeout time.Duration
+
+	// Logf reports resumes and retries.
+	Logf func(format string, args ...any)
+
+	// Progress is called as data arrives with the size of the file so far,
+	// including any part downloaded before, and its full size, or -1 when
+	// the server does not say.
+	Progress func(received, total int64)
+
+	// ETag and LastModified are the validators of a copy the caller already
+	// has. They make the request conditional, and a 304 response ends the
+	// download without touching dest.
+	ETag         string
+	LastModified string
+}
+
+// Result is what the server said about a finished download.
+type Result struct {
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// File downloads url to dest. The body is written to dest.partial, which
+// is resumed with a Range request after a failed attempt, or on a later
+// run, and renamed to dest once it is complete. A later run only resumes
+// when the server sent a strong ETag or Last-Modified to check the file
+// against; without one the download starts over. When the server answers
+// a conditional request with 304 Not Modified, dest is left alone.
+func File(ctx context.Context, url, dest string, opts Options) (Result, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...any) {}
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(int64, int64) {}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return Result{}, fmt.Errorf("failed to create directory %s: %v", filepath.Dir(dest), err)
+	}
+
+	partial := dest + PartialSuffix
+	var result Result
+	for attempt := 0; ; attempt++ {
+		err := fetch(ctx, url, partial, attempt > 0, opts, &result)
+		if err == nil {
+			break
+		}
+		var retry *retryable
+		if !errors.As(err, &retry) || ctx.Err() != nil {
+			return Result{}, err
+		}
+		if attempt >= opts.Retries {
+			return Result{}, fmt.Errorf("%v (gave up after %d attempts)", err, attempt+1)
+		}
+
+		wait := backoff(attempt)
+		if retry.after > 0 {
+			wait = min(retry.after, maxBackoff)
+		}
+		opts.Logf("Attempt %d failed: %v", attempt+1, err)
+		opts.Logf("Retrying in %s", wait.Round(100*time.Millisecond))
+		select {
+		case <-after(wait):
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		}
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	os.Remove(partial + validatorSuffix)
+	if err := os.Rename(partial, dest); err != nil {
+		return Result{}, fmt.Errorf("failed to move download into place: %v", err)
+	}
+	return result, nil
+}
+
+// retryable wraps an error that another attempt may not run into.
+type retryable struct {
+	err   error
+	after time.Duration
+}
+
+func (r *retryable) Error() string { return r.err.Error() }
+func (r *retryable) Unwrap() error { return r.err }
+
+func retry(err error) error {
+	return &retryable{err: err}
+}
+
+// backoff doubles the wait with every attempt, from one second, and adds
+// some jitter so parallel downloads do not retry in step.
+func backoff(attempt int) time.Duration {
+	wait := min(time.Second<<attempt, maxBackoff)
+	return wait + rand.N(wait/4+1)
+}
+
+// fetch makes one attempt at the download, continuing the partial file
+// when it can, and notes the server's validators in result. A partial file
+// without a validator is only continued when retrying, as it was then
+// written by this run moments ago.
+func fetch(ctx context.Context, url, partial string, retrying bool, opts Options, result *Result) error {
+	validatorPath := partial + validatorSuffix
+
+	var offset int64
+	validator := readValidator(validatorPath)
+	if info, err := os.Stat(partial); err == nil && (validator != "" || retrying) {
+		offset = info.Size()
+		if strings.HasPrefix(validator, `"`) {
+			result.ETag = validator
+		} else {
+			result.LastModified = validator
+		}
+	} else {
+		os.Remove(partial)
+		os.Remove(validatorPath)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %v", url, err)
+	}
+	conditional := offset == 0 && (opts.ETag != "" || opts.LastModified != "")
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if validator != "" {
+			req.Header.Set("If-Range", validator)
+		}
+	} else if conditional {
+		if opts.ETag != "" {
+			req.Header.Set("If-None-Match", opts.ETag)
+		}
+		if opts.LastModified != "" {
+			req.Header.Set("If-Modified-Since", opts.LastModified)
+		}
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return retry(fmt.Errorf("failed to download file: %v", err))
+	}
+	defer resp.Body.Close()
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		result.ETag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		result.LastModified = lastModified
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		result.NotModified = true
+		if result.ETag == "" {
+			result.ETag = opts.ETag
+		}
+		if result.LastModified == "" {
+			result.LastModified = opts.LastModified
+		}
+		return nil
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, _, ok := contentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			os.Remove(partial)
+			return retry(fmt.Errorf("server resumed at the wrong offset, starting over"))
+		}
+		flags |= os.O_APPEND
+		opts.Logf("Resuming at %d bytes", offset)
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			opts.Logf("Server sent the whole file, starting over")
+		}
+		offset = 0
+		flags |= os.O_TRUNC
+		if v := validatorOf(resp); v != "" {
+			os.WriteFile(validatorPath, []byte(v), 0644)
+		} else {
+			os.Remove(validatorPath)
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		if _, total, ok := contentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return nil
+		}
+		os.Remove(partial)
+		return retry(fmt.Errorf("partial download no longer matches, starting over"))
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return &retryable{err: fmt.Errorf("bad status: %s", resp.Status), after: retryAfter(resp)}
+	default:
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	out, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	opts.Progress(offset, total)
+
+	body := io.Reader(resp.Body)
+	var stalled atomic.Bool
+	if opts.StallTimeout > 0 {
+		timer := time.AfterFunc(opts.StallTimeout, func() {
+			stalled.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+		body = &stallReader{r: resp.Body, timer: timer, timeout: opts.StallTimeout}
+	}
+
+	written, err := io.Copy(&progressWriter{w: out, received: offset, total: total, report: opts.Progress}, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if stalled.Load() {
+			return retry(fmt.Errorf("no data received for %s", opts.StallTimeout))
+		}
+		return retry(fmt.Errorf("download interrupted after %d bytes: %v", offset+written, err))
+	}
+	if resp.ContentLength >= 0 && written < resp.ContentLength {
+		return retry(fmt.Errorf("connection closed after %d of %d bytes", written, resp.ContentLength))
+	}
+	return nil
+}
+
+// stallReader pushes the stall timer back whenever data arrives.
+type stallReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+	return n, err
+}
+
+// progressWriter reports every write to Options.Progress.
+type progressWriter struct {
+	w        io.Writer
+	received int64
+	total    int64
+	report   func(received, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.received += int64(n)
+	p.report(p.received, p.total)
+	return n, err
+}
+
+// validatorOf returns what If-Range can compare against: a strong ETag,
+// or else Last-Modified.
+func validatorOf(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+func readValidator(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// contentRange parses "bytes start-end/total" and "bytes */total". The
+// total is -1 when the server does not know it.
+func contentRange(value string) (start, total int64, ok bool) {
+	value, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, size, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	total = -1
+	if size != "*" {
+		var err error
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if span == "*" {
+		return 0, total, true
+	}
+	first, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
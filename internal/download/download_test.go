@@ -0,0 +1,377 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var body = bytes.Repeat([]byte("0123456789abcdef"), 4096)
+
+const etag = `"v1"`
+
+// server serves body with an ETag, letting handle take over a request by
+// returning true. It records the Range and If-Range headers of every
+// request.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newServer(t *testing.T, handle func(n int, w http.ResponseWriter, r *http.Request) bool) *server {
+	s := &server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, strings.TrimSpace(r.Header.Get("Range")+" "+r.Header.Get("If-Range")))
+		n := len(s.requests)
+		s.mu.Unlock()
+		if handle != nil && handle(n, w, r) {
+			return
+		}
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "setup.exe", time.Time{}, bytes.NewReader(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) ranges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// truncate sends the headers for the whole body but only n bytes of it.
+func truncate(w http.ResponseWriter, n int, validator bool) {
+	if validator {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.Write(body[:n])
+}
+
+// noWait makes retries immediate and returns the waits File asked for.
+func noWait(t *testing.T) *[]time.Duration {
+	var waits []time.Duration
+	after = func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		return time.After(0)
+	}
+	t.Cleanup(func() { after = time.After })
+	return &waits
+}
+
+// leavePartial sets up dest.partial as an earlier run left it.
+func leavePartial(t *testing.T, dest string, data []byte, validator string) {
+	t.Helper()
+	if err := os.WriteFile(dest+PartialSuffix, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if validator != "" {
+		os.WriteFile(dest+PartialSuffix+validatorSuffix, []byte(validator), 0644)
+	}
+}
+
+func checkFile(t *testing.T, dest string) {
+	t.Helper()
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("download is %d bytes and differs from the %d byte body", len(data), len(body))
+	}
+	for _, leftover := range []string{dest + PartialSuffix, dest + PartialSuffix + validatorSuffix} {
+		if _, err := os.Stat(leftover); err == nil {
+			t.Errorf("%s was left behind", filepath.Base(leftover))
+		}
+	}
+}
+
+func checkRanges(t *testing.T, s *server, want ...string) {
+	t.Helper()
+	if got := s.ranges(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("requests had Range and If-Range %q, want %q", got, want)
+	}
+}
+
+func TestFile(t *testing.T) {
+	s := newServer(t, nil)
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+
+	var last, total int64
+	result, err := File(context.Background(), s.URL, dest, Options{Progress: func(received, size int64) { last, total = received, size }})
+	if err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	if result.ETag != etag || result.NotModified {
+		t.Errorf("Result = %+v", result)
+	}
+	if last != int64(len(body)) || total != int64(len(body)) {
+		t.Errorf("last progress %d of %d", last, total)
+	}
+}
+
+func TestFileResumesAfterFailedAttempt(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(n int, w http.ResponseWriter, r *http.Request) bool {
+		if n == 1 {
+			truncate(w, 1000, true)
+			return true
+		}
+		return false
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	if _, err := File(context.Background(), s.URL, dest, Options{Retries: 1}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, "", `bytes=1000- "v1"`)
+}
+
+func TestFileResumesEarlierRun(t *testing.T) {
+	s := newServer(t, nil)
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	leavePartial(t, dest, body[:5000], etag)
+
+	var logs []string
+	opts := Options{Logf: func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }}
+	if _, err := File(context.Background(), s.URL, dest, opts); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, `bytes=5000- "v1"`)
+	if len(logs) != 1 || logs[0] != "Resuming at 5000 bytes" {
+		t.Errorf("logged %q", logs)
+	}
+}
+
+func TestFileChangedOnServer(t *testing.T) {
+	// The partial was started against an older file; If-Range makes the
+	// server send all of the new one.
+	s := newServer(t, nil)
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	leavePartial(t, dest, []byte("old file"), `"v0"`)
+
+	if _, err := File(context.Background(), s.URL, dest, Options{}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, `bytes=8- "v0"`)
+}
+
+func TestFileIgnoringRange(t *testing.T) {
+	s := newServer(t, func(_ int, w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set("ETag", etag)
+		w.Write(body)
+		return true
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	leavePartial(t, dest, body[:5000], etag)
+
+	if _, err := File(context.Background(), s.URL, dest, Options{}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+}
+
+func TestFileWrongOffset(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(n int, w http.ResponseWriter, r *http.Request) bool {
+		if n == 1 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 4000-%d/%d", len(body)-1, len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body[4000:])
+			return true
+		}
+		return false
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	leavePartial(t, dest, body[:5000], etag)
+
+	if _, err := File(context.Background(), s.URL, dest, Options{Retries: 0}); err == nil || !strings.Contains(err.Error(), "wrong offset") {
+		t.Fatalf("File error = %v, want the wrong offset", err)
+	}
+	if _, err := os.Stat(dest + PartialSuffix); err == nil {
+		t.Error("partial file kept after a resume at the wrong offset")
+	}
+
+	// The next run starts over.
+	if _, err := File(context.Background(), s.URL, dest, Options{}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, `bytes=5000- "v1"`, "")
+}
+
+func TestFileAlreadyComplete(t *testing.T) {
+	s := newServer(t, nil)
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	leavePartial(t, dest, body, etag)
+
+	if _, err := File(context.Background(), s.URL, dest, Options{}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, fmt.Sprintf(`bytes=%d- "v1"`, len(body)))
+}
+
+func TestFileRetries(t *testing.T) {
+	waits := noWait(t)
+	s := newServer(t, func(n int, w http.ResponseWriter, r *http.Request) bool {
+		switch n {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			return false
+		}
+		return true
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	if _, err := File(context.Background(), s.URL, dest, Options{Retries: 3}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	// A backoff of a second plus jitter, then what the server asked for,
+	// capped.
+	if len(*waits) != 3 || (*waits)[0] < time.Second || (*waits)[0] > 2*time.Second || (*waits)[1] != 7*time.Second || (*waits)[2] != maxBackoff {
+		t.Errorf("waited %v", *waits)
+	}
+}
+
+func TestFileGivesUp(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(_ int, w http.ResponseWriter, _ *http.Request) bool {
+		w.WriteHeader(http.StatusBadGateway)
+		return true
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	_, err := File(context.Background(), s.URL, dest, Options{Retries: 2})
+	if err == nil || !strings.Contains(err.Error(), "502") || !strings.Contains(err.Error(), "gave up after 3 attempts") {
+		t.Errorf("File error = %v", err)
+	}
+	if len(s.ranges()) != 3 {
+		t.Errorf("made %d requests, want 3", len(s.ranges()))
+	}
+}
+
+func TestFileNotFound(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(_ int, w http.ResponseWriter, r *http.Request) bool {
+		http.NotFound(w, r)
+		return true
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	if _, err := File(context.Background(), s.URL, dest, Options{Retries: 3}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("File error = %v, want a 404", err)
+	}
+	if len(s.ranges()) != 1 {
+		t.Errorf("a 404 was retried %d times", len(s.ranges())-1)
+	}
+}
+
+func TestFileStall(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(n int, w http.ResponseWriter, r *http.Request) bool {
+		if n == 1 {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			w.Write(body[:3000])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return true
+		}
+		return false
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+
+	var logs []string
+	opts := Options{
+		Retries:      1,
+		StallTimeout: 100 * time.Millisecond,
+		Logf:         func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) },
+	}
+	if _, err := File(context.Background(), s.URL, dest, opts); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, "", `bytes=3000- "v1"`)
+	if len(logs) == 0 || !strings.Contains(logs[0], "no data received for 100ms") {
+		t.Errorf("logged %q", logs)
+	}
+}
+
+func TestFileNotModified(t *testing.T) {
+	s := newServer(t, func(_ int, w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+	os.WriteFile(dest, []byte("cached copy"), 0644)
+
+	result, err := File(context.Background(), s.URL, dest, Options{ETag: etag, LastModified: "Mon, 02 Jan 2006 15:04:05 GMT"})
+	if err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	if !result.NotModified || result.ETag != etag || result.LastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("Result = %+v", result)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "cached copy" {
+		t.Errorf("dest was replaced with %d bytes", len(data))
+	}
+}
+
+func TestFileWithoutValidators(t *testing.T) {
+	noWait(t)
+	s := newServer(t, func(n int, w http.ResponseWriter, r *http.Request) bool {
+		if n == 1 {
+			truncate(w, 1000, false)
+			return true
+		}
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start int
+			fmt.Sscanf(rng, "bytes=%d-", &start)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body[start:])
+			return true
+		}
+		w.Write(body)
+		return true
+	})
+	dest := filepath.Join(t.TempDir(), "setup.exe")
+
+	// A retry in the same run continues the partial file.
+	if _, err := File(context.Background(), s.URL, dest, Options{Retries: 1}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, "", "bytes=1000-")
+
+	// A later run cannot tell whether the file changed and starts over.
+	leavePartial(t, dest, []byte("stale"), "")
+	if _, err := File(context.Background(), s.URL, dest, Options{}); err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	checkFile(t, dest)
+	checkRanges(t, s, "", "bytes=1000-", "")
+}
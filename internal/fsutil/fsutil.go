@@ -0,0 +1,99 @@
+package fsutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// CopyTree copies the file or folder src to dst, keeping the permissions of
+// every file and folder.
+func CopyTree(src, dst string) error {
+	// Folders are created writable so their contents can be copied in, and
+	// only given their own permissions once they are complete.
+	type folder struct {
+		path string
+		mode fs.FileMode
+	}
+	var folders []folder
+
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if !d.IsDir() {
+			return CopyFile(p, target)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(target, 0700); err != nil {
+			return err
+		}
+		folders = append(folders, folder{target, info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(folders) - 1; i >= 0; i-- {
+		if err := os.Chmod(folders[i].path, folders[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Move moves the file or folder src to dst. When they are on different
+// volumes, src is copied and then removed.
+func Move(src, dst string) error {
+	if err := rename(src, dst); err == nil {
+		return nil
+	}
+	if err := CopyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// rename is os.Rename, replaced in tests to stand in for another volume.
+var rename = os.Rename
+
+// CopyFile copies the file src to dst with the same permissions, replacing
+// dst if it exists.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	// The umask applies to new files and an existing file keeps its mode,
+	// so the permissions are set explicitly.
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,81 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCopyTreeKeepsModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permissions")
+	}
+	src := filepath.Join(t.TempDir(), "src")
+	os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	os.WriteFile(filepath.Join(src, "bin", "install.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(src, "secret.txt"), []byte("key"), 0600)
+	os.MkdirAll(filepath.Join(src, "readonly"), 0755)
+	os.WriteFile(filepath.Join(src, "readonly", "file.txt"), []byte("x"), 0644)
+	os.Chmod(filepath.Join(src, "readonly"), 0555)
+	t.Cleanup(func() { os.Chmod(filepath.Join(src, "readonly"), 0755) })
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	if err := CopyTree(src, dst); err != nil {
+		t.Fatalf("CopyTree: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(dst, "readonly"), 0755) })
+
+	for name, want := range map[string]os.FileMode{
+		"bin/install.sh":    0755,
+		"secret.txt":        0600,
+		"readonly":          0555,
+		"readonly/file.txt": 0644,
+	} {
+		info, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestCopyFileReplaces(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	os.WriteFile(src, []byte("new"), 0644)
+	os.WriteFile(dst, []byte("old and longer"), 0600)
+
+	if err := CopyFile(src, dst); err != nil {
+		t.Fatalf("CopyFile: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Errorf("dst holds %q, want %q", data, "new")
+	}
+	if info, _ := os.Stat(dst); runtime.GOOS != "windows" && info.Mode().Perm() != 0644 {
+		t.Errorf("dst has mode %v, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestMoveAcrossVolumes(t *testing.T) {
+	rename = func(string, string) error { return &os.LinkError{Op: "rename", Err: os.ErrInvalid} }
+	t.Cleanup(func() { rename = os.Rename })
+
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "setup.exe"), []byte("MZ"), 0644)
+
+	if err := Move(src, dst); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("src still exists after Move: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "sub", "setup.exe")); string(data) != "MZ" {
+		t.Errorf("dst/sub/setup.exe holds %q, want %q", data, "MZ")
+	}
+}
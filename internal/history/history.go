@@ -0,0 +1,229 @@
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"nexus/internal/fsutil"
+	"nexus/internal/manifest"
+)
+
+// DirName is the folder inside a package that holds its snapshots. It is
+// left out of the .intunewin.
+const DirName = ".history"
+
+// Snapshot is a copy of a package as it was after one build: installer,
+// scripts, .intunewin and nexus.json.
+type Snapshot struct {
+	Key      string
+	Path     string
+	Manifest *manifest.Manifest
+}
+
+// Built is when the snapshot was built, or the zero time when its
+// manifest is missing.
+func (s Snapshot) Built() time.Time {
+	if s.Manifest == nil {
+		return time.Time{}
+	}
+	return s.Manifest.Built
+}
+
+var unsafeKey = regexp.MustCompile(`[^A-Za-z0-9._+-]`)
+
+// Key names the snapshot of a build: its product version and build
+// number, such as 1.2.3+build-4, or just build-4 when the installer has no
+// version.
+func Key(m *manifest.Manifest) string {
+	build := fmt.Sprintf("build-%d", m.Build)
+	if m.Version != "" {
+		return unsafeKey.ReplaceAllString(m.Version, "_") + "+" + build
+	}
+	return build
+}
+
+// Save snapshots the package in dir under key. An existing snapshot is
+// never replaced: when key is taken, the snapshot is saved as key-2, key-3
+// and so on.
+func Save(dir, key string) (Snapshot, error) {
+	root := filepath.Join(dir, DirName)
+	name := key
+	for i := 2; exists(filepath.Join(root, name)); i++ {
+		name = fmt.Sprintf("%s-%d", key, i)
+	}
+	target := filepath.Join(root, name)
+	tmp := filepath.Join(root, "."+name+".tmp")
+	os.RemoveAll(tmp)
+
+	if err := copyPackage(dir, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return Snapshot{}, fmt.Errorf("failed to snapshot %s: %v", name, err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.RemoveAll(tmp)
+		return Snapshot{}, fmt.Errorf("failed to snapshot %s: %v", name, err)
+	}
+	return read(target), nil
+}
+
+// List returns the snapshots of the package in dir, newest build first.
+func List(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, DirName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package history: %v", err)
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		snapshots = append(snapshots, read(filepath.Join(dir, DirName, e.Name())))
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		bi, bj := snapshots[i].Built(), snapshots[j].Built()
+		if !bi.Equal(bj) {
+			return bi.After(bj)
+		}
+		return snapshots[i].Key > snapshots[j].Key
+	})
+	return snapshots, nil
+}
+
+// Find returns the snapshot of the package in dir with the given key. A
+// bare product version matches the newest build of that version, and a
+// bare build number the snapshot of that build.
+func Find(dir, key string) (Snapshot, error) {
+	snapshots, err := List(dir)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, s := range snapshots {
+		if s.Key == key || s.Key == unsafeKey.ReplaceAllString(key, "_") {
+			return s, nil
+		}
+	}
+	for _, s := range snapshots {
+		if s.Manifest != nil && s.Manifest.Version == key {
+			return s, nil
+		}
+	}
+	for _, s := range snapshots {
+		if s.Manifest != nil && fmt.Sprint(s.Manifest.Build) == strings.TrimPrefix(key, "#") {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("no snapshot %s in the package history", key)
+}
+
+// LatestBuild is the highest build number in the history of the package
+// in dir.
+func LatestBuild(dir string) int {
+	snapshots, _ := List(dir)
+	latest := 0
+	for _, s := range snapshots {
+		if s.Manifest != nil && s.Manifest.Build > latest {
+			latest = s.Manifest.Build
+		}
+	}
+	return latest
+}
+
+// Restore makes the snapshot the current contents of the package in dir.
+// The snapshot is copied next to the package first, so a failed copy
+// leaves the package as it was.
+func Restore(dir string, s Snapshot) error {
+	tmp := filepath.Join(dir, DirName, ".restore.tmp")
+	os.RemoveAll(tmp)
+	if err := fsutil.CopyTree(s.Path, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to copy snapshot %s: %v", s.Key, err)
+	}
+	defer os.RemoveAll(tmp)
+
+	current, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range current {
+		if e.Name() == DirName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", e.Name(), err)
+		}
+	}
+
+	restored, err := os.ReadDir(tmp)
+	if err != nil {
+		return err
+	}
+	for _, e := range restored {
+		if err := os.Rename(filepath.Join(tmp, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Carry moves the history of the package in from to the package in to,
+// unless to already has one.
+func Carry(from, to string) error {
+	src := filepath.Join(from, DirName)
+	dst := filepath.Join(to, DirName)
+	if _, err := os.Stat(src); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+	if err := fsutil.Move(src, dst); err != nil {
+		return fmt.Errorf("failed to move package history: %v", err)
+	}
+	return nil
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func read(p string) Snapshot {
+	s := Snapshot{Key: filepath.Base(p), Path: p}
+	if m, err := manifest.Read(p); err == nil {
+		s.Manifest = m
+	}
+	return s
+}
+
+// copyPackage copies the package in dir to dst, leaving out its history.
+func copyPackage(dir, dst string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == DirName {
+			continue
+		}
+		if err := fsutil.CopyTree(filepath.Join(dir, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
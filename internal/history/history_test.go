@@ -0,0 +1,103 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexus/internal/manifest"
+)
+
+// build writes a package with the given version and build number to dir
+// and snapshots it, as a build does.
+func build(t *testing.T, dir, version string, number int, installer string) Snapshot {
+	t.Helper()
+	m := &manifest.Manifest{
+		InstallerFile: "setup.exe",
+		Version:       version,
+		Build:         number,
+		Built:         time.Date(2024, 1, 1, 0, 0, number, 0, time.UTC),
+	}
+	if err := m.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "setup.exe"), []byte(installer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Save(dir, Key(m))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return s
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		version string
+		build   int
+		want    string
+	}{
+		{"24.09.00.0", 4, "24.09.00.0+build-4"},
+		{"1.0 beta/2", 1, "1.0_beta_2+build-1"},
+		{"", 3, "build-3"},
+	}
+	for _, tt := range tests {
+		if got := Key(&manifest.Manifest{Version: tt.version, Build: tt.build}); got != tt.want {
+			t.Errorf("Key(%q, %d) = %q, want %q", tt.version, tt.build, got, tt.want)
+		}
+	}
+}
+
+func TestSaveNeverOverwrites(t *testing.T) {
+	dir := t.TempDir()
+	first := build(t, dir, "1.0", 1, "first")
+	// A snapshot saved again under the same key, as rollback does with hand
+	// edits, goes next to the first one.
+	os.WriteFile(filepath.Join(dir, "setup.exe"), []byte("edited"), 0644)
+	second, err := Save(dir, first.Key)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if second.Key != "1.0+build-1-2" {
+		t.Errorf("second snapshot is %s, want 1.0+build-1-2", second.Key)
+	}
+	for s, want := range map[Snapshot]string{first: "first", second: "edited"} {
+		if data, _ := os.ReadFile(filepath.Join(s.Path, "setup.exe")); string(data) != want {
+			t.Errorf("%s holds %q, want %q", s.Key, data, want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	build(t, dir, "1.0", 1, "a")
+	build(t, dir, "1.0", 2, "b")
+	build(t, dir, "2.0", 3, "c")
+	build(t, dir, "", 4, "d")
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"1.0+build-1", "1.0+build-1"},
+		{"1.0", "1.0+build-2"},
+		{"2.0", "2.0+build-3"},
+		{"1", "1.0+build-1"},
+		{"#3", "2.0+build-3"},
+		{"build-4", "build-4"},
+	}
+	for _, tt := range tests {
+		s, err := Find(dir, tt.key)
+		if err != nil {
+			t.Errorf("Find(%q): %v", tt.key, err)
+			continue
+		}
+		if s.Key != tt.want {
+			t.Errorf("Find(%q) = %s, want %s", tt.key, s.Key, tt.want)
+		}
+	}
+	if s, err := Find(dir, "3.0"); err == nil {
+		t.Errorf("Find(3.0) = %s, want an error", s.Key)
+	}
+}
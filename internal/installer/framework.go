@@ -0,0 +1,178 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+
+	"nexus/internal/pe"
+)
+
+// Framework is an installer technology together with the switches it
+// needs for an unattended install and uninstall.
+type Framework struct {
+	Name          string
+	InstallArgs   string
+	UninstallArgs string
+	// UninstallWithSetup is set when UninstallArgs are for the setup file
+	// itself rather than for the uninstaller it leaves on the machine.
+	UninstallWithSetup bool
+	// Evidence says what the framework was recognised by.
+	Evidence string
+}
+
+var (
+	NSIS = Framework{
+		Name:          "NSIS",
+		InstallArgs:   "/S",
+		UninstallArgs: "/S",
+	}
+	InnoSetup = Framework{
+		Name:          "Inno Setup",
+		InstallArgs:   "/VERYSILENT /SUPPRESSMSGBOXES /NORESTART /SP-",
+		UninstallArgs: "/VERYSILENT /SUPPRESSMSGBOXES /NORESTART",
+	}
+	InstallShield = Framework{
+		Name:               "InstallShield",
+		InstallArgs:        `/s /v"/qn"`,
+		UninstallArgs:      `/s /x /v"/qn"`,
+		UninstallWithSetup: true,
+	}
+	WixBurn = Framework{
+		Name:               "WiX Burn",
+		InstallArgs:        "/quiet /norestart",
+		UninstallArgs:      "/uninstall /quiet /norestart",
+		UninstallWithSetup: true,
+	}
+	AdvancedInstaller = Framework{
+		Name:               "Advanced Installer",
+		InstallArgs:        "/exenoui /qn /norestart",
+		UninstallArgs:      "/x /exenoui /qn /norestart",
+		UninstallWithSetup: true,
+	}
+	InstallAware = Framework{
+		Name:               "InstallAware",
+		InstallArgs:        "/s",
+		UninstallArgs:      "/s MODIFY=FALSE REMOVE=TRUE UNINSTALL=YES",
+		UninstallWithSetup: true,
+	}
+	SetupFactory = Framework{
+		Name:          "Setup Factory",
+		InstallArgs:   "/S",
+		UninstallArgs: "/S",
+	}
+	Wise = Framework{
+		Name:          "Wise",
+		InstallArgs:   "/s",
+		UninstallArgs: "/s",
+	}
+	// Unknown keeps the historical default for EXE installers.
+	Unknown = Framework{
+		Name:          "Unknown",
+		InstallArgs:   "/silent",
+		UninstallArgs: "/silent",
+	}
+)
+
+// How much of the image and of the overlay is searched for markers.
+// Installer stubs are small; the payload behind them can be gigabytes.
+const (
+	imageScanLimit   = 4 << 20
+	overlayScanLimit = 1 << 20
+)
+
+// nsisSignature follows the 4 byte flags field of the NSIS first header.
+var nsisSignature = []byte("\xEF\xBE\xAD\xDENullsoftInst")
+
+type marker struct {
+	framework Framework
+	text      string
+}
+
+// Markers are checked in order; the more specific ones come first since a
+// Burn bundle, for instance, may well mention InstallShield in a payload.
+var markers = []marker{
+	{NSIS, "Nullsoft.NSIS.exehead"},
+	{InnoSetup, "Inno Setup Setup Data"},
+	{InnoSetup, "JR.Inno.Setup"},
+	{AdvancedInstaller, "Advanced Installer"},
+	{AdvancedInstaller, "Caphyon"},
+	{InstallAware, "InstallAware"},
+	{SetupFactory, "Setup Factory"},
+	{InstallShield, "InstallShield"},
+}
+
+// Detect fingerprints the EXE installer at path from its section names,
+// overlay and embedded strings. Installers that cannot be recognised are
+// reported as Unknown without an error.
+func Detect(path string) (Framework, error) {
+	layout, err := pe.ReadLayout(path)
+	if err != nil {
+		return Unknown, err
+	}
+
+	if layout.HasSection(".wixburn") {
+		return found(WixBurn, "section .wixburn"), nil
+	}
+	if layout.HasSection(".WISE") {
+		return found(Wise, "section .WISE"), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Unknown, err
+	}
+	defer f.Close()
+
+	var overlay []byte
+	if layout.OverlaySize > 0 {
+		overlay, err = readAt(f, layout.OverlayOffset, min(layout.OverlaySize, overlayScanLimit))
+		if err != nil {
+			return Unknown, fmt.Errorf("failed to read overlay: %v", err)
+		}
+		if len(overlay) >= 4+len(nsisSignature) && bytes.Equal(overlay[4:4+len(nsisSignature)], nsisSignature) {
+			return found(NSIS, "NSIS header in overlay"), nil
+		}
+	}
+
+	image, err := readAt(f, 0, min(layout.OverlayOffset, imageScanLimit))
+	if err != nil {
+		return Unknown, fmt.Errorf("failed to read image: %v", err)
+	}
+
+	for _, m := range markers {
+		ascii := []byte(m.text)
+		wide := utf16le(m.text)
+		for _, data := range [][]byte{image, overlay} {
+			if bytes.Contains(data, ascii) || bytes.Contains(data, wide) {
+				return found(m.framework, fmt.Sprintf("marker %q", m.text)), nil
+			}
+		}
+	}
+
+	return Unknown, nil
+}
+
+func found(f Framework, evidence string) Framework {
+	f.Evidence = evidence
+	return f
+}
+
+func readAt(r io.ReaderAt, offset, size int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(c), byte(c>>8))
+	}
+	return b
+}
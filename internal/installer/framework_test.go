@@ -0,0 +1,84 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nexus/internal/pe/petest"
+)
+
+func TestDetect(t *testing.T) {
+	text := func(data string) []petest.Section {
+		return []petest.Section{{Name: ".text", Data: []byte(data)}}
+	}
+	nsisOverlay := append([]byte{0, 0, 0, 0}, nsisSignature...)
+
+	tests := []struct {
+		name      string
+		file      petest.File
+		framework string
+		install   string
+		uninstall string
+		withSetup bool
+	}{
+		{"burn section", petest.File{Sections: append(text(""), petest.Section{Name: ".wixburn", Data: []byte{1}})},
+			"WiX Burn", "/quiet /norestart", "/uninstall /quiet /norestart", true},
+		{"wise section", petest.File{Sections: append(text(""), petest.Section{Name: ".WISE", Data: []byte{1}})},
+			"Wise", "/s", "/s", false},
+		{"nsis overlay", petest.File{Sections: text("\xC3"), Overlay: nsisOverlay},
+			"NSIS", "/S", "/S", false},
+		{"nsis marker", petest.File{Sections: text("Nullsoft.NSIS.exehead")},
+			"NSIS", "/S", "/S", false},
+		{"inno marker", petest.File{Sections: text("Inno Setup Setup Data (6.2.0)")},
+			"Inno Setup", "/VERYSILENT /SUPPRESSMSGBOXES /NORESTART /SP-", "/VERYSILENT /SUPPRESSMSGBOXES /NORESTART", false},
+		{"installshield in overlay", petest.File{Sections: text(""), Overlay: []byte("...InstallShield...")},
+			"InstallShield", `/s /v"/qn"`, `/s /x /v"/qn"`, true},
+		{"advanced installer wide string", petest.File{Sections: []petest.Section{{Name: ".rdata", Data: utf16le("Caphyon Ltd")}}},
+			"Advanced Installer", "/exenoui /qn /norestart", "/x /exenoui /qn /norestart", true},
+		{"installaware", petest.File{Sections: text("InstallAware Software")},
+			"InstallAware", "/s", "/s MODIFY=FALSE REMOVE=TRUE UNINSTALL=YES", true},
+		{"setup factory", petest.File{Sections: text("Setup Factory 9")},
+			"Setup Factory", "/S", "/S", false},
+		// A Burn bundle may carry an InstallShield payload; the section
+		// decides.
+		{"burn before markers", petest.File{Sections: append(text("InstallShield"), petest.Section{Name: ".wixburn", Data: []byte{1}})},
+			"WiX Burn", "/quiet /norestart", "/uninstall /quiet /norestart", true},
+		{"unknown", petest.File{Sections: text("hello")},
+			"Unknown", "/silent", "/silent", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "setup.exe")
+			if err := os.WriteFile(path, tt.file.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Detect(path)
+			if err != nil {
+				t.Fatalf("Detect: %v", err)
+			}
+			if f.Name != tt.framework {
+				t.Fatalf("Detect = %s (%s), want %s", f.Name, f.Evidence, tt.framework)
+			}
+			if f.InstallArgs != tt.install || f.UninstallArgs != tt.uninstall {
+				t.Errorf("switches = %q, %q; want %q, %q", f.InstallArgs, f.UninstallArgs, tt.install, tt.uninstall)
+			}
+			if f.UninstallWithSetup != tt.withSetup {
+				t.Errorf("UninstallWithSetup = %v, want %v", f.UninstallWithSetup, tt.withSetup)
+			}
+			if tt.framework != "Unknown" && f.Evidence == "" {
+				t.Error("Evidence is empty")
+			}
+		})
+	}
+}
+
+func TestDetectNotPE(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setup.exe")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := Detect(path); err == nil || f.Name != Unknown.Name {
+		t.Errorf("Detect = %s, %v; want Unknown and an error", f.Name, err)
+	}
+}
@@ -0,0 +1,234 @@
+package intunewin
+
+import (
+	"archive/zip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options mirror the -c, -s and -o switches of IntuneWinAppUtil.exe. Name
+// is shown in Intune and defaults to the setup file name; for MSIs the tool
+// uses the ProductName instead.
+type Options struct {
+	SourceDir string
+	SetupFile string
+	OutputDir string
+	Name      string
+	MsiInfo   *MsiInfo
+
+	// Exclude lists files and folders, relative to SourceDir, that are
+	// left out of the package.
+	Exclude []string
+}
+
+// Build packs SourceDir into an encrypted .intunewin file named after the
+// setup file and returns its path.
+func Build(opts Options) (string, error) {
+	sourceDir, err := filepath.Abs(opts.SourceDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid source folder: %v", err)
+	}
+	if info, err := os.Stat(sourceDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("source folder does not exist: %s", sourceDir)
+	}
+
+	setupPath := opts.SetupFile
+	if !filepath.IsAbs(setupPath) {
+		setupPath = filepath.Join(sourceDir, setupPath)
+	}
+	if _, err := os.Stat(setupPath); err != nil {
+		return "", fmt.Errorf("setup file does not exist: %s", setupPath)
+	}
+	setupName := filepath.Base(setupPath)
+
+	outputDir := opts.OutputDir
+	if outputDir == "" {
+		outputDir = sourceDir
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output folder: %v", err)
+	}
+	outputPath := filepath.Join(outputDir, strings.TrimSuffix(setupName, filepath.Ext(setupName))+".intunewin")
+	outputAbs, _ := filepath.Abs(outputPath)
+
+	content, err := os.CreateTemp("", "nexus-content-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(content.Name())
+	defer content.Close()
+
+	digest := newDigestWriter(content)
+	exclude := []string{outputAbs, outputAbs + ".tmp"}
+	for _, name := range opts.Exclude {
+		exclude = append(exclude, filepath.Join(sourceDir, name))
+	}
+	if err := zipDir(digest, sourceDir, exclude); err != nil {
+		return "", fmt.Errorf("failed to compress source folder: %v", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	k, err := newKeys()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := os.CreateTemp("", "nexus-encrypted-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(encrypted.Name())
+	defer encrypted.Close()
+
+	mac, err := encrypt(encrypted, content, k)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt content: %v", err)
+	}
+	if _, err := encrypted.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = setupName
+	}
+
+	b64 := base64.StdEncoding.EncodeToString
+	info := ApplicationInfo{
+		XmlnsXsd:               "http://www.w3.org/2001/XMLSchema",
+		XmlnsXsi:               "http://www.w3.org/2001/XMLSchema-instance",
+		ToolVersion:            toolVersion,
+		Name:                   name,
+		UnencryptedContentSize: digest.size,
+		FileName:               innerFileName,
+		SetupFile:              setupName,
+		EncryptionInfo: EncryptionInfo{
+			EncryptionKey:        b64(k.encryptionKey),
+			MacKey:               b64(k.macKey),
+			InitializationVector: b64(k.iv),
+			Mac:                  b64(mac),
+			ProfileIdentifier:    "ProfileVersion1",
+			FileDigest:           b64(digest.h.Sum(nil)),
+			FileDigestAlgorithm:  "SHA256",
+		},
+		MsiInfo: opts.MsiInfo,
+	}
+
+	tmpOutput := outputPath + ".tmp"
+	if err := writePackage(tmpOutput, encrypted, &info); err != nil {
+		os.Remove(tmpOutput)
+		return "", err
+	}
+	if err := os.Rename(tmpOutput, outputPath); err != nil {
+		os.Remove(tmpOutput)
+		return "", fmt.Errorf("failed to move package into place: %v", err)
+	}
+
+	return outputPath, nil
+}
+
+func writePackage(path string, encrypted io.Reader, info *ApplicationInfo) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create package file: %v", err)
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+
+	// The encrypted payload does not compress, so it is stored as is.
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   contentsDir + "/" + innerFileName,
+		Method: zip.Store,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if _, err := io.Copy(w, encrypted); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+
+	data, err := xml.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode Detection.xml: %v", err)
+	}
+	w, err = zw.Create(detectionFile)
+	if err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write package: %v", err)
+	}
+	return out.Close()
+}
+
+// zipDir compresses every file below dir, skipping the excluded paths and
+// everything below them.
+func zipDir(w io.Writer, dir string, exclude []string) error {
+	zw := zip.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		for _, e := range exclude {
+			if path == e {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,202 @@
+package intunewin
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readPackage returns Detection.xml and the encrypted content file of the
+// package at path.
+func readPackage(t *testing.T, path string) (detection, content []byte) {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatalf("package is not a zip file: %v", err)
+	}
+	defer zr.Close()
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f.Name {
+		case detectionFile:
+			detection = data
+		case contentsDir + "/" + innerFileName:
+			if f.Method != zip.Store {
+				t.Errorf("content file is compressed with method %d", f.Method)
+			}
+			content = data
+		}
+	}
+	if detection == nil || content == nil {
+		t.Fatalf("package holds %q", names)
+	}
+	return detection, content
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 15, 16, 3*64*1024 + 5} {
+		src := t.TempDir()
+		setup := make([]byte, size)
+		rand.Read(setup)
+		os.WriteFile(filepath.Join(src, "setup.exe"), setup, 0644)
+		os.MkdirAll(filepath.Join(src, "files"), 0755)
+		os.WriteFile(filepath.Join(src, "files", "config.ini"), []byte("[setup]\n"), 0644)
+
+		path, err := Build(Options{SourceDir: src, SetupFile: "setup.exe"})
+		if err != nil {
+			t.Fatalf("%d bytes: Build: %v", size, err)
+		}
+		if path != filepath.Join(src, "setup.intunewin") {
+			t.Errorf("%d bytes: Build wrote %s", size, path)
+		}
+
+		detection, content := readPackage(t, path)
+		var info ApplicationInfo
+		if err := xml.Unmarshal(detection, &info); err != nil {
+			t.Fatalf("%d bytes: Detection.xml: %v", size, err)
+		}
+		key, _ := base64.StdEncoding.DecodeString(info.EncryptionInfo.EncryptionKey)
+		macKey, _ := base64.StdEncoding.DecodeString(info.EncryptionInfo.MacKey)
+		var plain bytes.Buffer
+		if err := decrypt(&plain, bytes.NewReader(content), key, macKey); err != nil {
+			t.Fatalf("%d bytes: decrypt: %v", size, err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(plain.Bytes()), int64(plain.Len()))
+		if err != nil {
+			t.Fatalf("%d bytes: content is not a zip file: %v", size, err)
+		}
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name], _ = io.ReadAll(rc)
+			rc.Close()
+		}
+		if _, ok := files["files/"]; !ok || len(files) != 3 {
+			t.Errorf("%d bytes: content holds %d entries", size, len(files))
+		}
+		if !bytes.Equal(files["setup.exe"], setup) {
+			t.Errorf("%d bytes: setup.exe came back as %d bytes", size, len(files["setup.exe"]))
+		}
+		if string(files["files/config.ini"]) != "[setup]\n" {
+			t.Errorf("%d bytes: files/config.ini holds %q", size, files["files/config.ini"])
+		}
+	}
+}
+
+func TestBuildDetectionXML(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "product.msi"), []byte("not really an MSI"), 0644)
+	out := t.TempDir()
+	msi := &MsiInfo{
+		MsiProductCode:      "{11111111-2222-3333-4444-555555555555}",
+		MsiProductVersion:   "1.2.3",
+		MsiPublisher:        "Smith & Sons <Tools>",
+		MsiExecutionContext: "System",
+		MsiIsMachineInstall: true,
+	}
+
+	path, err := Build(Options{SourceDir: src, SetupFile: "product.msi", OutputDir: out, Name: "Café Tool", MsiInfo: msi})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if path != filepath.Join(out, "product.intunewin") {
+		t.Errorf("Build wrote %s", path)
+	}
+	detection, content := readPackage(t, path)
+
+	if !strings.HasPrefix(string(detection), `<?xml version="1.0" encoding="UTF-8"?>`+"\n<ApplicationInfo ") {
+		t.Errorf("Detection.xml starts with %q", detection[:min(len(detection), 80)])
+	}
+	for _, raw := range []string{
+		`xmlns:xsd="http://www.w3.org/2001/XMLSchema"`,
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`,
+		`ToolVersion="` + toolVersion + `"`,
+		"<Name>Café Tool</Name>",
+		"<MsiPublisher>Smith &amp; Sons &lt;Tools&gt;</MsiPublisher>",
+	} {
+		if !bytes.Contains(detection, []byte(raw)) {
+			t.Errorf("Detection.xml lacks %s", raw)
+		}
+	}
+
+	var info ApplicationInfo
+	if err := xml.Unmarshal(detection, &info); err != nil {
+		t.Fatalf("Detection.xml: %v", err)
+	}
+	if info.Name != "Café Tool" || info.SetupFile != "product.msi" || info.FileName != innerFileName {
+		t.Errorf("Name, SetupFile, FileName = %q, %q, %q", info.Name, info.SetupFile, info.FileName)
+	}
+	if info.MsiInfo == nil || *info.MsiInfo != *msi {
+		t.Errorf("MsiInfo = %+v, want %+v", info.MsiInfo, msi)
+	}
+
+	enc := info.EncryptionInfo
+	if enc.ProfileIdentifier != "ProfileVersion1" || enc.FileDigestAlgorithm != "SHA256" {
+		t.Errorf("ProfileIdentifier, FileDigestAlgorithm = %q, %q", enc.ProfileIdentifier, enc.FileDigestAlgorithm)
+	}
+	decode := func(name, s string, size int) []byte {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil || len(b) != size {
+			t.Errorf("%s is %q, want %d base64 encoded bytes", name, s, size)
+		}
+		return b
+	}
+	key := decode("EncryptionKey", enc.EncryptionKey, keySize)
+	macKey := decode("MacKey", enc.MacKey, keySize)
+	iv := decode("InitializationVector", enc.InitializationVector, 16)
+	mac := decode("Mac", enc.Mac, macSize)
+	digest := decode("FileDigest", enc.FileDigest, sha256.Size)
+	if !bytes.Equal(content[:macSize], mac) || !bytes.Equal(content[macSize:macSize+16], iv) {
+		t.Error("Mac and InitializationVector do not match the content file")
+	}
+
+	var plain bytes.Buffer
+	if err := decrypt(&plain, bytes.NewReader(content), key, macKey); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if info.UnencryptedContentSize != int64(plain.Len()) {
+		t.Errorf("UnencryptedContentSize = %d, content is %d bytes", info.UnencryptedContentSize, plain.Len())
+	}
+	if sum := sha256.Sum256(plain.Bytes()); !bytes.Equal(sum[:], digest) {
+		t.Error("FileDigest is not the SHA-256 of the decrypted content")
+	}
+}
+
+func TestBuildWithoutMsiInfo(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "setup.exe"), []byte("MZ"), 0644)
+	path, err := Build(Options{SourceDir: src, SetupFile: "setup.exe"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	detection, _ := readPackage(t, path)
+	if bytes.Contains(detection, []byte("MsiInfo")) {
+		t.Error("Detection.xml of an EXE has MsiInfo")
+	}
+	if !bytes.Contains(detection, []byte("<Name>setup.exe</Name>")) {
+		t.Error("Name does not default to the setup file")
+	}
+}
@@ -0,0 +1,178 @@
+package intunewin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// The inner content file is laid out as HMAC || IV || ciphertext, where the
+// ciphertext is AES-256-CBC with PKCS#7 padding and the HMAC-SHA256 covers
+// IV || ciphertext.
+
+const (
+	keySize = 32
+	macSize = sha256.Size
+)
+
+type keys struct {
+	encryptionKey []byte
+	macKey        []byte
+	iv            []byte
+}
+
+func newKeys() (*keys, error) {
+	k := &keys{
+		encryptionKey: make([]byte, keySize),
+		macKey:        make([]byte, keySize),
+		iv:            make([]byte, aes.BlockSize),
+	}
+	for _, b := range [][]byte{k.encryptionKey, k.macKey, k.iv} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate key material: %v", err)
+		}
+	}
+	return k, nil
+}
+
+// encrypt streams src into dst and returns the HMAC written at the start
+// of dst. dst must be seekable so the HMAC can be filled in afterwards.
+func encrypt(dst io.WriteSeeker, src io.Reader, k *keys) ([]byte, error) {
+	block, err := aes.NewCipher(k.encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	mode := cipher.NewCBCEncrypter(block, k.iv)
+	mac := hmac.New(sha256.New, k.macKey)
+
+	if _, err := dst.Write(make([]byte, macSize)); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(k.iv); err != nil {
+		return nil, err
+	}
+	mac.Write(k.iv)
+
+	out := io.MultiWriter(dst, mac)
+	buf := make([]byte, 64*1024)
+	var pending []byte
+	for {
+		n, err := io.ReadFull(src, buf)
+		pending = append(pending, buf[:n]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Carry any trailing partial block over to the next read.
+		full := len(pending) - len(pending)%aes.BlockSize
+		mode.CryptBlocks(pending[:full], pending[:full])
+		if _, err := out.Write(pending[:full]); err != nil {
+			return nil, err
+		}
+		pending = append(pending[:0], pending[full:]...)
+	}
+
+	pad := aes.BlockSize - len(pending)%aes.BlockSize
+	pending = append(pending, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	mode.CryptBlocks(pending, pending)
+	if _, err := out.Write(pending); err != nil {
+		return nil, err
+	}
+
+	sum := mac.Sum(nil)
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(sum); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// decrypt checks the HMAC of the content file in src and writes the
+// plaintext to dst. src is read twice, so it has to be seekable.
+func decrypt(dst io.Writer, src io.ReadSeeker, encryptionKey, macKey []byte) error {
+	header := make([]byte, macSize+aes.BlockSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return fmt.Errorf("content file too short")
+	}
+	storedMac, iv := header[:macSize], header[macSize:]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	if _, err := io.Copy(mac, src); err != nil {
+		return err
+	}
+	if !hmac.Equal(mac.Sum(nil), storedMac) {
+		return fmt.Errorf("content HMAC does not match, package is corrupt or tampered with")
+	}
+
+	if _, err := src.Seek(int64(len(header)), io.SeekStart); err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return fmt.Errorf("invalid encryption key: %v", err)
+	}
+	mode := cipher.NewCBCDecrypter(block, iv)
+
+	buf := make([]byte, 64*1024)
+	var pending []byte
+	for {
+		n, err := io.ReadFull(src, buf)
+		pending = append(pending, buf[:n]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Hold back the final block until we know where the padding is.
+		full := len(pending) - len(pending)%aes.BlockSize - aes.BlockSize
+		if full <= 0 {
+			continue
+		}
+		mode.CryptBlocks(pending[:full], pending[:full])
+		if _, err := dst.Write(pending[:full]); err != nil {
+			return err
+		}
+		pending = append(pending[:0], pending[full:]...)
+	}
+
+	if len(pending) == 0 || len(pending)%aes.BlockSize != 0 {
+		return fmt.Errorf("ciphertext is not a multiple of the block size")
+	}
+	mode.CryptBlocks(pending, pending)
+	pad := int(pending[len(pending)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(pending[len(pending)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return fmt.Errorf("invalid padding, wrong encryption key?")
+	}
+	_, err = dst.Write(pending[:len(pending)-pad])
+	return err
+}
+
+// digestWriter hashes everything written through it.
+type digestWriter struct {
+	w    io.Writer
+	h    hash.Hash
+	size int64
+}
+
+func newDigestWriter(w io.Writer) *digestWriter {
+	return &digestWriter{w: w, h: sha256.New()}
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.h.Write(p[:n])
+	d.size += int64(n)
+	return n, err
+}
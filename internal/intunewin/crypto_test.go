@@ -0,0 +1,117 @@
+package intunewin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encryptBytes runs encrypt over data and returns the content file.
+func encryptBytes(t *testing.T, data []byte, k *keys) []byte {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mac, err := encrypt(f, bytes.NewReader(data), k)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content[:macSize], mac) {
+		t.Errorf("content starts with %x, want the HMAC %x", content[:macSize], mac)
+	}
+	return content
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	// Empty, short of a block, exactly a block, and several read buffers
+	// with a partial block carried between them.
+	for _, size := range []int{0, 15, 16, 3*64*1024 + 5} {
+		data := make([]byte, size)
+		rand.Read(data)
+		k, err := newKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content := encryptBytes(t, data, k)
+		if want := macSize + aes.BlockSize + (size/aes.BlockSize+1)*aes.BlockSize; len(content) != want {
+			t.Errorf("%d bytes: content file is %d bytes, want %d", size, len(content), want)
+		}
+		if !bytes.Equal(content[macSize:macSize+aes.BlockSize], k.iv) {
+			t.Errorf("%d bytes: content does not carry the IV after the HMAC", size)
+		}
+
+		var out bytes.Buffer
+		if err := decrypt(&out, bytes.NewReader(content), k.encryptionKey, k.macKey); err != nil {
+			t.Fatalf("%d bytes: decrypt: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("%d bytes: decrypt returned %d different bytes", size, out.Len())
+		}
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	k, err := newKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := encryptBytes(t, []byte("setup.exe and friends"), k)
+
+	// seal encrypts a block as is, without adding padding, and returns a
+	// content file with a valid HMAC.
+	seal := func(plain []byte) []byte {
+		block, _ := aes.NewCipher(k.encryptionKey)
+		ciphertext := make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, k.iv).CryptBlocks(ciphertext, plain)
+		mac := hmac.New(sha256.New, k.macKey)
+		mac.Write(k.iv)
+		mac.Write(ciphertext)
+		return append(append(mac.Sum(nil), k.iv...), ciphertext...)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		macKey  []byte
+	}{
+		{"ciphertext changed", flip(content, len(content)-1), k.macKey},
+		{"IV changed", flip(content, macSize), k.macKey},
+		{"HMAC changed", flip(content, 0), k.macKey},
+		{"wrong MAC key", content, make([]byte, keySize)},
+		{"truncated", content[:macSize+aes.BlockSize+3], k.macKey},
+		{"no ciphertext", content[:macSize+aes.BlockSize], k.macKey},
+		{"too short", content[:macSize], k.macKey},
+		{"zero padding", seal(append(make([]byte, 15), 0)), k.macKey},
+		{"padding longer than a block", seal(append(make([]byte, 15), 17)), k.macKey},
+		// Only the last byte looks like padding of four.
+		{"inconsistent padding", seal(append(make([]byte, 12), 1, 2, 3, 4)), k.macKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := decrypt(io.Discard, bytes.NewReader(tt.content), k.encryptionKey, tt.macKey); err == nil {
+				t.Error("decrypt succeeded")
+			}
+		})
+	}
+}
+
+// flip returns a copy of b with the byte at i changed.
+func flip(b []byte, i int) []byte {
+	b = bytes.Clone(b)
+	b[i] ^= 0x01
+	return b
+}
@@ -0,0 +1,59 @@
+package intunewin
+
+import "encoding/xml"
+
+// toolVersion is the Win32 Content Prep Tool release whose Detection.xml
+// layout we reproduce. Intune only uses it for display.
+const toolVersion = "1.8.6.0"
+
+const (
+	contentsDir   = "IntuneWinPackage/Contents"
+	metadataDir   = "IntuneWinPackage/Metadata"
+	detectionFile = metadataDir + "/Detection.xml"
+	innerFileName = "IntunePackage.intunewin"
+)
+
+// ApplicationInfo is the root element of Detection.xml.
+type ApplicationInfo struct {
+	XMLName                xml.Name       `xml:"ApplicationInfo"`
+	XmlnsXsd               string         `xml:"xmlns:xsd,attr,omitempty"`
+	XmlnsXsi               string         `xml:"xmlns:xsi,attr,omitempty"`
+	ToolVersion            string         `xml:"ToolVersion,attr"`
+	Name                   string         `xml:"Name"`
+	UnencryptedContentSize int64          `xml:"UnencryptedContentSize"`
+	FileName               string         `xml:"FileName"`
+	SetupFile              string         `xml:"SetupFile"`
+	EncryptionInfo         EncryptionInfo `xml:"EncryptionInfo"`
+	MsiInfo                *MsiInfo       `xml:"MsiInfo,omitempty"`
+}
+
+// EncryptionInfo holds the base64 encoded key material needed to decrypt
+// the inner content file.
+type EncryptionInfo struct {
+	EncryptionKey        string `xml:"EncryptionKey"`
+	MacKey               string `xml:"MacKey"`
+	InitializationVector string `xml:"InitializationVector"`
+	Mac                  string `xml:"Mac"`
+	ProfileIdentifier    string `xml:"ProfileIdentifier"`
+	FileDigest           string `xml:"FileDigest"`
+	FileDigestAlgorithm  string `xml:"FileDigestAlgorithm"`
+}
+
+// MsiInfo lets Intune prefill the detection rule when the setup file is an
+// MSI.
+type MsiInfo struct {
+	MsiProductCode                string `xml:"MsiProductCode"`
+	MsiProductVersion             string `xml:"MsiProductVersion"`
+	MsiPackageCode                string `xml:"MsiPackageCode,omitempty"`
+	MsiUpgradeCode                string `xml:"MsiUpgradeCode,omitempty"`
+	MsiExecutionContext           string `xml:"MsiExecutionContext"`
+	MsiRequiresLogon              bool   `xml:"MsiRequiresLogon"`
+	MsiRequiresReboot             bool   `xml:"MsiRequiresReboot"`
+	MsiIsMachineInstall           bool   `xml:"MsiIsMachineInstall"`
+	MsiIsUserInstall              bool   `xml:"MsiIsUserInstall"`
+	MsiIncludesServices           bool   `xml:"MsiIncludesServices"`
+	MsiIncludesODBCDataSource     bool   `xml:"MsiIncludesODBCDataSource"`
+	MsiContainsSystemRegistryKeys bool   `xml:"MsiContainsSystemRegistryKeys"`
+	MsiContainsSystemFolders      bool   `xml:"MsiContainsSystemFolders"`
+	MsiPublisher                  string `xml:"MsiPublisher,omitempty"`
+}
@@ -0,0 +1,223 @@
+package intunewin
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Package is an existing .intunewin file opened for inspection.
+type Package struct {
+	Path string
+	Info ApplicationInfo
+
+	zr      *zip.ReadCloser
+	content *zip.File
+}
+
+// Open reads the outer container and parses its Detection.xml.
+func Open(path string) (*Package, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %v", err)
+	}
+
+	p := &Package{Path: path, zr: zr}
+
+	var detection *zip.File
+	for _, f := range zr.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		switch {
+		case strings.EqualFold(name, detectionFile):
+			detection = f
+		case strings.HasPrefix(strings.ToLower(name), strings.ToLower(contentsDir)+"/") && !f.FileInfo().IsDir():
+			p.content = f
+		}
+	}
+	if detection == nil {
+		zr.Close()
+		return nil, fmt.Errorf("package has no Detection.xml")
+	}
+
+	rc, err := detection.Open()
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("failed to read Detection.xml: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("failed to read Detection.xml: %v", err)
+	}
+
+	// Detection.xml written by IntuneWinAppUtil.exe starts with a BOM.
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if err := xml.Unmarshal(data, &p.Info); err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("failed to parse Detection.xml: %v", err)
+	}
+
+	if p.Info.FileName != "" {
+		for _, f := range zr.File {
+			if strings.EqualFold(strings.ReplaceAll(f.Name, "\\", "/"), contentsDir+"/"+p.Info.FileName) {
+				p.content = f
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// Close releases the underlying file.
+func (p *Package) Close() error {
+	return p.zr.Close()
+}
+
+// EncryptedSize is the size of the encrypted content file.
+func (p *Package) EncryptedSize() int64 {
+	if p.content == nil {
+		return 0
+	}
+	return int64(p.content.UncompressedSize64)
+}
+
+// Decrypt verifies the HMAC and file digest of the content and writes the
+// decrypted inner zip to w.
+func (p *Package) Decrypt(w io.Writer) error {
+	if p.content == nil {
+		return fmt.Errorf("package has no content file")
+	}
+
+	enc := p.Info.EncryptionInfo
+	key, err := base64.StdEncoding.DecodeString(enc.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("invalid encryption key: %v", err)
+	}
+	macKey, err := base64.StdEncoding.DecodeString(enc.MacKey)
+	if err != nil {
+		return fmt.Errorf("invalid MAC key: %v", err)
+	}
+	digest, err := base64.StdEncoding.DecodeString(enc.FileDigest)
+	if err != nil {
+		return fmt.Errorf("invalid file digest: %v", err)
+	}
+
+	// The content has to be read twice (MAC, then decrypt), so spool it to
+	// disk first.
+	tmp, err := os.CreateTemp("", "nexus-encrypted-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	rc, err := p.content.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read content: %v", err)
+	}
+	_, err = io.Copy(tmp, rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read content: %v", err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if err := decrypt(io.MultiWriter(w, hash), tmp, key, macKey); err != nil {
+		return err
+	}
+
+	if enc.FileDigest != "" && !bytes.Equal(hash.Sum(nil), digest) {
+		return fmt.Errorf("decrypted content does not match the file digest")
+	}
+	return nil
+}
+
+// Extract decrypts the content and unzips it into dir.
+func (p *Package) Extract(dir string) ([]string, error) {
+	tmp, err := os.CreateTemp("", "nexus-content-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := p.Decrypt(tmp); err != nil {
+		return nil, err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("decrypted content is not a zip file: %v", err)
+	}
+
+	return unzip(zr, dir)
+}
+
+func unzip(zr *zip.Reader, dir string) ([]string, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", root, err)
+	}
+
+	var files []string
+	for _, f := range zr.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		target := filepath.Join(root, filepath.FromSlash(name))
+		if target != root && !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+			return nil, fmt.Errorf("refusing to extract %s outside of %s", f.Name, root)
+		}
+
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := extractFile(f, target); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %v", f.Name, err)
+		}
+		files = append(files, name)
+	}
+
+	return files, nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
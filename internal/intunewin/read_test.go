@@ -0,0 +1,189 @@
+package intunewin
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// zipFiles returns a zip file of the given names and contents.
+func zipFiles(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: files[i], Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, files[i+1])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestPackage encrypts inner into a .intunewin file the way Build does,
+// letting tamper change the content file or Detection.xml before it is
+// written.
+func writeTestPackage(t *testing.T, inner []byte, tamper func(content []byte, info *ApplicationInfo)) string {
+	t.Helper()
+	k, err := newKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := encryptBytes(t, inner, k)
+
+	b64 := base64.StdEncoding.EncodeToString
+	digest := sha256.Sum256(inner)
+	info := ApplicationInfo{
+		ToolVersion:            toolVersion,
+		Name:                   "setup.exe",
+		UnencryptedContentSize: int64(len(inner)),
+		FileName:               innerFileName,
+		SetupFile:              "setup.exe",
+		EncryptionInfo: EncryptionInfo{
+			EncryptionKey:        b64(k.encryptionKey),
+			MacKey:               b64(k.macKey),
+			InitializationVector: b64(k.iv),
+			Mac:                  b64(content[:macSize]),
+			ProfileIdentifier:    "ProfileVersion1",
+			FileDigest:           b64(digest[:]),
+			FileDigestAlgorithm:  "SHA256",
+		},
+	}
+	if tamper != nil {
+		tamper(content, &info)
+	}
+
+	path := filepath.Join(t.TempDir(), "setup.intunewin")
+	if err := writePackage(path, bytes.NewReader(content), &info); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOpenExtract(t *testing.T) {
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "setup.exe"), []byte("MZ"), 0644)
+	os.MkdirAll(filepath.Join(src, "files"), 0755)
+	os.WriteFile(filepath.Join(src, "files", "config.ini"), []byte("[setup]\n"), 0644)
+	path, err := Build(Options{SourceDir: src, SetupFile: "setup.exe", OutputDir: t.TempDir(), Name: "Example"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	p, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer p.Close()
+	if p.Info.Name != "Example" || p.Info.SetupFile != "setup.exe" {
+		t.Errorf("Name, SetupFile = %q, %q", p.Info.Name, p.Info.SetupFile)
+	}
+	if p.EncryptedSize() == 0 {
+		t.Error("EncryptedSize = 0")
+	}
+
+	dir := filepath.Join(t.TempDir(), "out")
+	files, err := p.Extract(dir)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	slices.Sort(files)
+	if !slices.Equal(files, []string{"files/config.ini", "setup.exe"}) {
+		t.Errorf("Extract = %q", files)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "files", "config.ini")); string(data) != "[setup]\n" {
+		t.Errorf("files/config.ini holds %q", data)
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	inner := zipFiles(t, "setup.exe", "MZ")
+	tests := []struct {
+		name   string
+		tamper func(content []byte, info *ApplicationInfo)
+	}{
+		{"ciphertext", func(content []byte, _ *ApplicationInfo) {
+			content[len(content)-1] ^= 0x01
+		}},
+		{"HMAC", func(content []byte, _ *ApplicationInfo) {
+			content[0] ^= 0x01
+		}},
+		{"IV", func(content []byte, _ *ApplicationInfo) {
+			content[macSize] ^= 0x01
+		}},
+		{"MAC key", func(_ []byte, info *ApplicationInfo) {
+			info.EncryptionInfo.MacKey = base64.StdEncoding.EncodeToString(make([]byte, keySize))
+		}},
+		{"encryption key", func(_ []byte, info *ApplicationInfo) {
+			info.EncryptionInfo.EncryptionKey = base64.StdEncoding.EncodeToString(make([]byte, keySize))
+		}},
+		{"file digest", func(_ []byte, info *ApplicationInfo) {
+			info.EncryptionInfo.FileDigest = base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Open(writeTestPackage(t, inner, tt.tamper))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer p.Close()
+			dir := t.TempDir()
+			if _, err := p.Extract(dir); err == nil {
+				t.Fatal("Extract succeeded")
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("Extract wrote %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestExtractStaysInside(t *testing.T) {
+	for _, name := range []string{
+		"../evil.txt",
+		"files/../../evil.txt",
+		`..\evil.txt`,
+		`files\..\..\evil.txt`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := Open(writeTestPackage(t, zipFiles(t, "setup.exe", "MZ", name, "pwned"), nil))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer p.Close()
+
+			parent := t.TempDir()
+			if _, err := p.Extract(filepath.Join(parent, "out")); err == nil {
+				t.Error("Extract succeeded")
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.txt")); err == nil {
+				t.Error("Extract wrote outside of its folder")
+			}
+		})
+	}
+
+	// An absolute name is taken relative to the folder.
+	p, err := Open(writeTestPackage(t, zipFiles(t, "/tmp/evil.txt", "pwned"), nil))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer p.Close()
+	dir := t.TempDir()
+	if _, err := p.Extract(dir); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "tmp", "evil.txt")); string(data) != "pwned" {
+		t.Errorf("tmp/evil.txt holds %q", data)
+	}
+}
@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"nexus/internal/checksum"
+)
+
+// FileName is the name of the manifest in a package directory.
+const FileName = "nexus.json"
+
+// Manifest is what Nexus knows about a package. It is written when the
+// package is created and updated on every build, so the package can be
+// rebuilt and described without re-deriving anything from its files.
+type Manifest struct {
+	DisplayName   string   `json:"display_name"`
+	Source        string   `json:"source"`
+	SHA256        string   `json:"sha256,omitempty"`
+	SHA512        string   `json:"sha512,omitempty"`
+	Checksum      string   `json:"checksum,omitempty"`
+	InstallerType string   `json:"installer_type"`
+	InstallerFile string   `json:"installer_file"`
+	Version       string   `json:"version,omitempty"`
+	Publisher     string   `json:"publisher,omitempty"`
+	ProductCode   string   `json:"product_code,omitempty"`
+	UpgradeCode   string   `json:"upgrade_code,omitempty"`
+	InstallArgs   string   `json:"install_args,omitempty"`
+	UninstallArgs string   `json:"uninstall_args,omitempty"`
+	Attachments   []string `json:"attachments,omitempty"`
+
+	Signature *Signature `json:"signature,omitempty"`
+
+	Build   int       `json:"build"`
+	Created time.Time `json:"created"`
+	Built   time.Time `json:"built"`
+}
+
+// Signature is what the Authenticode signature check of the installer found
+// when the package was last built.
+type Signature struct {
+	Status    string    `json:"status"`
+	Problem   string    `json:"problem,omitempty"`
+	Signer    string    `json:"signer,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// Path returns the location of the manifest in a package directory.
+func Path(dir string) string {
+	return filepath.Join(dir, FileName)
+}
+
+// Exists reports whether the package directory has a manifest.
+func Exists(dir string) bool {
+	_, err := os.Stat(Path(dir))
+	return err == nil
+}
+
+// Read loads the manifest of the package in dir.
+func Read(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(Path(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", Path(dir), err)
+	}
+	return &m, nil
+}
+
+// Write saves the manifest into the package directory.
+func (m *Manifest) Write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(Path(dir), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", FileName, err)
+	}
+	return nil
+}
+
+// HashFile returns the hex SHA-256 of the file at path.
+func HashFile(path string) (string, error) {
+	return checksum.File(path, checksum.SHA256)
+}
@@ -0,0 +1,318 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+)
+
+// MSI databases are stored in an OLE compound file (MS-CFB): a small FAT
+// file system with a single root storage holding every table as a stream.
+
+const (
+	sectorEndOfChain = 0xFFFFFFFE
+	noStream         = 0xFFFFFFFF
+
+	entryStorage = 1
+	entryStream  = 2
+	entryRoot    = 5
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+type dirEntry struct {
+	name      string
+	rawName   []byte
+	kind      byte
+	left      uint32
+	right     uint32
+	child     uint32
+	clsid     [16]byte
+	stateBits [4]byte
+	created   [8]byte
+	modified  [8]byte
+	start     uint32
+	size      uint64
+}
+
+type compoundFile struct {
+	r              io.ReaderAt
+	sectorSize     int
+	numSectors     uint32
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFat        []uint32
+	entries        []dirEntry
+	miniStream     []byte
+	streams        map[string]int
+}
+
+func openCompoundFile(f *os.File) (*compoundFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return parseCompoundFile(f, info.Size())
+}
+
+// parseCompoundFile reads the compound file r of size bytes. Every count
+// and sector number in it is checked against the size, so a damaged file
+// fails instead of making the reader loop or allocate without bound.
+func parseCompoundFile(r io.ReaderAt, size int64) (*compoundFile, error) {
+	header := make([]byte, 512)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	if !bytes.Equal(header[:8], cfbSignature) {
+		return nil, fmt.Errorf("not an OLE compound file")
+	}
+
+	le := binary.LittleEndian
+	sectorShift := le.Uint16(header[0x1E:])
+	miniShift := le.Uint16(header[0x20:])
+	if sectorShift != 9 && sectorShift != 12 {
+		return nil, fmt.Errorf("unsupported sector size 2^%d", sectorShift)
+	}
+
+	cf := &compoundFile{
+		r:              r,
+		sectorSize:     1 << sectorShift,
+		miniSectorSize: 1 << miniShift,
+		miniCutoff:     uint64(le.Uint32(header[0x38:])),
+		streams:        make(map[string]int),
+	}
+	// The header takes up the first sector.
+	if sectors := size/int64(cf.sectorSize) - 1; sectors > 0 {
+		cf.numSectors = uint32(min(sectors, sectorEndOfChain))
+	}
+
+	numFatSectors := min(le.Uint32(header[0x2C:]), cf.numSectors)
+	firstDirSector := le.Uint32(header[0x30:])
+	firstMiniFatSector := le.Uint32(header[0x3C:])
+	firstDifatSector := le.Uint32(header[0x44:])
+	numDifatSectors := min(le.Uint32(header[0x48:]), cf.numSectors)
+
+	// The first 109 FAT sector locations live in the header, the rest in a
+	// chain of DIFAT sectors.
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		fatSectors = append(fatSectors, le.Uint32(header[0x4C+i*4:]))
+	}
+	sector := firstDifatSector
+	seen := make(map[uint32]bool)
+	for i := uint32(0); i < numDifatSectors && sector < sectorEndOfChain; i++ {
+		if seen[sector] {
+			return nil, fmt.Errorf("corrupt DIFAT chain at %d", sector)
+		}
+		seen[sector] = true
+		buf, err := cf.readSector(sector)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DIFAT: %v", err)
+		}
+		perSector := cf.sectorSize/4 - 1
+		for j := 0; j < perSector; j++ {
+			fatSectors = append(fatSectors, le.Uint32(buf[j*4:]))
+		}
+		sector = le.Uint32(buf[perSector*4:])
+	}
+	if uint32(len(fatSectors)) > numFatSectors {
+		fatSectors = fatSectors[:numFatSectors]
+	}
+
+	for _, s := range fatSectors {
+		if s >= sectorEndOfChain {
+			continue
+		}
+		buf, err := cf.readSector(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FAT: %v", err)
+		}
+		for j := 0; j < cf.sectorSize; j += 4 {
+			cf.fat = append(cf.fat, le.Uint32(buf[j:]))
+		}
+	}
+
+	dir, err := cf.readChain(firstDirSector, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %v", err)
+	}
+	for off := 0; off+128 <= len(dir); off += 128 {
+		e := parseDirEntry(dir[off : off+128])
+		if cf.sectorSize == 512 {
+			// Version 3 files only define the low 32 bits of the size.
+			e.size &= 0xFFFFFFFF
+		}
+		cf.entries = append(cf.entries, e)
+	}
+	if len(cf.entries) == 0 || cf.entries[0].kind != entryRoot {
+		return nil, fmt.Errorf("missing root storage")
+	}
+
+	if firstMiniFatSector < sectorEndOfChain {
+		buf, err := cf.readChain(firstMiniFatSector, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini FAT: %v", err)
+		}
+		for j := 0; j+4 <= len(buf); j += 4 {
+			cf.miniFat = append(cf.miniFat, le.Uint32(buf[j:]))
+		}
+	}
+
+	root := cf.entries[0]
+	if root.start < sectorEndOfChain && root.size > 0 {
+		cf.miniStream, err = cf.readChain(root.start, root.size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mini stream: %v", err)
+		}
+	}
+
+	cf.indexStreams(root.child, 0)
+	return cf, nil
+}
+
+func parseDirEntry(b []byte) dirEntry {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(b[0x40:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	var name []uint16
+	for i := 0; i+1 < nameLen; i += 2 {
+		c := le.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	e := dirEntry{
+		name:    string(utf16.Decode(name)),
+		rawName: append([]byte(nil), b[:nameLen]...),
+		kind:    b[0x42],
+		left:    le.Uint32(b[0x44:]),
+		right:   le.Uint32(b[0x48:]),
+		child:   le.Uint32(b[0x4C:]),
+		start:   le.Uint32(b[0x74:]),
+		size:    le.Uint64(b[0x78:]),
+	}
+	copy(e.clsid[:], b[0x50:0x60])
+	copy(e.stateBits[:], b[0x60:0x64])
+	copy(e.created[:], b[0x64:0x6C])
+	copy(e.modified[:], b[0x6C:0x74])
+	return e
+}
+
+// indexStreams walks the red-black tree of the root storage's children.
+// MSI databases never nest storages for their own data, so only the
+// streams directly below the root are indexed.
+func (cf *compoundFile) indexStreams(id uint32, depth int) {
+	if id == noStream || int(id) >= len(cf.entries) || depth > len(cf.entries) {
+		return
+	}
+	e := cf.entries[id]
+	if e.kind == entryStream || e.kind == entryStorage {
+		cf.streams[e.name] = int(id)
+	}
+	cf.indexStreams(e.left, depth+1)
+	cf.indexStreams(e.right, depth+1)
+}
+
+func (cf *compoundFile) readSector(sector uint32) ([]byte, error) {
+	if sector >= cf.numSectors {
+		return nil, fmt.Errorf("sector %d is past the end of the file", sector)
+	}
+	buf := make([]byte, cf.sectorSize)
+	off := int64(sector+1) * int64(cf.sectorSize)
+	if _, err := cf.r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readChain follows a FAT chain. A size of zero reads the whole chain.
+func (cf *compoundFile) readChain(start uint32, size uint64) ([]byte, error) {
+	var out []byte
+	seen := make(map[uint32]bool)
+	for sector := start; sector < sectorEndOfChain; {
+		if seen[sector] || int(sector) >= len(cf.fat) {
+			return nil, fmt.Errorf("corrupt sector chain at %d", sector)
+		}
+		seen[sector] = true
+		buf, err := cf.readSector(sector)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf...)
+		if size > 0 && uint64(len(out)) >= size {
+			break
+		}
+		sector = cf.fat[sector]
+	}
+	if size > 0 {
+		if uint64(len(out)) < size {
+			return nil, fmt.Errorf("stream truncated")
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+func (cf *compoundFile) readMiniChain(start uint32, size uint64) ([]byte, error) {
+	if size > uint64(len(cf.miniStream)) {
+		return nil, fmt.Errorf("stream truncated")
+	}
+	out := make([]byte, 0, size)
+	seen := make(map[uint32]bool)
+	for sector := start; sector < sectorEndOfChain && uint64(len(out)) < size; {
+		if seen[sector] || int(sector) >= len(cf.miniFat) {
+			return nil, fmt.Errorf("corrupt mini sector chain at %d", sector)
+		}
+		seen[sector] = true
+		off := int(sector) * cf.miniSectorSize
+		end := off + cf.miniSectorSize
+		if end > len(cf.miniStream) {
+			return nil, fmt.Errorf("mini sector %d out of range", sector)
+		}
+		out = append(out, cf.miniStream[off:end]...)
+		sector = cf.miniFat[sector]
+	}
+	if uint64(len(out)) < size {
+		return nil, fmt.Errorf("stream truncated")
+	}
+	return out[:size], nil
+}
+
+// hasStream reports whether a stream with the given raw name exists.
+func (cf *compoundFile) hasStream(name string) bool {
+	_, ok := cf.streams[name]
+	return ok
+}
+
+// readStream returns the contents of a stream below the root storage,
+// looked up by its raw (already encoded) name.
+func (cf *compoundFile) readStream(name string) ([]byte, error) {
+	id, ok := cf.streams[name]
+	if !ok {
+		return nil, fmt.Errorf("stream not found")
+	}
+	return cf.readEntry(id)
+}
+
+// readEntry returns the contents of the stream with the given directory
+// entry ID.
+func (cf *compoundFile) readEntry(id int) ([]byte, error) {
+	e := cf.entries[id]
+	if e.kind != entryStream {
+		return nil, fmt.Errorf("not a stream")
+	}
+	if e.size == 0 {
+		return nil, nil
+	}
+	if e.size < cf.miniCutoff {
+		return cf.readMiniChain(e.start, e.size)
+	}
+	return cf.readChain(e.start, e.size)
+}
@@ -0,0 +1,74 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCompoundFileDamaged(t *testing.T) {
+	product, err := os.ReadFile(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+
+	tests := []struct {
+		name   string
+		damage func(b []byte) []byte
+	}{
+		{"self-looping DIFAT", func(b []byte) []byte {
+			// A DIFAT chain that starts at sector 0 and points back at it,
+			// in a file cut short, with counts up to 2^32.
+			le.PutUint32(b[0x2C:], 0xFFFFFFFF)
+			le.PutUint32(b[0x44:], 0)
+			le.PutUint32(b[0x48:], 0xFFFFFFFF)
+			le.PutUint32(b[512+508:], 0)
+			return b[:2560]
+		}},
+		{"DIFAT past the end", func(b []byte) []byte {
+			le.PutUint32(b[0x44:], 1000)
+			le.PutUint32(b[0x48:], 1)
+			return b
+		}},
+		{"truncated", func(b []byte) []byte {
+			return b[:1024]
+		}},
+		{"header only", func(b []byte) []byte {
+			return b[:512]
+		}},
+		{"huge mini stream", func(b []byte) []byte {
+			// The size of the root entry, the first in the directory.
+			dir := 512 * (1 + int(le.Uint32(b[0x30:])))
+			le.PutUint32(b[dir+0x78:], 0xFFFFFFF0)
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.damage(bytes.Clone(product))
+			if _, err := parseCompoundFile(bytes.NewReader(b), int64(len(b))); err == nil {
+				t.Error("parseCompoundFile succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestParseCompoundFileStreams(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := parseCompoundFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("parseCompoundFile: %v", err)
+	}
+	if !cf.hasStream("\x05SummaryInformation") {
+		t.Errorf("summary information stream not found")
+	}
+	if cf.hasStream("missing") {
+		t.Errorf("hasStream(missing) = true")
+	}
+}
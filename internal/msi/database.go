@@ -0,0 +1,307 @@
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column type bits as stored in the _Columns table.
+const (
+	colWidthMask = 0x00FF
+	colValid     = 0x0100
+	colString    = 0x0800
+	colNullable  = 0x1000
+	colKey       = 0x2000
+)
+
+// Column describes one column of an MSI table.
+type Column struct {
+	Name string
+	Type uint16
+}
+
+// IsString reports whether the column holds string values.
+func (c Column) IsString() bool {
+	return c.Type&colString != 0 && !c.IsBinary()
+}
+
+// IsBinary reports whether the column references a binary stream.
+func (c Column) IsBinary() bool {
+	return c.Type&^colNullable == colString|colValid
+}
+
+// IsKey reports whether the column is part of the table's primary key.
+func (c Column) IsKey() bool {
+	return c.Type&colKey != 0
+}
+
+// IsNullable reports whether the column accepts null values.
+func (c Column) IsNullable() bool {
+	return c.Type&colNullable != 0
+}
+
+// Table is a fully loaded MSI table. Row values are string for string
+// columns, int for integer columns, the stream name for binary columns and
+// nil for null fields.
+type Table struct {
+	Name    string
+	Columns []Column
+	Rows    [][]any
+}
+
+// Database is a read-only MSI database backed by its compound file.
+type Database struct {
+	file    *os.File
+	cf      *compoundFile
+	strings *stringPool
+	schema  map[string][]Column
+	tables  []string
+}
+
+// Open parses the MSI database at path without relying on msi.dll.
+func Open(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := openCompoundFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	db := &Database{file: f, cf: cf}
+	if err := db.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Close releases the underlying file.
+func (db *Database) Close() error {
+	return db.file.Close()
+}
+
+func (db *Database) load() error {
+	pool, err := db.cf.readStream(encodeStreamName("_StringPool", true))
+	if err != nil {
+		return fmt.Errorf("failed to read string pool: %v", err)
+	}
+	data, err := db.cf.readStream(encodeStreamName("_StringData", true))
+	if err != nil {
+		return fmt.Errorf("failed to read string data: %v", err)
+	}
+	if db.strings, err = loadStringPool(pool, data); err != nil {
+		return fmt.Errorf("failed to parse string pool: %v", err)
+	}
+
+	ref := uint16(colString | colValid | db.strings.refSize())
+	i16 := uint16(colValid | 2)
+
+	tables, err := db.readTable("_Tables", []Column{{Name: "Name", Type: ref | colKey}})
+	if err != nil {
+		return fmt.Errorf("failed to read _Tables: %v", err)
+	}
+	for _, row := range tables.Rows {
+		if name, ok := row[0].(string); ok {
+			db.tables = append(db.tables, name)
+		}
+	}
+
+	columns, err := db.readTable("_Columns", []Column{
+		{Name: "Table", Type: ref | colKey},
+		{Name: "Number", Type: i16 | colKey},
+		{Name: "Name", Type: ref},
+		{Name: "Type", Type: i16},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read _Columns: %v", err)
+	}
+
+	type numbered struct {
+		number int
+		col    Column
+	}
+	byTable := make(map[string][]numbered)
+	for _, row := range columns.Rows {
+		table, _ := row[0].(string)
+		number, _ := row[1].(int)
+		name, _ := row[2].(string)
+		typ, _ := row[3].(int)
+		byTable[table] = append(byTable[table], numbered{number, Column{Name: name, Type: uint16(typ)}})
+	}
+
+	db.schema = make(map[string][]Column)
+	for table, cols := range byTable {
+		sort.Slice(cols, func(i, j int) bool { return cols[i].number < cols[j].number })
+		for _, c := range cols {
+			db.schema[table] = append(db.schema[table], c.col)
+		}
+	}
+
+	return nil
+}
+
+// Tables returns the names of all tables in the database.
+func (db *Database) Tables() []string {
+	return append([]string(nil), db.tables...)
+}
+
+// Table loads every row of the named table.
+func (db *Database) Table(name string) (*Table, error) {
+	cols, ok := db.schema[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s not found", name)
+	}
+	return db.readTable(name, cols)
+}
+
+// Property returns the value of a row in the Property table.
+func (db *Database) Property(name string) (string, error) {
+	table, err := db.Table("Property")
+	if err != nil {
+		return "", err
+	}
+	for _, row := range table.Rows {
+		if key, _ := row[0].(string); key == name {
+			value, _ := row[1].(string)
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("property %s not found", name)
+}
+
+// Properties returns every row of the Property table.
+func (db *Database) Properties() (map[string]string, error) {
+	table, err := db.Table("Property")
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]string, len(table.Rows))
+	for _, row := range table.Rows {
+		key, _ := row[0].(string)
+		value, _ := row[1].(string)
+		props[key] = value
+	}
+	return props, nil
+}
+
+func (db *Database) columnWidth(c Column) int {
+	if c.IsBinary() {
+		return 2
+	}
+	if c.Type&colString != 0 {
+		return db.strings.refSize()
+	}
+	if c.Type&colWidthMask == 4 {
+		return 4
+	}
+	return 2
+}
+
+// readTable decodes a table stream. Tables are stored column by column:
+// all values of the first column, then all values of the second, and so on.
+func (db *Database) readTable(name string, cols []Column) (*Table, error) {
+	table := &Table{Name: name, Columns: cols}
+
+	raw := encodeStreamName(name, true)
+	if !db.cf.hasStream(raw) {
+		// Empty tables have no stream at all.
+		return table, nil
+	}
+	data, err := db.cf.readStream(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	rowSize := 0
+	widths := make([]int, len(cols))
+	for i, c := range cols {
+		widths[i] = db.columnWidth(c)
+		rowSize += widths[i]
+	}
+	if rowSize == 0 {
+		return table, nil
+	}
+	numRows := len(data) / rowSize
+
+	table.Rows = make([][]any, numRows)
+	for r := range table.Rows {
+		table.Rows[r] = make([]any, len(cols))
+	}
+
+	offset := 0
+	for i, c := range cols {
+		for r := 0; r < numRows; r++ {
+			v := readUint(data[offset+r*widths[i]:], widths[i])
+			switch {
+			case c.IsBinary():
+				table.Rows[r][i] = nil
+			case c.Type&colString != 0:
+				if v == 0 {
+					table.Rows[r][i] = nil
+					continue
+				}
+				s, err := db.strings.get(v)
+				if err != nil {
+					return nil, fmt.Errorf("table %s: %v", name, err)
+				}
+				table.Rows[r][i] = s
+			case v == 0:
+				table.Rows[r][i] = nil
+			case widths[i] == 4:
+				table.Rows[r][i] = int(int32(v ^ 0x80000000))
+			default:
+				table.Rows[r][i] = int(v) - 0x8000
+			}
+		}
+		offset += numRows * widths[i]
+	}
+
+	// Binary columns reference a stream named after the table and the
+	// row's primary key values.
+	for i, c := range cols {
+		if !c.IsBinary() {
+			continue
+		}
+		for _, row := range table.Rows {
+			var keys []string
+			for j, k := range cols {
+				if k.IsKey() {
+					keys = append(keys, formatValue(row[j]))
+				}
+			}
+			row[i] = name + "." + strings.Join(keys, ".")
+		}
+	}
+
+	return table, nil
+}
+
+func readUint(b []byte, width int) uint32 {
+	switch width {
+	case 4:
+		return binary.LittleEndian.Uint32(b)
+	case 3:
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	default:
+		return uint32(binary.LittleEndian.Uint16(b))
+	}
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+package msi
+
+//go:generate go run testdata/gen.go
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestProperty(t *testing.T) {
+	tests := []struct {
+		file           string
+		productCode    string
+		productVersion string
+		productName    string
+		manufacturer   string
+	}{
+		{"minimal.msi", "{6A1C8A2E-3B1F-4C55-9E0B-1D2F3A4B5C6D}", "1.0.0", "Minimal", "Société Générale"},
+		{"product.msi", "{23170F69-40C1-2702-2409-000001000000}", "24.09.00.0", "7-Zip 24.09 (x64 edition)", "Igor Pavlov"},
+		{"large.msi", "{0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0}", "3.14.159", "", ""},
+		{"utf8.msi", "{C0DE65E0-0001-4F8A-B1C2-D3E4F5A6B7C8}", "2.0.1", "Ünïcödé 製品", "Nexus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			db, err := Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+
+			for name, want := range map[string]string{
+				"ProductCode":    tt.productCode,
+				"ProductVersion": tt.productVersion,
+				"ProductName":    tt.productName,
+				"Manufacturer":   tt.manufacturer,
+			} {
+				if got, _ := db.Property(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLargeTable(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "large.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	props, err := db.Table("Property")
+	if err != nil {
+		t.Fatalf("Table: %v", err)
+	}
+	if len(props.Rows) != 402 {
+		t.Errorf("got %d properties, want 402", len(props.Rows))
+	}
+	if got, want := props.Rows[401][1], "value number 399 of the large fixture"; got != want {
+		t.Errorf("last property = %q, want %q", got, want)
+	}
+}
+
+func TestTables(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	file, err := db.Table("File")
+	if err != nil {
+		t.Fatalf("Table: %v", err)
+	}
+	if len(file.Rows) != 2 {
+		t.Fatalf("got %d File rows, want 2", len(file.Rows))
+	}
+	row := file.Rows[1]
+	if row[2] != "7z.dll|7z.dll" || row[3] != 1800000 || row[6] != nil {
+		t.Errorf("File row = %v", row)
+	}
+
+	binary, err := db.Table("Binary")
+	if err != nil {
+		t.Fatalf("Table: %v", err)
+	}
+	if got := binary.Rows[0][1]; got != "Binary.Icon1" {
+		t.Errorf("Binary.Data = %v, want the stream name", got)
+	}
+}
+
+func TestOpenNotMSI(t *testing.T) {
+	if _, err := Open(filepath.Join("testdata", "missing.msi")); err == nil {
+		t.Error("Open of a missing file succeeded")
+	}
+	if _, err := Open("database_test.go"); err == nil {
+		t.Error("Open of a Go source file succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+package msi
+
+import "fmt"
+
+// Identity is everything Nexus needs to know to package, detect and
+// upgrade an MSI product.
+type Identity struct {
+	ProductCode     string
+	ProductVersion  string
+	UpgradeCode     string
+	ProductName     string
+	Manufacturer    string
+	ProductLanguage string
+	PackageCode     string
+	Platform        string
+	Languages       []string
+}
+
+// Identity collects the product identity from the Property table and the
+// summary information stream. ProductCode is the only required value.
+func (db *Database) Identity() (*Identity, error) {
+	props, err := db.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	id := &Identity{
+		ProductCode:     props["ProductCode"],
+		ProductVersion:  props["ProductVersion"],
+		UpgradeCode:     props["UpgradeCode"],
+		ProductName:     props["ProductName"],
+		Manufacturer:    props["Manufacturer"],
+		ProductLanguage: props["ProductLanguage"],
+	}
+	if id.ProductCode == "" {
+		return nil, fmt.Errorf("property ProductCode not found")
+	}
+
+	if summary, err := db.SummaryInfo(); err == nil {
+		id.PackageCode = summary.RevisionNumber
+		id.Platform = summary.Platform()
+		id.Languages = summary.Languages()
+	}
+
+	return id, nil
+}
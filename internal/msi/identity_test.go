@@ -0,0 +1,69 @@
+package msi
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	tests := []struct {
+		file           string
+		productCode    string
+		productVersion string
+		productName    string
+		manufacturer   string
+	}{
+		{"minimal.msi", "{6A1C8A2E-3B1F-4C55-9E0B-1D2F3A4B5C6D}", "1.0.0", "Minimal", "Société Générale"},
+		{"product.msi", "{23170F69-40C1-2702-2409-000001000000}", "24.09.00.0", "7-Zip 24.09 (x64 edition)", "Igor Pavlov"},
+		{"large.msi", "{0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0}", "3.14.159", "", ""},
+		{"utf8.msi", "{C0DE65E0-0001-4F8A-B1C2-D3E4F5A6B7C8}", "2.0.1", "Ünïcödé 製品", "Nexus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			db, err := Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+
+			id, err := db.Identity()
+			if err != nil {
+				t.Fatalf("Identity: %v", err)
+			}
+			if id.ProductCode != tt.productCode {
+				t.Errorf("ProductCode = %q, want %q", id.ProductCode, tt.productCode)
+			}
+			if id.ProductVersion != tt.productVersion {
+				t.Errorf("ProductVersion = %q, want %q", id.ProductVersion, tt.productVersion)
+			}
+			if id.ProductName != tt.productName {
+				t.Errorf("ProductName = %q, want %q", id.ProductName, tt.productName)
+			}
+			if id.Manufacturer != tt.manufacturer {
+				t.Errorf("Manufacturer = %q, want %q", id.Manufacturer, tt.manufacturer)
+			}
+		})
+	}
+}
+
+func TestSummaryInfo(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	id, err := db.Identity()
+	if err != nil {
+		t.Fatalf("Identity: %v", err)
+	}
+	if id.PackageCode != "{AAAAAAAA-BBBB-CCCC-DDDD-EEEEEEEEEEEE}" {
+		t.Errorf("PackageCode = %q", id.PackageCode)
+	}
+	if id.Platform != "x64" {
+		t.Errorf("Platform = %q, want x64", id.Platform)
+	}
+	if len(id.Languages) != 2 || id.Languages[0] != "1033" || id.Languages[1] != "1031" {
+		t.Errorf("Languages = %v, want [1033 1031]", id.Languages)
+	}
+}
@@ -0,0 +1,114 @@
+package msi
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var guidPattern = regexp.MustCompile(`\{[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}`)
+
+// ReadSummaryInfo reads the summary information of any Windows Installer
+// file, including transforms and patches that are not full databases.
+func ReadSummaryInfo(path string) (*SummaryInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cf, err := openCompoundFile(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := cf.readStream(summaryStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary information: %v", err)
+	}
+	return parseSummaryInfo(data)
+}
+
+// PatchInfo describes a .msp patch. In a patch the summary Template lists
+// the target product codes and RevisionNumber starts with the patch code,
+// followed by the codes of the patches it obsoletes.
+type PatchInfo struct {
+	PatchCode          string
+	ObsoletedPatches   []string
+	TargetProductCodes []string
+	Title              string
+	Description        string
+}
+
+// ReadPatchInfo reads the summary information of the .msp patch at path.
+func ReadPatchInfo(path string) (*PatchInfo, error) {
+	summary, err := ReadSummaryInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := guidPattern.FindAllString(summary.RevisionNumber, -1)
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("patch code not found in summary information")
+	}
+
+	return &PatchInfo{
+		PatchCode:          codes[0],
+		ObsoletedPatches:   codes[1:],
+		TargetProductCodes: guidPattern.FindAllString(summary.Template, -1),
+		Title:              summary.Title,
+		Description:        summary.Comments,
+	}, nil
+}
+
+// Targets reports whether the patch applies to the given product code.
+func (p *PatchInfo) Targets(productCode string) bool {
+	for _, code := range p.TargetProductCodes {
+		if strings.EqualFold(code, productCode) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransformInfo describes a .mst transform. Its RevisionNumber holds the
+// product code and version of the base and the transformed database,
+// followed by the upgrade code.
+type TransformInfo struct {
+	TargetProductCode   string
+	TargetVersion       string
+	UpgradedProductCode string
+	UpgradedVersion     string
+	UpgradeCode         string
+	Languages           []string
+}
+
+// ReadTransformInfo reads the summary information of the .mst transform
+// at path.
+func ReadTransformInfo(path string) (*TransformInfo, error) {
+	summary, err := ReadSummaryInfo(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TransformInfo{Languages: summary.Languages()}
+	parts := strings.Split(summary.RevisionNumber, ";")
+	split := func(s string) (string, string) {
+		code := guidPattern.FindString(s)
+		return code, strings.TrimSpace(strings.Replace(s, code, "", 1))
+	}
+	if len(parts) > 0 {
+		info.TargetProductCode, info.TargetVersion = split(parts[0])
+	}
+	if len(parts) > 1 {
+		info.UpgradedProductCode, info.UpgradedVersion = split(parts[1])
+	}
+	if len(parts) > 2 {
+		info.UpgradeCode = guidPattern.FindString(parts[2])
+	}
+	if info.TargetProductCode == "" {
+		return nil, fmt.Errorf("target product code not found in summary information")
+	}
+
+	return info, nil
+}
@@ -0,0 +1,537 @@
+package msi
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query runs a SELECT statement against the database and returns the
+// matching rows as a table holding only the selected columns. It supports
+// the subset of MSI SQL that works on a single table:
+//
+//	SELECT [DISTINCT] {* | column, ...} FROM table
+//	    [WHERE condition] [ORDER BY column, ...]
+//
+// Conditions compare a column to a literal or another column with =, <>,
+// <, >, <= or >=, test it with IS [NOT] NULL, and combine with AND, OR and
+// parentheses. Names may be quoted with backticks, strings with single
+// quotes. As in MSI, an empty string is the same as null.
+func (db *Database) Query(query string) (*Table, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %v", err)
+	}
+
+	table, err := db.Table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(table.Columns))
+	for i, c := range table.Columns {
+		index[c.Name] = i
+	}
+	resolve := func(name string) (int, error) {
+		if table, column, ok := strings.Cut(name, "."); ok {
+			if table != stmt.table {
+				return 0, fmt.Errorf("table %s is not part of the query", table)
+			}
+			name = column
+		}
+		i, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("column %s not found in table %s", name, stmt.table)
+		}
+		return i, nil
+	}
+
+	var selected []int
+	if stmt.columns == nil {
+		for i := range table.Columns {
+			selected = append(selected, i)
+		}
+	}
+	for _, name := range stmt.columns {
+		i, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, i)
+	}
+	if stmt.where != nil {
+		if err := stmt.where.bind(resolve); err != nil {
+			return nil, err
+		}
+	}
+	var order []int
+	for _, name := range stmt.orderBy {
+		i, err := resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		order = append(order, i)
+	}
+
+	var rows [][]any
+	for _, row := range table.Rows {
+		if stmt.where == nil || stmt.where.eval(row) {
+			rows = append(rows, row)
+		}
+	}
+	if len(order) > 0 {
+		sort.SliceStable(rows, func(a, b int) bool {
+			for _, i := range order {
+				if c := compareValues(rows[a][i], rows[b][i]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+
+	result := &Table{Name: table.Name}
+	for _, i := range selected {
+		result.Columns = append(result.Columns, table.Columns[i])
+	}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		out := make([]any, len(selected))
+		for j, i := range selected {
+			out[j] = row[i]
+		}
+		if stmt.distinct {
+			key := fmt.Sprintf("%#v", out)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		result.Rows = append(result.Rows, out)
+	}
+
+	return result, nil
+}
+
+type selectStmt struct {
+	distinct bool
+	columns  []string // nil for *
+	table    string
+	where    *condition
+	orderBy  []string
+}
+
+// condition is a node of a WHERE clause: either an AND/OR of two
+// conditions or a single comparison.
+type condition struct {
+	op          string
+	left, right *condition
+
+	column  string
+	index   int
+	operand any // literal value, or operandColumn
+	other   int
+	notNull bool
+}
+
+type operandColumn string
+
+func (c *condition) bind(resolve func(string) (int, error)) error {
+	if c.left != nil {
+		if err := c.left.bind(resolve); err != nil {
+			return err
+		}
+		return c.right.bind(resolve)
+	}
+	i, err := resolve(c.column)
+	if err != nil {
+		return err
+	}
+	c.index = i
+	if name, ok := c.operand.(operandColumn); ok {
+		if c.other, err = resolve(string(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *condition) eval(row []any) bool {
+	switch c.op {
+	case "AND":
+		return c.left.eval(row) && c.right.eval(row)
+	case "OR":
+		return c.left.eval(row) || c.right.eval(row)
+	case "IS":
+		return isNull(row[c.index]) != c.notNull
+	}
+
+	value := row[c.index]
+	operand := c.operand
+	if _, ok := operand.(operandColumn); ok {
+		operand = row[c.other]
+	}
+	if isNull(value) || isNull(operand) {
+		// Null only equals null.
+		switch c.op {
+		case "=":
+			return isNull(value) && isNull(operand)
+		case "<>":
+			return isNull(value) != isNull(operand)
+		}
+		return false
+	}
+
+	cmp := compareValues(value, operand)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func isNull(v any) bool {
+	return v == nil || v == ""
+}
+
+// compareValues orders nulls first, integers numerically and everything
+// else as strings.
+func compareValues(a, b any) int {
+	if isNull(a) || isNull(b) {
+		switch {
+		case isNull(a) && isNull(b):
+			return 0
+		case isNull(a):
+			return -1
+		}
+		return 1
+	}
+	if x, ok := a.(int); ok {
+		if y, ok := b.(int); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+type tokenKind int
+
+const (
+	tokName tokenKind = iota
+	tokString
+	tokNumber
+	tokSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// keyword reports whether t is the given keyword. Backtick quoted names
+// are never keywords.
+func (t token) keyword(word string) bool {
+	return t.kind == tokName && strings.EqualFold(t.text, word)
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	r := []rune(query)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '`' || c == '\'':
+			end := i + 1
+			for end < len(r) && r[end] != c {
+				end++
+			}
+			if end == len(r) {
+				return nil, fmt.Errorf("unterminated %c at offset %d", c, i)
+			}
+			kind := tokString
+			if c == '`' {
+				// Quoted names are tagged so they are not taken for keywords.
+				kind = tokName
+				tokens = append(tokens, token{kind, "`" + string(r[i+1:end])})
+			} else {
+				tokens = append(tokens, token{kind, string(r[i+1 : end])})
+			}
+			i = end + 1
+		case c == '-' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(r) && unicode.IsDigit(r[end]) {
+				end++
+			}
+			if c == '-' && end == i+1 {
+				return nil, fmt.Errorf("unexpected '-' at offset %d", i)
+			}
+			tokens = append(tokens, token{tokNumber, string(r[i:end])})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(r) && (r[end] == '_' || unicode.IsLetter(r[end]) || unicode.IsDigit(r[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokName, string(r[i:end])})
+			i = end
+		case c == '<' || c == '>':
+			end := i + 1
+			if end < len(r) && (r[end] == '=' || (c == '<' && r[end] == '>')) {
+				end++
+			}
+			tokens = append(tokens, token{tokSymbol, string(r[i:end])})
+			i = end
+		case strings.ContainsRune("*,=().?", c):
+			tokens = append(tokens, token{tokSymbol, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) acceptKeyword(word string) bool {
+	if t, ok := p.peek(); ok && t.keyword(word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptSymbol(symbol string) bool {
+	if t, ok := p.peek(); ok && t.kind == tokSymbol && t.text == symbol {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(word string) error {
+	if !p.acceptKeyword(word) {
+		return p.unexpected(word)
+	}
+	return nil
+}
+
+func (p *parser) unexpected(want string) error {
+	t, ok := p.peek()
+	if !ok {
+		return fmt.Errorf("expected %s, found end of query", want)
+	}
+	return fmt.Errorf("expected %s, found %q", want, strings.TrimPrefix(t.text, "`"))
+}
+
+// name parses a plain or quoted identifier.
+func (p *parser) name() (string, error) {
+	t, ok := p.peek()
+	if !ok || t.kind != tokName {
+		return "", p.unexpected("a name")
+	}
+	p.pos++
+	return strings.TrimPrefix(t.text, "`"), nil
+}
+
+// columnRef parses a column name, optionally qualified by its table.
+func (p *parser) columnRef() (string, error) {
+	name, err := p.name()
+	if err != nil {
+		return "", err
+	}
+	if p.acceptSymbol(".") {
+		column, err := p.name()
+		if err != nil {
+			return "", err
+		}
+		name += "." + column
+	}
+	return name, nil
+}
+
+func (p *parser) parseSelect() (*selectStmt, error) {
+	stmt := &selectStmt{}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt.distinct = p.acceptKeyword("DISTINCT")
+
+	if !p.acceptSymbol("*") {
+		for {
+			column, err := p.columnRef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.columns = append(stmt.columns, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	stmt.table = table
+	if p.acceptSymbol(",") {
+		return nil, fmt.Errorf("joins are not supported")
+	}
+
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			column, err := p.columnRef()
+			if err != nil {
+				return nil, err
+			}
+			stmt.orderBy = append(stmt.orderBy, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if _, ok := p.peek(); ok {
+		return nil, p.unexpected("end of query")
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseOr() (*condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condition{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (*condition, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &condition{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseComparison() (*condition, error) {
+	if p.acceptSymbol("(") {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(")") {
+			return nil, p.unexpected("')'")
+		}
+		return c, nil
+	}
+
+	column, err := p.columnRef()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("IS") {
+		c := &condition{op: "IS", column: column, notNull: p.acceptKeyword("NOT")}
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	t, ok := p.peek()
+	if !ok || t.kind != tokSymbol || !strings.Contains(" = <> < > <= >= ", " "+t.text+" ") {
+		return nil, p.unexpected("a comparison operator")
+	}
+	p.pos++
+	c := &condition{op: t.text, column: column}
+
+	t, ok = p.peek()
+	switch {
+	case !ok:
+		return nil, p.unexpected("a value")
+	case t.kind == tokString:
+		p.pos++
+		c.operand = t.text
+	case t.kind == tokNumber:
+		p.pos++
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", t.text)
+		}
+		c.operand = n
+	case t.kind == tokSymbol && t.text == "?":
+		return nil, fmt.Errorf("query parameters are not supported")
+	case t.keyword("NULL"):
+		p.pos++
+		c.operand = nil
+	default:
+		other, err := p.columnRef()
+		if err != nil {
+			return nil, err
+		}
+		c.operand = operandColumn(other)
+	}
+	return c, nil
+}
@@ -0,0 +1,151 @@
+package msi
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query   string
+		columns string
+		rows    []string
+	}{
+		{"SELECT * FROM File",
+			"File Component_ FileName FileSize Version Language Attributes Sequence",
+			[]string{"f1 c1 7z.exe 543744 24.9.0.0 <nil> 512 1", "f2 c1 7z.dll|7z.dll 1800000 24.9.0.0 1033 <nil> 2"}},
+		{"SELECT `File`, `Sequence` FROM `File`", "File Sequence", []string{"f1 1", "f2 2"}},
+		{"select File.FileName from File where File.File = 'f2'", "FileName", []string{"7z.dll|7z.dll"}},
+
+		// Integers compare as numbers, strings as strings.
+		{"SELECT File FROM File WHERE FileSize > 1000000", "File", []string{"f2"}},
+		{"SELECT File FROM File WHERE FileSize <= 543744", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Sequence <> 1", "File", []string{"f2"}},
+		{"SELECT File FROM File WHERE Sequence >= -1", "File", []string{"f1", "f2"}},
+		{"SELECT File FROM File WHERE FileName < '7z.e'", "File", []string{"f2"}},
+		{"SELECT Property FROM Property WHERE Value = '1033'", "Property", []string{"ProductLanguage"}},
+		{"SELECT File FROM File WHERE Component_ = 'C1'", "File", nil},
+
+		// AND binds tighter than OR.
+		{"SELECT File FROM File WHERE Sequence = 1 AND FileSize > 1000000 OR File = 'f2'", "File", []string{"f2"}},
+		{"SELECT File FROM File WHERE Sequence = 1 AND (FileSize > 1000000 OR File = 'f2')", "File", nil},
+		{"SELECT File FROM File WHERE File = 'f1' OR File = 'f2' AND Sequence = 1", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Sequence = 2 AND Version = '24.9.0.0' AND Component_ = 'c1'", "File", []string{"f2"}},
+
+		// Nulls.
+		{"SELECT File FROM File WHERE Language IS NULL", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Attributes IS NOT NULL", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Language = NULL", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Language = ''", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Language <> '1033'", "File", []string{"f1"}},
+		{"SELECT File FROM File WHERE Attributes < 1000", "File", []string{"f1"}},
+
+		// Column against column.
+		{"SELECT File FROM File WHERE Version = Version", "File", []string{"f1", "f2"}},
+		{"SELECT File FROM File WHERE Language = Attributes", "File", nil},
+
+		{"SELECT DISTINCT Component_, Version FROM File", "Component_ Version", []string{"c1 24.9.0.0"}},
+		{"SELECT File FROM File ORDER BY FileName", "File", []string{"f2", "f1"}},
+		{"SELECT File, Language FROM File ORDER BY Language", "File Language", []string{"f1 <nil>", "f2 1033"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			table, err := db.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			var columns []string
+			for _, c := range table.Columns {
+				columns = append(columns, c.Name)
+			}
+			if got := strings.Join(columns, " "); got != tt.columns {
+				t.Errorf("columns = %s, want %s", got, tt.columns)
+			}
+			var rows []string
+			for _, row := range table.Rows {
+				rows = append(rows, strings.TrimSuffix(strings.TrimPrefix(fmt.Sprint(row), "["), "]"))
+			}
+			if strings.Join(rows, "\n") != strings.Join(tt.rows, "\n") {
+				t.Errorf("rows = %q, want %q", rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "product.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"SELECT * FROM Registry", "Registry"},
+		{"SELECT Missing FROM File", "column Missing not found in table File"},
+		{"SELECT File FROM File WHERE Missing = 1", "column Missing not found"},
+		{"SELECT File FROM File WHERE File = Missing", "column Missing not found"},
+		{"SELECT File FROM File ORDER BY Missing", "column Missing not found"},
+		{"SELECT Property.Value FROM File", "table Property is not part of the query"},
+		{"", "expected SELECT"},
+		{"DELETE FROM File", "expected SELECT"},
+		{"SELECT FROM File", "expected FROM"},
+		{"SELECT * File", "expected FROM"},
+		{"SELECT * FROM", "expected a name, found end of query"},
+		{"SELECT * FROM File, Component", "joins are not supported"},
+		{"SELECT * FROM File WHERE", "expected a name"},
+		{"SELECT * FROM File WHERE File", "expected a comparison operator"},
+		{"SELECT * FROM File WHERE File LIKE 'f%'", "expected a comparison operator"},
+		{"SELECT * FROM File WHERE File =", "expected a value"},
+		{"SELECT * FROM File WHERE File = ?", "query parameters are not supported"},
+		{"SELECT * FROM File WHERE (File = 'f1'", "expected ')'"},
+		{"SELECT * FROM File WHERE File IS 'f1'", "expected NULL"},
+		{"SELECT * FROM File WHERE File = 'f1", "unterminated '"},
+		{"SELECT * FROM `File", "unterminated `"},
+		{"SELECT * FROM File WHERE Sequence = 99999999999999999999", "invalid number"},
+		{"SELECT * FROM File WHERE Sequence = -", "unexpected '-'"},
+		{"SELECT * FROM File ORDER File", "expected BY"},
+		{"SELECT * FROM File extra", `expected end of query, found "extra"`},
+		{"SELECT * FROM File; DROP TABLE File", "unexpected ';'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			table, err := db.Query(tt.query)
+			if err == nil {
+				t.Fatalf("Query returned %d rows, want an error", len(table.Rows))
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Query error = %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProperties(t *testing.T) {
+	db, err := Open(filepath.Join("testdata", "large.msi"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	props, err := db.Properties()
+	if err != nil {
+		t.Fatalf("Properties: %v", err)
+	}
+	if len(props) != 402 {
+		t.Errorf("got %d properties, want 402", len(props))
+	}
+	if got, want := props["Prop399"], "value number 399 of the large fixture"; got != want {
+		t.Errorf("Prop399 = %q, want %q", got, want)
+	}
+}
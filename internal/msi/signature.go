@@ -0,0 +1,185 @@
+package msi
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// An Authenticode signed MSI keeps its PKCS#7 signature in a stream of the
+// root storage. The signature covers every other stream, in a fixed order,
+// rather than the bytes of the file.
+const (
+	signatureStream   = "\x05DigitalSignature"
+	signatureExStream = "\x05MsiDigitalSignatureEx"
+)
+
+// ReadDigitalSignature returns the PKCS#7 signature of the Windows
+// Installer file at path, or nil when it is not signed.
+func ReadDigitalSignature(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cf, err := openCompoundFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if !cf.hasStream(signatureStream) {
+		return nil, nil
+	}
+	data, err := cf.readStream(signatureStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read digital signature: %v", err)
+	}
+	return data, nil
+}
+
+// HashSignedContent returns the digest, made with h, of what the
+// Authenticode signature of the file at path covers: the contents of every
+// stream except the signature, with the children of each storage sorted by
+// their raw UTF-16 names, followed by the CLSID of the storage.
+//
+// A file with an MsiDigitalSignatureEx stream was signed over its directory
+// metadata too. That stream holds the digest of the metadata, which must
+// match the file and is hashed ahead of the contents.
+func HashSignedContent(path string, h crypto.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cf, err := openCompoundFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	w := h.New()
+	if cf.hasStream(signatureExStream) {
+		stored, err := cf.readStream(signatureExStream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read extended signature: %v", err)
+		}
+		metadata := h.New()
+		if err := cf.hashMetadata(0, metadata, 0); err != nil {
+			return nil, err
+		}
+		prehash := metadata.Sum(nil)
+		if !bytes.Equal(prehash, stored) {
+			return nil, fmt.Errorf("the file's metadata was modified after it was signed")
+		}
+		w.Write(prehash)
+	}
+	if err := cf.hashStorage(0, w, 0); err != nil {
+		return nil, err
+	}
+	return w.Sum(nil), nil
+}
+
+func (cf *compoundFile) hashStorage(id int, w io.Writer, depth int) error {
+	if depth > 32 {
+		return fmt.Errorf("storages nested too deeply")
+	}
+
+	for _, child := range cf.signedChildren(id) {
+		e := cf.entries[child]
+		switch e.kind {
+		case entryStream:
+			data, err := cf.readEntry(child)
+			if err != nil {
+				return fmt.Errorf("failed to read stream: %v", err)
+			}
+			w.Write(data)
+		case entryStorage:
+			if err := cf.hashStorage(child, w, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := w.Write(cf.entries[id].clsid[:])
+	return err
+}
+
+// hashMetadata writes the directory metadata the MsiDigitalSignatureEx
+// stream covers: that of the storage id, then of its children in the same
+// order as their contents are hashed.
+func (cf *compoundFile) hashMetadata(id int, w io.Writer, depth int) error {
+	if depth > 32 {
+		return fmt.Errorf("storages nested too deeply")
+	}
+
+	cf.entries[id].writeMetadata(w)
+	for _, child := range cf.signedChildren(id) {
+		e := cf.entries[child]
+		switch e.kind {
+		case entryStream:
+			e.writeMetadata(w)
+		case entryStorage:
+			if err := cf.hashMetadata(child, w, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeMetadata writes the fields of e that an extended signature covers:
+// its name without the terminating NUL, except for the root; the CLSID of a
+// storage or the low 32 bits of the size of a stream; the state bits; and
+// the creation and modification times, except for the root.
+func (e dirEntry) writeMetadata(w io.Writer) {
+	if e.kind != entryRoot && len(e.rawName) >= 2 {
+		w.Write(e.rawName[:len(e.rawName)-2])
+	}
+	if e.kind == entryStream {
+		w.Write(binary.LittleEndian.AppendUint32(nil, uint32(e.size)))
+	} else {
+		w.Write(e.clsid[:])
+	}
+	w.Write(e.stateBits[:])
+	if e.kind != entryRoot {
+		w.Write(e.created[:])
+		w.Write(e.modified[:])
+	}
+}
+
+// signedChildren returns the children of the storage id that a signature
+// covers, sorted by their raw UTF-16 names, a shorter name first when one
+// is a prefix of the other. The signature streams of the root are left out.
+func (cf *compoundFile) signedChildren(id int) []int {
+	var children []int
+	cf.collectChildren(cf.entries[id].child, &children, 0)
+	sort.Slice(children, func(i, j int) bool {
+		a, b := cf.entries[children[i]].rawName, cf.entries[children[j]].rawName
+		if diff := bytes.Compare(a[:min(len(a), len(b))], b[:min(len(a), len(b))]); diff != 0 {
+			return diff < 0
+		}
+		return len(a) < len(b)
+	})
+
+	signed := children[:0]
+	for _, child := range children {
+		if name := cf.entries[child].name; id == 0 && (name == signatureStream || name == signatureExStream) {
+			continue
+		}
+		signed = append(signed, child)
+	}
+	return signed
+}
+
+// collectChildren gathers the entries of the red-black tree below id.
+func (cf *compoundFile) collectChildren(id uint32, out *[]int, depth int) {
+	if id == noStream || int(id) >= len(cf.entries) || depth > len(cf.entries) {
+		return
+	}
+	*out = append(*out, int(id))
+	cf.collectChildren(cf.entries[id].left, out, depth+1)
+	cf.collectChildren(cf.entries[id].right, out, depth+1)
+}
@@ -0,0 +1,83 @@
+package msi
+
+import "strings"
+
+// Stream names inside an MSI are compressed so that the 31 character limit
+// of compound file names fits longer table names: pairs of characters from
+// the set [0-9A-Za-z._] are packed into a single code unit, and table
+// streams are prefixed with U+4840.
+
+const tablePrefix = 0x4840
+
+func mimeIndex(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	case c == '.':
+		return 62
+	case c == '_':
+		return 63
+	}
+	return -1
+}
+
+func mimeChar(i int) rune {
+	switch {
+	case i < 10:
+		return '0' + rune(i)
+	case i < 36:
+		return 'A' + rune(i-10)
+	case i < 62:
+		return 'a' + rune(i-36)
+	case i == 62:
+		return '.'
+	}
+	return '_'
+}
+
+func encodeStreamName(name string, table bool) string {
+	var out []rune
+	if table {
+		out = append(out, tablePrefix)
+	}
+	in := []rune(name)
+	for i := 0; i < len(in); i++ {
+		c := mimeIndex(in[i])
+		if c < 0 {
+			out = append(out, in[i])
+			continue
+		}
+		if i+1 < len(in) {
+			if n := mimeIndex(in[i+1]); n >= 0 {
+				out = append(out, rune(0x3800+(n<<6)+c))
+				i++
+				continue
+			}
+		}
+		out = append(out, rune(0x4800+c))
+	}
+	return string(out)
+}
+
+func decodeStreamName(raw string) (name string, table bool) {
+	var b strings.Builder
+	for i, c := range []rune(raw) {
+		switch {
+		case i == 0 && c == tablePrefix:
+			table = true
+		case c >= 0x3800 && c < 0x4800:
+			c -= 0x3800
+			b.WriteRune(mimeChar(int(c & 0x3F)))
+			b.WriteRune(mimeChar(int((c >> 6) & 0x3F)))
+		case c >= 0x4800 && c < 0x4840:
+			b.WriteRune(mimeChar(int(c - 0x4800)))
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String(), table
+}
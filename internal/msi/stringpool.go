@@ -0,0 +1,129 @@
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Every string in an MSI table is stored as an index into a shared pool.
+// _StringPool holds a (length, refcount) pair per string and _StringData
+// the concatenated bytes, encoded in the database code page.
+
+type stringPool struct {
+	codepage uint32
+	longRefs bool
+	strings  []string
+}
+
+func loadStringPool(pool, data []byte) (*stringPool, error) {
+	if len(pool) < 4 {
+		return nil, fmt.Errorf("string pool too short")
+	}
+
+	le := binary.LittleEndian
+	header := le.Uint32(pool)
+	sp := &stringPool{
+		codepage: header &^ 0x80000000,
+		longRefs: header&0x80000000 != 0,
+		strings:  []string{""},
+	}
+	decoder := codepageDecoder(sp.codepage)
+
+	offset := 0
+	for i := 4; i+4 <= len(pool); i += 4 {
+		length := int(le.Uint16(pool[i:]))
+		refs := le.Uint16(pool[i+2:])
+
+		// Strings longer than 64k are split across two entries: a null
+		// length with the high word stored in the refcount, followed by
+		// the low word.
+		if length == 0 && refs != 0 {
+			if i+8 > len(pool) {
+				return nil, fmt.Errorf("truncated long string entry")
+			}
+			i += 4
+			length = int(refs)<<16 | int(le.Uint16(pool[i:]))
+		}
+
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("string %d exceeds string data", len(sp.strings))
+		}
+		sp.strings = append(sp.strings, decodeString(decoder, data[offset:offset+length]))
+		offset += length
+	}
+
+	return sp, nil
+}
+
+func (sp *stringPool) refSize() int {
+	if sp.longRefs {
+		return 3
+	}
+	return 2
+}
+
+func (sp *stringPool) get(id uint32) (string, error) {
+	if int(id) >= len(sp.strings) {
+		return "", fmt.Errorf("string index %d out of range", id)
+	}
+	return sp.strings[id], nil
+}
+
+func codepageDecoder(codepage uint32) *encoding.Decoder {
+	var enc encoding.Encoding
+	switch codepage {
+	case 65001:
+		return nil
+	case 1250:
+		enc = charmap.Windows1250
+	case 1251:
+		enc = charmap.Windows1251
+	case 1253:
+		enc = charmap.Windows1253
+	case 1254:
+		enc = charmap.Windows1254
+	case 1255:
+		enc = charmap.Windows1255
+	case 1256:
+		enc = charmap.Windows1256
+	case 1257:
+		enc = charmap.Windows1257
+	case 1258:
+		enc = charmap.Windows1258
+	case 874:
+		enc = charmap.Windows874
+	default:
+		// Neutral (0) and 1252 databases are by far the most common.
+		enc = charmap.Windows1252
+	}
+	return enc.NewDecoder()
+}
+
+func decodeString(decoder *encoding.Decoder, b []byte) string {
+	if decoder == nil || isASCII(b) {
+		if utf8.Valid(b) {
+			return string(b)
+		}
+	}
+	if decoder == nil {
+		decoder = charmap.Windows1252.NewDecoder()
+	}
+	s, err := decoder.Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
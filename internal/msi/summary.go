@@ -0,0 +1,196 @@
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The \x05SummaryInformation stream is an OLE property set (MS-OLEPS). MSI
+// reuses the standard document properties for its own purposes, e.g.
+// Template holds "platform;languages" and RevisionNumber the package code.
+
+const summaryStream = "\x05SummaryInformation"
+
+const (
+	pidCodepage       = 1
+	pidTitle          = 2
+	pidSubject        = 3
+	pidAuthor         = 4
+	pidKeywords       = 5
+	pidComments       = 6
+	pidTemplate       = 7
+	pidLastSavedBy    = 8
+	pidRevisionNumber = 9
+	pidCreateTime     = 12
+	pidLastSaveTime   = 13
+	pidPageCount      = 14
+	pidWordCount      = 15
+	pidAppName        = 18
+	pidSecurity       = 19
+)
+
+const (
+	vtI2       = 2
+	vtI4       = 3
+	vtLPSTR    = 30
+	vtFiletime = 64
+)
+
+// SummaryInfo is the decoded summary information stream.
+type SummaryInfo struct {
+	Codepage       int
+	Title          string
+	Subject        string
+	Author         string
+	Keywords       string
+	Comments       string
+	Template       string
+	LastSavedBy    string
+	RevisionNumber string
+	AppName        string
+	PageCount      int
+	WordCount      int
+	Security       int
+	CreateTime     time.Time
+	LastSaveTime   time.Time
+}
+
+// Platform returns the target platform from the Template property,
+// normalised to x86, x64, arm64 or ia64.
+func (s *SummaryInfo) Platform() string {
+	platform, _, _ := strings.Cut(s.Template, ";")
+	switch strings.ToLower(strings.TrimSpace(platform)) {
+	case "", "intel":
+		return "x86"
+	case "x64", "amd64":
+		return "x64"
+	case "arm64":
+		return "arm64"
+	case "arm":
+		return "arm"
+	case "intel64":
+		return "ia64"
+	}
+	return platform
+}
+
+// Languages returns the language IDs listed in the Template property.
+func (s *SummaryInfo) Languages() []string {
+	_, languages, _ := strings.Cut(s.Template, ";")
+	var out []string
+	for _, l := range strings.Split(languages, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// SummaryInfo reads the summary information stream of the database.
+func (db *Database) SummaryInfo() (*SummaryInfo, error) {
+	data, err := db.cf.readStream(summaryStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary information: %v", err)
+	}
+	return parseSummaryInfo(data)
+}
+
+func parseSummaryInfo(data []byte) (*SummaryInfo, error) {
+	le := binary.LittleEndian
+	if len(data) < 48 || le.Uint16(data) != 0xFFFE {
+		return nil, fmt.Errorf("invalid property set header")
+	}
+	if le.Uint32(data[24:]) < 1 {
+		return nil, fmt.Errorf("property set stream is empty")
+	}
+
+	start := int(le.Uint32(data[44:]))
+	if start+8 > len(data) {
+		return nil, fmt.Errorf("property set offset out of range")
+	}
+	set := data[start:]
+	count := int(le.Uint32(set[4:]))
+
+	props := make(map[uint32]any)
+	codepage := 1252
+	for i := 0; i < count; i++ {
+		entry := 8 + i*8
+		if entry+8 > len(set) {
+			break
+		}
+		id := le.Uint32(set[entry:])
+		off := int(le.Uint32(set[entry+4:]))
+		if off+8 > len(set) {
+			continue
+		}
+		typ := le.Uint32(set[off:])
+		value := set[off+4:]
+
+		switch typ {
+		case vtI2:
+			props[id] = int(int16(le.Uint16(value)))
+		case vtI4:
+			props[id] = int(int32(le.Uint32(value)))
+		case vtLPSTR:
+			n := int(le.Uint32(value))
+			if 4+n > len(value) {
+				continue
+			}
+			props[id] = value[4 : 4+n]
+		case vtFiletime:
+			if len(value) < 8 {
+				continue
+			}
+			props[id] = filetime(le.Uint64(value))
+		}
+	}
+	if cp, ok := props[pidCodepage].(int); ok {
+		codepage = int(uint16(cp))
+	}
+
+	decoder := codepageDecoder(uint32(codepage))
+	str := func(id uint32) string {
+		b, _ := props[id].([]byte)
+		for len(b) > 0 && b[len(b)-1] == 0 {
+			b = b[:len(b)-1]
+		}
+		return decodeString(decoder, b)
+	}
+	num := func(id uint32) int {
+		n, _ := props[id].(int)
+		return n
+	}
+	tm := func(id uint32) time.Time {
+		t, _ := props[id].(time.Time)
+		return t
+	}
+
+	return &SummaryInfo{
+		Codepage:       codepage,
+		Title:          str(pidTitle),
+		Subject:        str(pidSubject),
+		Author:         str(pidAuthor),
+		Keywords:       str(pidKeywords),
+		Comments:       str(pidComments),
+		Template:       str(pidTemplate),
+		LastSavedBy:    str(pidLastSavedBy),
+		RevisionNumber: str(pidRevisionNumber),
+		AppName:        str(pidAppName),
+		PageCount:      num(pidPageCount),
+		WordCount:      num(pidWordCount),
+		Security:       num(pidSecurity),
+		CreateTime:     tm(pidCreateTime),
+		LastSaveTime:   tm(pidLastSaveTime),
+	}, nil
+}
+
+// filetime converts a Windows FILETIME (100ns ticks since 1601) to a time.
+func filetime(ticks uint64) time.Time {
+	if ticks == 0 {
+		return time.Time{}
+	}
+	const epochDelta = 116444736000000000
+	return time.Unix(0, (int64(ticks)-epochDelta)*100).UTC()
+}
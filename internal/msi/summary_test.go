@@ -0,0 +1,81 @@
+package msi
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// propertySet builds a summary information stream with one section holding
+// props, each a property ID and its typed value.
+func propertySet(props map[uint32][]byte) []byte {
+	le := binary.LittleEndian
+	header := make([]byte, 48)
+	le.PutUint16(header, 0xFFFE)
+	le.PutUint32(header[24:], 1)
+	le.PutUint32(header[44:], 48)
+
+	index := make([]byte, 8+8*len(props))
+	var body []byte
+	i := 0
+	for id, value := range props {
+		le.PutUint32(index[8+i*8:], id)
+		le.PutUint32(index[12+i*8:], uint32(len(index)+len(body)))
+		body = append(body, value...)
+		i++
+	}
+	le.PutUint32(index, uint32(len(index)+len(body)))
+	le.PutUint32(index[4:], uint32(len(props)))
+	return append(append(header, index...), body...)
+}
+
+func typed(typ uint32, value []byte) []byte {
+	return append(binary.LittleEndian.AppendUint32(nil, typ), value...)
+}
+
+func TestParseSummaryInfo(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ticks := uint64(created.UnixNano()/100) + 116444736000000000
+	data := propertySet(map[uint32][]byte{
+		pidTemplate:       typed(vtLPSTR, append(binary.LittleEndian.AppendUint32(nil, 8), "Intel;0\x00"...)),
+		pidPageCount:      typed(vtI4, binary.LittleEndian.AppendUint32(nil, 200)),
+		pidCreateTime:     typed(vtFiletime, binary.LittleEndian.AppendUint64(nil, ticks)),
+		pidRevisionNumber: typed(vtLPSTR, append(binary.LittleEndian.AppendUint32(nil, 4), "{A}\x00"...)),
+	})
+
+	s, err := parseSummaryInfo(data)
+	if err != nil {
+		t.Fatalf("parseSummaryInfo: %v", err)
+	}
+	if s.Template != "Intel;0" || s.Platform() != "x86" {
+		t.Errorf("Template = %q, Platform = %q", s.Template, s.Platform())
+	}
+	if s.PageCount != 200 {
+		t.Errorf("PageCount = %d, want 200", s.PageCount)
+	}
+	if !s.CreateTime.Equal(created) {
+		t.Errorf("CreateTime = %v, want %v", s.CreateTime, created)
+	}
+	if s.RevisionNumber != "{A}" {
+		t.Errorf("RevisionNumber = %q", s.RevisionNumber)
+	}
+}
+
+func TestParseSummaryInfoTruncated(t *testing.T) {
+	// A FILETIME cut short by the end of the stream is skipped rather than
+	// read past the end.
+	data := propertySet(map[uint32][]byte{
+		pidCreateTime: typed(vtFiletime, []byte{1, 2, 3, 4}),
+	})
+	s, err := parseSummaryInfo(data)
+	if err != nil {
+		t.Fatalf("parseSummaryInfo: %v", err)
+	}
+	if !s.CreateTime.IsZero() {
+		t.Errorf("CreateTime = %v, want zero", s.CreateTime)
+	}
+
+	for n := 0; n < len(data); n++ {
+		parseSummaryInfo(data[:n])
+	}
+}
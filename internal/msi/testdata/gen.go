@@ -0,0 +1,470 @@
+//go:build ignore
+
+// Gen writes the MSI fixtures in this folder. It lays out the compound
+// file, string pool and tables by hand, the way the reader takes them
+// apart, so the fixtures can be rebuilt anywhere without msi.dll:
+//
+//	go generate ./internal/msi
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func main() {
+	// minimal: only a Property table
+	db := newDatabase(1252)
+	db.addTable("Property", []column{{"Property", str(72) | key}, {"Value", str(0)}},
+		row("ProductCode", "{6A1C8A2E-3B1F-4C55-9E0B-1D2F3A4B5C6D}"),
+		row("ProductVersion", "1.0.0"),
+		row("ProductName", "Minimal"),
+		row("Manufacturer", "Société Générale"),
+	)
+	db.save("testdata/minimal.msi")
+
+	// product: several tables, a binary stream and summary information
+	db = newDatabase(1252)
+	db.addTable("Property", []column{{"Property", str(72) | key}, {"Value", str(0)}},
+		row("ProductCode", "{23170F69-40C1-2702-2409-000001000000}"),
+		row("ProductVersion", "24.09.00.0"),
+		row("ProductName", "7-Zip 24.09 (x64 edition)"),
+		row("Manufacturer", "Igor Pavlov"),
+		row("UpgradeCode", "{23170F69-40C1-2702-0000-000004000000}"),
+		row("ProductLanguage", "1033"),
+	)
+	db.addTable("File", []column{
+		{"File", str(72) | key}, {"Component_", str(72)}, {"FileName", str(255)}, {"FileSize", integer(4)},
+		{"Version", str(72) | nullable}, {"Language", str(20) | nullable}, {"Attributes", integer(2) | nullable}, {"Sequence", integer(2)},
+	},
+		row("f1", "c1", "7z.exe", 543744, "24.9.0.0", nil, 512, 1),
+		row("f2", "c1", "7z.dll|7z.dll", 1800000, "24.9.0.0", "1033", nil, 2),
+	)
+	db.addTable("Binary", []column{{"Name", str(72) | key}, {"Data", 0x0900 | nullable}}, row("Icon1", nil))
+	db.addStream(streamName("Binary.Icon1", false), []byte("ICONDATA"))
+	db.addStream("\x05SummaryInformation", summary(
+		property{1, codepage(1252)},
+		property{2, lpstr("Installation Database")},
+		property{7, lpstr("x64;1033,1031")},
+		property{9, lpstr("{AAAAAAAA-BBBB-CCCC-DDDD-EEEEEEEEEEEE}")},
+		property{12, filetime(133000000000000000)},
+		property{14, i4(500)},
+		property{15, i4(2)},
+	))
+	db.save("testdata/product.msi")
+
+	// large: enough properties that the tables and string data leave the
+	// mini stream for regular sectors
+	db = newDatabase(1252)
+	rows := [][]any{row("ProductCode", "{0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0}"), row("ProductVersion", "3.14.159")}
+	for i := range 400 {
+		rows = append(rows, row(fmt.Sprintf("Prop%03d", i), fmt.Sprintf("value number %d of the large fixture", i)))
+	}
+	db.addTable("Property", []column{{"Property", str(72) | key}, {"Value", str(0)}}, rows...)
+	db.save("testdata/large.msi")
+
+	// utf8: code page 65001 with non-ASCII strings
+	db = newDatabase(65001)
+	db.addTable("Property", []column{{"Property", str(72) | key}, {"Value", str(0)}},
+		row("ProductCode", "{C0DE65E0-0001-4F8A-B1C2-D3E4F5A6B7C8}"),
+		row("ProductVersion", "2.0.1"),
+		row("ProductName", "Ünïcödé 製品"),
+		row("Manufacturer", "Nexus"),
+	)
+	db.save("testdata/utf8.msi")
+}
+
+var le = binary.LittleEndian
+
+// Column types, as stored in _Columns.
+const (
+	key      = 0x2000
+	nullable = 0x1000
+)
+
+func str(width int) int     { return 0x0D00 | width }
+func integer(width int) int { return 0x0100 | width }
+
+type column struct {
+	name string
+	typ  int
+}
+
+type table struct {
+	name    string
+	columns []column
+	rows    [][]any
+}
+
+type stream struct {
+	name string
+	data []byte
+}
+
+func row(values ...any) []any { return values }
+
+// database collects the tables and streams of an MSI and the strings they
+// use, numbered in the order they are first stored.
+type database struct {
+	codepage int
+	strings  []string
+	index    map[string]int
+	tables   []table
+	extra    []stream
+}
+
+func newDatabase(codepage int) *database {
+	return &database{codepage: codepage, strings: []string{""}, index: map[string]int{"": 0}}
+}
+
+func (db *database) addTable(name string, columns []column, rows ...[]any) {
+	db.tables = append(db.tables, table{name, columns, rows})
+}
+
+func (db *database) addStream(name string, data []byte) {
+	db.extra = append(db.extra, stream{name, data})
+}
+
+func (db *database) stringID(v any) int {
+	if v == nil {
+		return 0
+	}
+	s := v.(string)
+	if _, ok := db.index[s]; !ok {
+		db.index[s] = len(db.strings)
+		db.strings = append(db.strings, s)
+	}
+	return db.index[s]
+}
+
+// encodeTable stores rows column by column: string IDs in two bytes,
+// integers offset by 0x8000 or 0x80000000 so that zero is null.
+func (db *database) encodeTable(columns []column, rows [][]any) []byte {
+	var b []byte
+	for i, c := range columns {
+		for _, r := range rows {
+			v := r[i]
+			switch {
+			case c.typ&0x0800 != 0:
+				b = le.AppendUint16(b, uint16(db.stringID(v)))
+			case c.typ&0xFF == 4:
+				n := uint32(0)
+				if v != nil {
+					n = uint32(v.(int)) + 0x80000000
+				}
+				b = le.AppendUint32(b, n)
+			default:
+				n := uint16(0)
+				if v != nil {
+					n = uint16(v.(int)) + 0x8000
+				}
+				b = le.AppendUint16(b, n)
+			}
+		}
+	}
+	return b
+}
+
+func (db *database) save(path string) {
+	var tables, columns [][]any
+	for _, t := range db.tables {
+		tables = append(tables, row(t.name))
+		for i, c := range t.columns {
+			columns = append(columns, row(t.name, i+1, c.name, c.typ))
+		}
+	}
+	var streams []stream
+	for _, t := range db.tables {
+		streams = append(streams, stream{streamName(t.name, true), db.encodeTable(t.columns, t.rows)})
+	}
+	streams = append(streams,
+		stream{streamName("_Tables", true), db.encodeTable([]column{{"Name", 0x2D00 | 0x0800 | 0x100 | 2}}, tables)},
+		stream{streamName("_Columns", true), db.encodeTable([]column{{"Table", 0x2902}, {"Number", 0x2102}, {"Name", 0x0902}, {"Type", 0x0102}}, columns)},
+	)
+
+	pool := le.AppendUint32(nil, uint32(db.codepage))
+	var data []byte
+	for _, s := range db.strings[1:] {
+		b := db.encode(s)
+		data = append(data, b...)
+		if len(b) >= 0x10000 {
+			pool = le.AppendUint16(le.AppendUint16(pool, 0), uint16(len(b)>>16))
+		}
+		pool = le.AppendUint16(le.AppendUint16(pool, uint16(len(b))), 1)
+	}
+	streams = append(streams, stream{streamName("_StringPool", true), pool}, stream{streamName("_StringData", true), data})
+	streams = append(streams, db.extra...)
+
+	if err := os.WriteFile(path, compoundFile(streams), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func (db *database) encode(s string) []byte {
+	if db.codepage == 65001 {
+		return []byte(s)
+	}
+	b, err := charmap.Windows1252.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// streamName compresses an MSI stream name two characters to a UTF-16
+// code unit, as MSI does; table streams get a 0x4840 prefix.
+func streamName(name string, isTable bool) string {
+	mime := func(c rune) int {
+		switch {
+		case c >= '0' && c <= '9':
+			return int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			return int(c-'A') + 10
+		case c >= 'a' && c <= 'z':
+			return int(c-'a') + 36
+		case c == '.':
+			return 62
+		case c == '_':
+			return 63
+		}
+		return -1
+	}
+	var out []rune
+	if isTable {
+		out = append(out, 0x4840)
+	}
+	r := []rune(name)
+	for i := 0; i < len(r); i++ {
+		c := mime(r[i])
+		switch {
+		case c < 0:
+			out = append(out, r[i])
+		case i+1 < len(r) && mime(r[i+1]) >= 0:
+			out = append(out, rune(0x3800+mime(r[i+1])<<6+c))
+			i++
+		default:
+			out = append(out, rune(0x4800+c))
+		}
+	}
+	return string(out)
+}
+
+const (
+	sectorSize     = 512
+	miniSectorSize = 64
+	miniCutoff     = 4096
+	endOfChain     = 0xFFFFFFFE
+	freeSector     = 0xFFFFFFFF
+	fatSector      = 0xFFFFFFFD
+	noStream       = 0xFFFFFFFF
+)
+
+// compoundFile lays out streams in a version 3 compound file: small
+// streams in the mini stream, the rest in regular sectors, and a flat
+// directory with every stream to the right of the one before.
+func compoundFile(streams []stream) []byte {
+	var sectors [][]byte
+	var fat []uint32
+	alloc := func(data []byte) uint32 {
+		n := (len(data) + sectorSize - 1) / sectorSize
+		if n == 0 {
+			return endOfChain
+		}
+		start := len(sectors)
+		for i := range n {
+			sector := make([]byte, sectorSize)
+			copy(sector, data[i*sectorSize:])
+			sectors = append(sectors, sector)
+			next := uint32(endOfChain)
+			if i < n-1 {
+				next = uint32(start + i + 1)
+			}
+			fat = append(fat, next)
+		}
+		return uint32(start)
+	}
+
+	type entry struct {
+		name  string
+		start uint32
+		size  int
+	}
+	var mini []byte
+	var miniFat []uint32
+	var entries []entry
+	for _, s := range streams {
+		start := uint32(endOfChain)
+		switch {
+		case len(s.data) >= miniCutoff:
+			start = alloc(s.data)
+		case len(s.data) > 0:
+			n := (len(s.data) + miniSectorSize - 1) / miniSectorSize
+			first := len(mini) / miniSectorSize
+			start = uint32(first)
+			mini = append(mini, s.data...)
+			mini = append(mini, make([]byte, n*miniSectorSize-len(s.data))...)
+			for i := range n {
+				next := uint32(endOfChain)
+				if i < n-1 {
+					next = uint32(first + i + 1)
+				}
+				miniFat = append(miniFat, next)
+			}
+		}
+		entries = append(entries, entry{s.name, start, len(s.data)})
+	}
+
+	miniStart := uint32(endOfChain)
+	if len(mini) > 0 {
+		miniStart = alloc(mini)
+	}
+	var miniFatData []byte
+	for _, next := range miniFat {
+		miniFatData = le.AppendUint32(miniFatData, next)
+	}
+	miniFatStart, miniFatSectors := uint32(endOfChain), 0
+	if len(miniFat) > 0 {
+		miniFatStart = alloc(miniFatData)
+		miniFatSectors = (len(miniFatData) + sectorSize - 1) / sectorSize
+	}
+
+	dirent := func(name string, kind byte, left, right, child, start uint32, size int) []byte {
+		b := make([]byte, 128)
+		units := utf16.Encode([]rune(name))
+		for i, u := range units {
+			le.PutUint16(b[i*2:], u)
+		}
+		if name != "" {
+			le.PutUint16(b[64:], uint16(len(units)*2+2))
+		}
+		b[66] = kind
+		b[67] = 1 // black
+		le.PutUint32(b[68:], left)
+		le.PutUint32(b[72:], right)
+		le.PutUint32(b[76:], child)
+		le.PutUint32(b[116:], start)
+		le.PutUint64(b[120:], uint64(size))
+		return b
+	}
+	child := uint32(noStream)
+	if len(entries) > 0 {
+		child = 1
+	}
+	dir := dirent("Root Entry", 5, noStream, noStream, child, miniStart, len(mini))
+	for i, e := range entries {
+		right := uint32(noStream)
+		if i+1 < len(entries) {
+			right = uint32(i + 2)
+		}
+		dir = append(dir, dirent(e.name, 2, noStream, right, noStream, e.start, e.size)...)
+	}
+	for len(dir)%sectorSize != 0 {
+		dir = append(dir, dirent("", 0, noStream, noStream, noStream, 0, 0)...)
+	}
+	dirStart := alloc(dir)
+
+	// The FAT covers every sector, its own included.
+	numFat := 1
+	for numFat*(sectorSize/4) < len(sectors)+numFat {
+		numFat++
+	}
+	fatStart := len(sectors)
+	for range numFat {
+		fat = append(fat, fatSector)
+	}
+	for len(fat) < numFat*(sectorSize/4) {
+		fat = append(fat, freeSector)
+	}
+	for i := range numFat {
+		sector := make([]byte, 0, sectorSize)
+		for _, next := range fat[i*sectorSize/4 : (i+1)*sectorSize/4] {
+			sector = le.AppendUint32(sector, next)
+		}
+		sectors = append(sectors, sector)
+	}
+
+	h := make([]byte, sectorSize)
+	copy(h, "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")
+	le.PutUint16(h[0x18:], 0x3E)
+	le.PutUint16(h[0x1A:], 3)
+	le.PutUint16(h[0x1C:], 0xFFFE)
+	le.PutUint16(h[0x1E:], 9)
+	le.PutUint16(h[0x20:], 6)
+	le.PutUint32(h[0x2C:], uint32(numFat))
+	le.PutUint32(h[0x30:], dirStart)
+	le.PutUint32(h[0x38:], miniCutoff)
+	le.PutUint32(h[0x3C:], miniFatStart)
+	le.PutUint32(h[0x40:], uint32(miniFatSectors))
+	le.PutUint32(h[0x44:], endOfChain)
+	for i := range 109 {
+		next := uint32(freeSector)
+		if i < numFat {
+			next = uint32(fatStart + i)
+		}
+		le.PutUint32(h[0x4C+i*4:], next)
+	}
+
+	out := h
+	for _, s := range sectors {
+		out = append(out, s...)
+	}
+	return out
+}
+
+// property is a summary information property: its ID and typed value.
+type property struct {
+	id    uint32
+	value []byte
+}
+
+// summary returns a SummaryInformation stream with one property set.
+func summary(props ...property) []byte {
+	var index, body []byte
+	offset := 8 + 8*len(props)
+	for _, p := range props {
+		index = le.AppendUint32(index, p.id)
+		index = le.AppendUint32(index, uint32(offset+len(body)))
+		body = append(body, p.value...)
+	}
+	set := le.AppendUint32(nil, uint32(8+len(index)+len(body)))
+	set = le.AppendUint32(set, uint32(len(props)))
+	set = append(append(set, index...), body...)
+
+	h := le.AppendUint16(nil, 0xFFFE)
+	h = le.AppendUint16(h, 0)
+	h = le.AppendUint32(h, 0x20006)
+	h = append(h, make([]byte, 16)...)
+	h = le.AppendUint32(h, 1)
+	h = append(h, 0xe0, 0x85, 0x9f, 0xf2, 0xf9, 0x4f, 0x68, 0x10, 0xab, 0x91, 0x08, 0x00, 0x2b, 0x27, 0xb3, 0xd9)
+	h = le.AppendUint32(h, 48)
+	return append(h, set...)
+}
+
+func lpstr(s string) []byte {
+	b, err := charmap.Windows1252.NewEncoder().Bytes([]byte(s + "\x00"))
+	if err != nil {
+		panic(err)
+	}
+	n := len(b)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return append(le.AppendUint32(le.AppendUint32(nil, 30), uint32(n)), b...)
+}
+
+func codepage(cp int) []byte {
+	return le.AppendUint16(le.AppendUint16(le.AppendUint32(nil, 2), uint16(cp)), 0)
+}
+
+func i4(n int32) []byte {
+	return le.AppendUint32(le.AppendUint32(nil, 3), uint32(n))
+}
+
+func filetime(ticks uint64) []byte {
+	return le.AppendUint64(le.AppendUint32(nil, 64), ticks)
+}
@@ -0,0 +1,211 @@
+package payload
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Archives are the archive types a payload can be extracted from. Zip
+// files are read natively; everything else goes through 7-Zip.
+var Archives = []string{".zip", ".7z"}
+
+// IsArchive reports whether the file name has a supported archive
+// extension.
+func IsArchive(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, a := range Archives {
+		if ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract copies a folder, or extracts an archive, into dir and returns
+// the files written.
+func Extract(source, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return copyDir(source, dir)
+	}
+
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".zip":
+		return unzip(source, dir)
+	case ".7z":
+		if err := extract7z(source, dir); err != nil {
+			return nil, err
+		}
+		return Files(dir)
+	}
+	return nil, fmt.Errorf("%s is not a folder or supported archive", source)
+}
+
+// SetupCandidates returns the files with one of the given extensions,
+// shallowest first so that a top-level setup.exe is preferred over the
+// helpers in subfolders.
+func SetupCandidates(files []string, exts ...string) []string {
+	var candidates []string
+	for _, f := range files {
+		ext := strings.ToLower(path.Ext(f))
+		for _, e := range exts {
+			if ext == e {
+				candidates = append(candidates, f)
+				break
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		di, dj := strings.Count(candidates[i], "/"), strings.Count(candidates[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return strings.ToLower(candidates[i]) < strings.ToLower(candidates[j])
+	})
+	return candidates
+}
+
+// Files returns the files under root as slash-separated relative paths.
+func Files(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+func copyDir(source, dir string) ([]string, error) {
+	files, err := Files(source)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := copyFile(filepath.Join(source, filepath.FromSlash(f)), filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+func writeFile(dst string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %s: %v", dst, err)
+	}
+	return out.Close()
+}
+
+// safeJoin resolves a slash-separated archive entry name under dir,
+// refusing absolute names and names that would escape it.
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if path.IsAbs(name) || filepath.VolumeName(filepath.FromSlash(name)) != "" ||
+		!strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %s points outside the extraction folder", name)
+	}
+	return target, nil
+}
+
+func unzip(source, dir string) ([]string, error) {
+	zr, err := zip.OpenReader(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer zr.Close()
+
+	var files []string
+	for _, f := range zr.File {
+		// Zip files made on Windows may separate folders with backslashes.
+		name := strings.ReplaceAll(f.Name, `\`, "/")
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
+			continue
+		}
+		target, err := safeJoin(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+		}
+		err = writeFile(target, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, path.Clean(name))
+	}
+	return files, nil
+}
+
+// sevenZip finds a 7-Zip command line tool.
+func sevenZip() (string, error) {
+	for _, name := range []string{"7z", "7zz", "7za"} {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	if p := `C:\Program Files\7-Zip\7z.exe`; fileExists(p) {
+		return p, nil
+	}
+	return "", fmt.Errorf("7-Zip is required for .7z archives but was not found on PATH")
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+func extract7z(source, dir string) error {
+	tool, err := sevenZip()
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command(tool, "x", "-y", "-o"+dir, source).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to extract archive: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package payload
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeZip writes a zip file holding the given names and contents.
+func writeZip(t *testing.T, files ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "payload.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for i := 0; i+1 < len(files); i += 2 {
+		w, err := zw.Create(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[i+1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractZip(t *testing.T) {
+	source := writeZip(t,
+		"setup.exe", "MZ",
+		"docs/", "",
+		"docs/readme.txt", "read me",
+		`bin\x64\helper.exe`, "MZ helper",
+		`data\`, "",
+	)
+	dir := filepath.Join(t.TempDir(), "payload")
+	files, err := Extract(source, dir)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if want := []string{"setup.exe", "docs/readme.txt", "bin/x64/helper.exe"}; !slices.Equal(files, want) {
+		t.Errorf("Extract = %q, want %q", files, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "bin", "x64", "helper.exe")); string(data) != "MZ helper" {
+		t.Errorf("bin/x64/helper.exe holds %q", data)
+	}
+	if got := SetupCandidates(files, ".exe"); !slices.Equal(got, []string{"setup.exe", "bin/x64/helper.exe"}) {
+		t.Errorf("SetupCandidates = %q", got)
+	}
+}
+
+func TestExtractZipSlip(t *testing.T) {
+	for _, name := range []string{
+		"../evil.exe",
+		"docs/../../evil.exe",
+		`..\evil.exe`,
+		`docs\..\..\evil.exe`,
+		"/evil.exe",
+		`\evil.exe`,
+		"..",
+	} {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			source := writeZip(t, "setup.exe", "MZ", name, "pwned")
+			if files, err := Extract(source, filepath.Join(parent, "payload")); err == nil {
+				t.Errorf("Extract = %q, want an error", files)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil.exe")); err == nil {
+				t.Error("Extract wrote outside of its folder")
+			}
+			if _, err := os.Stat(filepath.Join(parent, "payload", "evil.exe")); err == nil {
+				t.Error("Extract wrote an absolute name into its folder")
+			}
+		})
+	}
+}
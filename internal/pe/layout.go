@@ -0,0 +1,117 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Layout describes where the parts of a PE file live on disk. The overlay
+// is whatever follows the last section, minus a trailing Authenticode
+// certificate table; installer stubs keep their payload there.
+//
+// ChecksumOffset and CertificateEntryOffset locate the header fields that
+// Authenticode leaves out of the signed digest: the image checksum and the
+// security data directory entry.
+type Layout struct {
+	Sections               []string
+	OverlayOffset          int64
+	OverlaySize            int64
+	CertificateOffset      int64
+	CertificateSize        int64
+	ChecksumOffset         int64
+	CertificateEntryOffset int64
+	FileSize               int64
+}
+
+// ReadLayout reads the section table and locates the overlay and the
+// certificate table of the PE file at path.
+func ReadLayout(path string) (*Layout, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PE file: %v", err)
+	}
+	defer f.Close()
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Layout{FileSize: stat.Size()}
+	if err := l.readHeaderOffsets(path); err != nil {
+		return nil, err
+	}
+	for _, s := range f.Sections {
+		l.Sections = append(l.Sections, s.Name)
+		if end := int64(s.Offset) + int64(s.Size); s.Size > 0 && end > l.OverlayOffset {
+			l.OverlayOffset = end
+		}
+	}
+
+	// The security directory is the one data directory that holds a file
+	// offset rather than an RVA.
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if len(oh.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	case *pe.OptionalHeader64:
+		if len(oh.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		}
+	}
+	if dir.VirtualAddress != 0 && dir.Size != 0 && int64(dir.VirtualAddress)+int64(dir.Size) <= l.FileSize {
+		l.CertificateOffset = int64(dir.VirtualAddress)
+		l.CertificateSize = int64(dir.Size)
+	}
+
+	end := l.FileSize
+	if l.CertificateSize > 0 && l.CertificateOffset >= l.OverlayOffset {
+		end = l.CertificateOffset
+	}
+	if end > l.OverlayOffset {
+		l.OverlaySize = end - l.OverlayOffset
+	}
+
+	return l, nil
+}
+
+// readHeaderOffsets finds the checksum and the security directory entry in
+// the optional header, whose layout differs between PE32 and PE32+.
+func (l *Layout) readHeaderOffsets(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf [4]byte
+	if _, err := f.ReadAt(buf[:], 0x3C); err != nil {
+		return fmt.Errorf("failed to read DOS header: %v", err)
+	}
+	optionalHeader := int64(binary.LittleEndian.Uint32(buf[:])) + 4 + 20
+	if _, err := f.ReadAt(buf[:2], optionalHeader); err != nil {
+		return fmt.Errorf("failed to read optional header: %v", err)
+	}
+
+	directories := optionalHeader + 96
+	if binary.LittleEndian.Uint16(buf[:2]) == 0x20B {
+		directories = optionalHeader + 112
+	}
+	l.ChecksumOffset = optionalHeader + 64
+	l.CertificateEntryOffset = directories + pe.IMAGE_DIRECTORY_ENTRY_SECURITY*8
+	return nil
+}
+
+// HasSection reports whether the file has a section with the given name.
+func (l *Layout) HasSection(name string) bool {
+	for _, s := range l.Sections {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
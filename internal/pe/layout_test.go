@@ -0,0 +1,34 @@
+package pe
+
+import (
+	"testing"
+
+	"nexus/internal/pe/petest"
+)
+
+func TestReadLayout(t *testing.T) {
+	path := writePE(t, petest.File{
+		Sections: []petest.Section{
+			{Name: ".text", Data: []byte{0xC3}},
+			{Name: ".wixburn", Data: make([]byte, 0x300)},
+		},
+		Overlay: []byte("payload"),
+	})
+	l, err := ReadLayout(path)
+	if err != nil {
+		t.Fatalf("ReadLayout: %v", err)
+	}
+	// The headers, one sector of .text and two of .wixburn.
+	if l.OverlayOffset != 0x800 || l.OverlaySize != 7 || l.FileSize != 0x807 {
+		t.Errorf("overlay at %#x, %d bytes, file %#x bytes; want 0x800, 7, 0x807", l.OverlayOffset, l.OverlaySize, l.FileSize)
+	}
+	if !l.HasSection(".wixburn") || l.HasSection(".rsrc") {
+		t.Errorf("Sections = %q", l.Sections)
+	}
+	if l.ChecksumOffset != 0x58+64 || l.CertificateEntryOffset != 0x58+96+4*8 {
+		t.Errorf("checksum at %#x, security entry at %#x", l.ChecksumOffset, l.CertificateEntryOffset)
+	}
+	if l.CertificateSize != 0 {
+		t.Errorf("CertificateSize = %d for an unsigned file", l.CertificateSize)
+	}
+}
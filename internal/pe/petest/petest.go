@@ -0,0 +1,159 @@
+// Package petest builds small PE files for tests: a 32-bit image with the
+// given sections, an optional version resource and an overlay.
+package petest
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Section is a section of the image and its raw data.
+type Section struct {
+	Name string
+	Data []byte
+}
+
+// File describes the PE file to build.
+type File struct {
+	Sections []Section
+	// VersionInfo, when set, is stored as the only resource, in a .rsrc
+	// section after the others.
+	VersionInfo []byte
+	// Overlay follows the last section.
+	Overlay []byte
+}
+
+const (
+	peHeader       = 0x40
+	optionalHeader = peHeader + 4 + 20
+	sectionTable   = optionalHeader + 224
+	fileAlignment  = 0x200
+	sectionAlign   = 0x1000
+	resourceEntry  = 2
+)
+
+var le = binary.LittleEndian
+
+// Bytes returns the PE file.
+func (f File) Bytes() []byte {
+	sections := f.Sections
+	if f.VersionInfo != nil {
+		rva := uint32(sectionAlign * (len(sections) + 1))
+		sections = append(sections[:len(sections):len(sections)], Section{".rsrc", resources(rva, f.VersionInfo)})
+	}
+
+	b := make([]byte, fileAlignment)
+	copy(b, "MZ")
+	le.PutUint32(b[0x3C:], peHeader)
+	copy(b[peHeader:], "PE\x00\x00")
+	coff := b[peHeader+4:]
+	le.PutUint16(coff[0:], 0x14C) // i386
+	le.PutUint16(coff[2:], uint16(len(sections)))
+	le.PutUint16(coff[16:], 224)
+	le.PutUint16(coff[18:], 0x102) // executable, 32-bit
+
+	opt := b[optionalHeader:]
+	le.PutUint16(opt[0:], 0x10B) // PE32
+	le.PutUint32(opt[16:], sectionAlign)
+	le.PutUint32(opt[28:], 0x400000)
+	le.PutUint32(opt[32:], sectionAlign)
+	le.PutUint32(opt[36:], fileAlignment)
+	le.PutUint32(opt[56:], uint32(sectionAlign*(len(sections)+1)))
+	le.PutUint32(opt[60:], fileAlignment)
+	le.PutUint16(opt[68:], 2) // GUI
+	le.PutUint32(opt[92:], 16)
+
+	for i, s := range sections {
+		rva := uint32(sectionAlign * (i + 1))
+		raw := (len(s.Data) + fileAlignment - 1) / fileAlignment * fileAlignment
+		h := b[sectionTable+i*40:]
+		copy(h[:8], s.Name)
+		le.PutUint32(h[8:], uint32(max(len(s.Data), 1)))
+		le.PutUint32(h[12:], rva)
+		le.PutUint32(h[16:], uint32(raw))
+		le.PutUint32(h[20:], uint32(len(b)))
+		le.PutUint32(h[36:], 0x40000040) // initialized data, readable
+		if s.Name == ".rsrc" && f.VersionInfo != nil {
+			le.PutUint32(b[optionalHeader+96+resourceEntry*8:], rva)
+			le.PutUint32(b[optionalHeader+96+resourceEntry*8+4:], uint32(len(s.Data)))
+		}
+		data := make([]byte, raw)
+		copy(data, s.Data)
+		b = append(b, data...)
+	}
+	return append(b, f.Overlay...)
+}
+
+// resources returns a resource section at rva holding data as the only
+// RT_VERSION resource, with ID 1 in US English.
+func resources(rva uint32, data []byte) []byte {
+	const dataEntry = 0x48
+	b := make([]byte, dataEntry+16)
+	directory := func(off int, id, target uint32) {
+		le.PutUint16(b[off+14:], 1)
+		le.PutUint32(b[off+16:], id)
+		le.PutUint32(b[off+20:], target)
+	}
+	directory(0x00, 16, 0x80000000|0x18) // RT_VERSION
+	directory(0x18, 1, 0x80000000|0x30)
+	directory(0x30, 0x409, dataEntry)
+	le.PutUint32(b[dataEntry:], rva+uint32(len(b)))
+	le.PutUint32(b[dataEntry+4:], uint32(len(data)))
+	return append(b, data...)
+}
+
+// VersionInfo returns a VS_VERSIONINFO resource with version as both the
+// fixed file and product version, and a US English string table of the
+// given key and value pairs.
+func VersionInfo(version [4]uint16, pairs ...string) []byte {
+	fixed := make([]byte, 52)
+	le.PutUint32(fixed[0:], 0xFEEF04BD)
+	le.PutUint32(fixed[4:], 0x00010000)
+	for _, off := range []int{8, 16} {
+		le.PutUint32(fixed[off:], uint32(version[0])<<16|uint32(version[1]))
+		le.PutUint32(fixed[off+4:], uint32(version[2])<<16|uint32(version[3]))
+	}
+
+	var strings [][]byte
+	for i := 0; i+1 < len(pairs); i += 2 {
+		strings = append(strings, block(pairs[i], true, text(pairs[i+1])))
+	}
+	table := block("040904b0", true, nil, strings...)
+	return block("VS_VERSION_INFO", false, fixed, block("StringFileInfo", true, nil, table))
+}
+
+// block returns a node of the version resource tree. The value length of a
+// text value counts UTF-16 characters rather than bytes.
+func block(key string, isText bool, value []byte, children ...[]byte) []byte {
+	b := make([]byte, 6)
+	b = append(b, text(key)...)
+	b = pad(b)
+	b = append(b, value...)
+	for _, c := range children {
+		b = append(pad(b), c...)
+	}
+	le.PutUint16(b[0:], uint16(len(b)))
+	valueLength := len(value)
+	if isText {
+		valueLength /= 2
+		le.PutUint16(b[4:], 1)
+	}
+	le.PutUint16(b[2:], uint16(valueLength))
+	return b
+}
+
+// text returns s in UTF-16 with a terminating NUL.
+func text(s string) []byte {
+	var b []byte
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = le.AppendUint16(b, c)
+	}
+	return append(b, 0, 0)
+}
+
+func pad(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -0,0 +1,91 @@
+package pe
+
+import (
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// winCertTypePKCSSignedData marks a WIN_CERTIFICATE entry holding an
+// Authenticode PKCS#7 SignedData.
+const winCertTypePKCSSignedData = 0x0002
+
+// ReadSignature returns the PKCS#7 signature in the certificate table of
+// the PE file at path, or nil when it is not signed.
+func ReadSignature(path string) ([]byte, error) {
+	l, err := ReadLayout(path)
+	if err != nil {
+		return nil, err
+	}
+	if l.CertificateSize == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table := make([]byte, l.CertificateSize)
+	if _, err := f.ReadAt(table, l.CertificateOffset); err != nil {
+		return nil, fmt.Errorf("failed to read certificate table: %v", err)
+	}
+
+	// The table is a list of WIN_CERTIFICATE entries, each aligned to
+	// eight bytes: length, revision, type and then the certificate.
+	le := binary.LittleEndian
+	for off := 0; off+8 <= len(table); {
+		length := int(le.Uint32(table[off:]))
+		if length < 8 || off+length > len(table) {
+			return nil, fmt.Errorf("corrupt certificate table")
+		}
+		if le.Uint16(table[off+6:]) == winCertTypePKCSSignedData {
+			return table[off+8 : off+length], nil
+		}
+		off += (length + 7) &^ 7
+	}
+	return nil, nil
+}
+
+// HashSignedContent returns the digest, made with h, of what the
+// Authenticode signature of the PE file at path covers: the whole file
+// except the checksum, the security directory entry and the certificate
+// table.
+func HashSignedContent(path string, h crypto.Hash) ([]byte, error) {
+	l, err := ReadLayout(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end := l.FileSize
+	if l.CertificateSize > 0 {
+		end = l.CertificateOffset
+	}
+	ranges := [][2]int64{
+		{0, l.ChecksumOffset},
+		{l.ChecksumOffset + 4, l.CertificateEntryOffset},
+		{l.CertificateEntryOffset + 8, end},
+	}
+	if l.CertificateSize > 0 {
+		ranges = append(ranges, [2]int64{l.CertificateOffset + l.CertificateSize, l.FileSize})
+	}
+	w := h.New()
+	for _, r := range ranges {
+		if r[1] <= r[0] {
+			continue
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(f, r[0], r[1]-r[0])); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %v", path, err)
+		}
+	}
+	return w.Sum(nil), nil
+}
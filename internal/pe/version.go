@@ -0,0 +1,295 @@
+package pe
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	rtVersion          = 16
+	fixedInfoSignature = 0xFEEF04BD
+)
+
+// VersionInfo holds the interesting parts of a VS_VERSIONINFO resource.
+// FixedFileVersion and FixedProductVersion come from VS_FIXEDFILEINFO; the
+// rest are the free-form strings of the first string table.
+type VersionInfo struct {
+	FileVersion         string
+	ProductVersion      string
+	ProductName         string
+	CompanyName         string
+	FileDescription     string
+	OriginalFilename    string
+	LegalCopyright      string
+	FixedFileVersion    string
+	FixedProductVersion string
+}
+
+// Version returns the best available product version in dotted form.
+func (v *VersionInfo) Version() string {
+	for _, s := range []string{v.ProductVersion, v.FixedProductVersion, v.FileVersion, v.FixedFileVersion} {
+		if s = normalizeVersion(s); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Name returns the product name, falling back to the file description.
+func (v *VersionInfo) Name() string {
+	if v.ProductName != "" {
+		return v.ProductName
+	}
+	return v.FileDescription
+}
+
+// normalizeVersion turns strings such as "1, 2, 3, 4" or "24.09 (x64)" into
+// a plain dotted version.
+func normalizeVersion(s string) string {
+	s = strings.TrimSpace(strings.ReplaceAll(s, ",", "."))
+	s = strings.ReplaceAll(s, " ", "")
+	end := 0
+	for end < len(s) && (s[end] == '.' || (s[end] >= '0' && s[end] <= '9')) {
+		end++
+	}
+	return strings.Trim(s[:end], ".")
+}
+
+// ReadVersionInfo parses the version resource of the PE file at path.
+func ReadVersionInfo(path string) (*VersionInfo, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PE file: %v", err)
+	}
+	defer f.Close()
+
+	data, err := findResource(f, rtVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVersionInfo(data)
+}
+
+// resourceSection returns the raw resource directory and the RVA it
+// starts at.
+func resourceSection(f *pe.File) ([]byte, uint32, error) {
+	var dir pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if len(oh.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	case *pe.OptionalHeader64:
+		if len(oh.DataDirectory) > pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+			dir = oh.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+		}
+	}
+	if dir.VirtualAddress == 0 || dir.Size == 0 {
+		return nil, 0, fmt.Errorf("file has no resources")
+	}
+
+	for _, s := range f.Sections {
+		if dir.VirtualAddress >= s.VirtualAddress && dir.VirtualAddress < s.VirtualAddress+s.Size {
+			data, err := s.Data()
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to read resource section: %v", err)
+			}
+			return data[dir.VirtualAddress-s.VirtualAddress:], dir.VirtualAddress, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("resource directory is outside of all sections")
+}
+
+// findResource returns the data of the first resource of the given type,
+// whatever its name and language.
+func findResource(f *pe.File, typ uint32) ([]byte, error) {
+	rsrc, base, err := resourceSection(f)
+	if err != nil {
+		return nil, err
+	}
+
+	le := binary.LittleEndian
+	offset := uint32(0)
+	want := typ
+	for level := 0; level < 3; level++ {
+		if int(offset)+16 > len(rsrc) {
+			return nil, fmt.Errorf("corrupt resource directory")
+		}
+		named := int(le.Uint16(rsrc[offset+12:]))
+		ids := int(le.Uint16(rsrc[offset+14:]))
+
+		found := false
+		for i := 0; i < named+ids; i++ {
+			entry := int(offset) + 16 + i*8
+			if entry+8 > len(rsrc) {
+				break
+			}
+			id := le.Uint32(rsrc[entry:])
+			target := le.Uint32(rsrc[entry+4:])
+			if level == 0 && id != want {
+				continue
+			}
+			offset = target &^ 0x80000000
+			found = true
+			if target&0x80000000 == 0 {
+				level = 3
+			}
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("resource type %d not found", typ)
+		}
+	}
+
+	if int(offset)+16 > len(rsrc) {
+		return nil, fmt.Errorf("corrupt resource data entry")
+	}
+	rva := le.Uint32(rsrc[offset:])
+	size := le.Uint32(rsrc[offset+4:])
+	start := int64(rva) - int64(base)
+	if start < 0 || start+int64(size) > int64(len(rsrc)) {
+		return nil, fmt.Errorf("resource data out of range")
+	}
+	return rsrc[start : start+int64(size)], nil
+}
+
+type versionBlock struct {
+	key      string
+	value    []byte
+	isText   bool
+	children []versionBlock
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// parseVersionBlock decodes one node of the VS_VERSIONINFO tree: a length,
+// value length and type header, a NUL-terminated UTF-16 key, a value and
+// any number of child nodes, each aligned to 32 bits.
+func parseVersionBlock(b []byte) (versionBlock, int, error) {
+	var blk versionBlock
+	if len(b) < 6 {
+		return blk, 0, fmt.Errorf("version block too short")
+	}
+	le := binary.LittleEndian
+	length := int(le.Uint16(b))
+	valueLength := int(le.Uint16(b[2:]))
+	blk.isText = le.Uint16(b[4:]) == 1
+	if length > len(b) {
+		return blk, 0, fmt.Errorf("version block truncated")
+	}
+	if length < 6 {
+		length = len(b)
+	}
+	b = b[:length]
+
+	off := 6
+	var key []uint16
+	for off+1 < len(b) {
+		c := le.Uint16(b[off:])
+		off += 2
+		if c == 0 {
+			break
+		}
+		key = append(key, c)
+	}
+	blk.key = string(utf16.Decode(key))
+	off = align4(off)
+
+	valueSize := valueLength
+	if blk.isText {
+		valueSize *= 2
+	}
+	if off+valueSize > len(b) {
+		valueSize = len(b) - off
+	}
+	if valueSize > 0 {
+		blk.value = b[off : off+valueSize]
+	}
+	off = align4(off + valueSize)
+
+	for off < len(b) {
+		child, n, err := parseVersionBlock(b[off:])
+		if err != nil || n == 0 {
+			break
+		}
+		blk.children = append(blk.children, child)
+		off += align4(n)
+	}
+
+	return blk, length, nil
+}
+
+func utf16String(b []byte) string {
+	var s []uint16
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		s = append(s, c)
+	}
+	return strings.TrimSpace(string(utf16.Decode(s)))
+}
+
+func parseVersionInfo(data []byte) (*VersionInfo, error) {
+	root, _, err := parseVersionBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.key != "VS_VERSION_INFO" {
+		return nil, fmt.Errorf("unexpected version resource key %q", root.key)
+	}
+
+	info := &VersionInfo{}
+	le := binary.LittleEndian
+	if len(root.value) >= 52 && le.Uint32(root.value) == fixedInfoSignature {
+		v := root.value
+		info.FixedFileVersion = fmt.Sprintf("%d.%d.%d.%d",
+			le.Uint32(v[8:])>>16, le.Uint32(v[8:])&0xFFFF,
+			le.Uint32(v[12:])>>16, le.Uint32(v[12:])&0xFFFF)
+		info.FixedProductVersion = fmt.Sprintf("%d.%d.%d.%d",
+			le.Uint32(v[16:])>>16, le.Uint32(v[16:])&0xFFFF,
+			le.Uint32(v[20:])>>16, le.Uint32(v[20:])&0xFFFF)
+	}
+
+	for _, child := range root.children {
+		if child.key != "StringFileInfo" || len(child.children) == 0 {
+			continue
+		}
+		// Prefer the US English table when a file carries several.
+		table := child.children[0]
+		for _, t := range child.children {
+			if strings.HasPrefix(strings.ToLower(t.key), "0409") {
+				table = t
+				break
+			}
+		}
+		for _, s := range table.children {
+			value := utf16String(s.value)
+			switch s.key {
+			case "FileVersion":
+				info.FileVersion = value
+			case "ProductVersion":
+				info.ProductVersion = value
+			case "ProductName":
+				info.ProductName = value
+			case "CompanyName":
+				info.CompanyName = value
+			case "FileDescription":
+				info.FileDescription = value
+			case "OriginalFilename":
+				info.OriginalFilename = value
+			case "LegalCopyright":
+				info.LegalCopyright = value
+			}
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,152 @@
+package pe
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nexus/internal/pe/petest"
+)
+
+func writePE(t *testing.T, f petest.File) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "setup.exe")
+	if err := os.WriteFile(path, f.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadVersionInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    []byte
+		want    VersionInfo
+		version string
+	}{
+		{
+			name: "strings",
+			info: petest.VersionInfo([4]uint16{24, 9, 0, 0},
+				"CompanyName", "Igor Pavlov",
+				"FileDescription", "7-Zip Installer",
+				"FileVersion", "24.09",
+				"ProductName", "7-Zip",
+				"ProductVersion", "24.09 (x64)",
+			),
+			want: VersionInfo{
+				FileVersion:         "24.09",
+				ProductVersion:      "24.09 (x64)",
+				ProductName:         "7-Zip",
+				CompanyName:         "Igor Pavlov",
+				FileDescription:     "7-Zip Installer",
+				FixedFileVersion:    "24.9.0.0",
+				FixedProductVersion: "24.9.0.0",
+			},
+			version: "24.09",
+		},
+		{
+			name: "fixed only",
+			info: petest.VersionInfo([4]uint16{1, 2, 3, 4}),
+			want: VersionInfo{
+				FixedFileVersion:    "1.2.3.4",
+				FixedProductVersion: "1.2.3.4",
+			},
+			version: "1.2.3.4",
+		},
+		{
+			name: "comma separated",
+			info: petest.VersionInfo([4]uint16{8, 6, 0, 0},
+				"ProductVersion", "8, 6, 0, 0",
+				"CompanyName", "Don Ho",
+				"ProductName", "Notepad++ ",
+			),
+			want: VersionInfo{
+				ProductVersion:      "8, 6, 0, 0",
+				ProductName:         "Notepad++",
+				CompanyName:         "Don Ho",
+				FixedFileVersion:    "8.6.0.0",
+				FixedProductVersion: "8.6.0.0",
+			},
+			version: "8.6.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePE(t, petest.File{
+				Sections:    []petest.Section{{Name: ".text", Data: []byte{0xC3}}},
+				VersionInfo: tt.info,
+			})
+			info, err := ReadVersionInfo(path)
+			if err != nil {
+				t.Fatalf("ReadVersionInfo: %v", err)
+			}
+			if *info != tt.want {
+				t.Errorf("ReadVersionInfo = %+v, want %+v", *info, tt.want)
+			}
+			if got := info.Version(); got != tt.version {
+				t.Errorf("Version = %q, want %q", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestReadVersionInfoDamaged(t *testing.T) {
+	info := petest.VersionInfo([4]uint16{1, 0, 0, 0}, "ProductName", "Example", "CompanyName", "Example Ltd")
+	text := []petest.Section{{Name: ".text", Data: []byte{0xC3}}}
+	le := binary.LittleEndian
+
+	tests := []struct {
+		name string
+		file func() []byte
+	}{
+		{"no resources", func() []byte {
+			return petest.File{Sections: text}.Bytes()
+		}},
+		{"resource larger than its section", func() []byte {
+			b := petest.File{Sections: text, VersionInfo: info}.Bytes()
+			// The data entry of the resource section, which follows .text.
+			le.PutUint32(b[0x400+0x48+4:], 0x10000)
+			return b
+		}},
+		{"resource directory out of range", func() []byte {
+			b := petest.File{Sections: text, VersionInfo: info}.Bytes()
+			le.PutUint32(b[0x400+20:], 0x80000000|0xFFF0)
+			return b
+		}},
+		{"wrong root key", func() []byte {
+			b := petest.File{Sections: text, VersionInfo: info}.Bytes()
+			b[0x400+0x58+6] = 'X'
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "setup.exe")
+			if err := os.WriteFile(path, tt.file(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := ReadVersionInfo(path); err == nil {
+				t.Errorf("ReadVersionInfo = %+v, want an error", *info)
+			}
+		})
+	}
+}
+
+// Every prefix of a version resource must parse without a panic, keeping
+// whatever strings are complete.
+func TestParseVersionInfoTruncated(t *testing.T) {
+	data := petest.VersionInfo([4]uint16{1, 2, 3, 4}, "CompanyName", "Example Ltd", "ProductName", "Example")
+	for n := 0; n < len(data); n++ {
+		info, err := parseVersionInfo(data[:n])
+		if err != nil {
+			continue
+		}
+		if info.ProductName != "" && info.ProductName != "Example" {
+			t.Errorf("%d bytes: ProductName = %q", n, info.ProductName)
+		}
+	}
+	if _, err := parseVersionInfo(data[:4]); err == nil {
+		t.Error("parseVersionInfo of 4 bytes succeeded")
+	}
+}
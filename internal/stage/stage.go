@@ -0,0 +1,94 @@
+package stage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"nexus/internal/fsutil"
+	"nexus/internal/history"
+)
+
+// Dir is a temporary directory a package is built in. It sits next to the
+// package, on the same volume, so a finished build can be renamed into
+// place in one step.
+type Dir struct {
+	Path   string
+	target string
+}
+
+// New creates an empty staging directory for the package directory
+// target.
+func New(target string) (*Dir, error) {
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", parent, err)
+	}
+	p, err := os.MkdirTemp(parent, "."+filepath.Base(target)+".build-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	return &Dir{Path: p, target: target}, nil
+}
+
+// IsStaging reports whether name is a staging directory rather than a
+// package.
+func IsStaging(name string) bool {
+	return len(name) > 0 && name[0] == '.'
+}
+
+// Copy copies the current package into the staging directory, leaving out
+// the named files and folders.
+func (d *Dir) Copy(skip ...string) error {
+	entries, err := os.ReadDir(d.target)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if slices.Contains(skip, e.Name()) {
+			continue
+		}
+		if err := fsutil.CopyTree(filepath.Join(d.target, e.Name()), filepath.Join(d.Path, e.Name())); err != nil {
+			return fmt.Errorf("failed to stage %s: %v", e.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Discard removes the staging directory and everything built in it.
+func (d *Dir) Discard() error {
+	return os.RemoveAll(d.Path)
+}
+
+// Commit moves the staged package into place. An existing package is
+// first moved out of the way by setAside, which returns where it went, and
+// its build history is carried over. If the staged package cannot be moved
+// into place, the existing one is put back.
+func (d *Dir) Commit(setAside func(dir string) (string, error)) (string, error) {
+	var previous string
+	if _, err := os.Stat(d.target); err == nil {
+		if previous, err = setAside(d.target); err != nil {
+			return "", err
+		}
+		// The previous package may have been copied to another volume, so
+		// it is put back the same way.
+		if err := history.Carry(previous, d.Path); err != nil {
+			if fsutil.Move(previous, d.target) != nil {
+				return "", fmt.Errorf("%v; the previous package is in %s", err, previous)
+			}
+			return "", err
+		}
+	}
+
+	if err := os.Rename(d.Path, d.target); err != nil {
+		if previous != "" {
+			history.Carry(d.Path, previous)
+			if fsutil.Move(previous, d.target) != nil {
+				return "", fmt.Errorf("failed to move the build into place: %v; the previous package is in %s", err, previous)
+			}
+		}
+		return "", fmt.Errorf("failed to move the build into place: %v", err)
+	}
+	return previous, nil
+}
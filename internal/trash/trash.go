@@ -0,0 +1,129 @@
+package trash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nexus/internal/fsutil"
+)
+
+// stampFormat is appended to the package ID, after an underscore, to name
+// an entry. Package IDs never contain underscores, so the split is
+// unambiguous.
+const stampFormat = "20060102-150405"
+
+// Entry is a package directory that was moved to the trash.
+type Entry struct {
+	ID      string
+	Name    string
+	Path    string
+	Deleted time.Time
+}
+
+// Move moves the package directory dir into trashDir and returns the new
+// entry. Directories on another volume are copied and then removed.
+func Move(dir, trashDir string) (Entry, error) {
+	if err := os.MkdirAll(trashDir, 0755); err != nil {
+		return Entry{}, fmt.Errorf("failed to create trash directory: %v", err)
+	}
+
+	now := time.Now()
+	id := filepath.Base(dir)
+	name := id + "_" + now.Format(stampFormat)
+	target := filepath.Join(trashDir, name)
+	for i := 2; exists(target); i++ {
+		name = fmt.Sprintf("%s_%s-%d", id, now.Format(stampFormat), i)
+		target = filepath.Join(trashDir, name)
+	}
+
+	if err := fsutil.Move(dir, target); err != nil {
+		return Entry{}, fmt.Errorf("failed to move %s to the trash: %v", dir, err)
+	}
+	return Entry{ID: id, Name: name, Path: target, Deleted: now}, nil
+}
+
+// List returns the entries in trashDir, newest first.
+func List(trashDir string) ([]Entry, error) {
+	dirs, err := os.ReadDir(trashDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash directory: %v", err)
+	}
+
+	var entries []Entry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		id, stamp, ok := strings.Cut(d.Name(), "_")
+		if !ok {
+			continue
+		}
+		if len(stamp) > len(stampFormat) {
+			stamp = stamp[:len(stampFormat)]
+		}
+		deleted, err := time.ParseInLocation(stampFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{
+			ID:      id,
+			Name:    d.Name(),
+			Path:    filepath.Join(trashDir, d.Name()),
+			Deleted: deleted,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Deleted.Equal(entries[j].Deleted) {
+			return entries[i].Deleted.After(entries[j].Deleted)
+		}
+		return entries[i].Name > entries[j].Name
+	})
+	return entries, nil
+}
+
+// Find returns the entry named name, or else the newest entry of the
+// package with that ID.
+func Find(trashDir, name string) (Entry, error) {
+	entries, err := List(trashDir)
+	if err != nil {
+		return Entry{}, err
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+	for _, e := range entries {
+		if e.ID == name {
+			return e, nil
+		}
+	}
+	return Entry{}, fmt.Errorf("nothing in the trash for %s", name)
+}
+
+// Restore moves the entry back to dest, which must not exist.
+func Restore(e Entry, dest string) error {
+	if exists(dest) {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := fsutil.Move(e.Path, dest); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", e.Name, err)
+	}
+	return nil
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -1,40 +1,58 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"nexus/internal/appx"
+	"nexus/internal/authenticode"
+	"nexus/internal/cache"
+	"nexus/internal/checksum"
+	"nexus/internal/config"
+	"nexus/internal/download"
+	"nexus/internal/history"
+	"nexus/internal/installer"
+	"nexus/internal/intunewin"
+	"nexus/internal/manifest"
 	"nexus/internal/msi"
-
-	"syscall"
+	"nexus/internal/payload"
+	"nexus/internal/pe"
+	"nexus/internal/stage"
+	"nexus/internal/trash"
 
 	_ "embed"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
 	"github.com/spf13/cobra"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "nexus",
 	Short: "Nexus - Intune application management tool",
-	Run:   run_interactive,
+	RunE:  run_interactive,
+
+	SilenceUsage:  true,
+	SilenceErrors: true,
 }
 
 var (
@@ -51,28 +69,189 @@ var (
 			MarginBottom(1)
 )
 
-const (
-	nexusDir       = "C:\\ProgramData\\Nexus"
-	intuneUtilDir  = "C:\\ProgramData\\Nexus\\Tools"
-	intuneUtilPath = "C:\\ProgramData\\Nexus\\Tools\\IntuneWinAppUtil.exe"
-	intuneUtilUrl  = "https://github.com/microsoft/Microsoft-Win32-Content-Prep-Tool/raw/master/IntuneWinAppUtil.exe"
-	packagesDir    = "C:\\ProgramData\\Nexus\\Packages"
-	downloadsDir   = "C:\\ProgramData\\Nexus\\Downloads"
-)
-
 //go:embed "templates/Install-Script.ps1"
 var installScriptTemplate string
 
 func init() {
-	rootCmd.AddCommand(&cobra.Command{
+	configCmd := &cobra.Command{
 		Use:   "config",
 		Short: "Configure Nexus settings",
+	}
+	configCmd.AddCommand(&cobra.Command{
+		Use:           "list",
+		Short:         "Show every setting and where its value comes from",
+		Args:          cobra.NoArgs,
+		RunE:          run_config_list,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+	configCmd.AddCommand(&cobra.Command{
+		Use:           "get <key>",
+		Short:         "Print the value of a setting",
+		Args:          cobra.ExactArgs(1),
+		RunE:          run_config_get,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+	configCmd.AddCommand(&cobra.Command{
+		Use:           "set <key> <value>",
+		Short:         "Change a setting; an empty value restores the default",
+		Example:       "  nexus config set company Contoso\n  nexus config set proxy http://proxy:8080",
+		Args:          cobra.ExactArgs(2),
+		RunE:          run_config_set,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+	rootCmd.AddCommand(configCmd)
+
+	inspectCmd := &cobra.Command{
+		Use:           "inspect <file.intunewin>",
+		Aliases:       []string{"unpack"},
+		Short:         "Show what is inside an existing .intunewin file",
+		Args:          cobra.ExactArgs(1),
+		RunE:          run_inspect,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	inspectCmd.Flags().StringP("extract", "x", "", "Decrypt the payload and extract it to this directory")
+	rootCmd.AddCommand(inspectCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "msi <file.msi> [query]",
+		Short: "List the properties of an MSI or run a SELECT query against it",
+		Example: "  nexus msi setup.msi\n" +
+			"  nexus msi setup.msi \"SELECT `FileName`, `Version` FROM `File` WHERE `FileSize` > 1000000\"",
+		Args:          cobra.RangeArgs(1, 2),
+		RunE:          run_msi,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+
+	newCmd := &cobra.Command{
+		Use:   "new",
+		Short: "Create a package without the interactive wizard",
+		Example: "  nexus new --source ./7z2409-x64.msi\n" +
+			"  nexus new --name \"Notepad++\" --source https://example.com/npp.exe --install-args \"/S\"",
+		Args:          cobra.NoArgs,
+		RunE:          run_new,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	newCmd.Flags().StringP("name", "n", "", "Package name (detected from the installer when omitted)")
+	newCmd.Flags().StringP("source", "s", "", "Installer, folder or archive path, or a download URL")
+	newCmd.Flags().StringP("type", "t", "", "Installer type: MSI, EXE or MSIX (detected from the extension when omitted)")
+	newCmd.Flags().String("install-args", "", "Install arguments to use instead of the detected silent switches")
+	newCmd.Flags().StringP("output-dir", "o", "", "Directory to create the package in (defaults to the packages directory)")
+	newCmd.Flags().String("setup", "", "Setup file to run when a folder or archive holds several")
+	newCmd.Flags().String("checksum", "", "Expected SHA-256 or SHA-512 of the installer, folder setup file or archive; the build is refused on a mismatch")
+	newCmd.Flags().StringSlice("attach", nil, "Transforms (.mst) and patches (.msp) to ship with an MSI")
+	newCmd.Flags().BoolP("force", "f", false, "Replace the package if it already exists, moving the old one to the trash")
+	newCmd.MarkFlagRequired("source")
+	rootCmd.AddCommand(newCmd)
+
+	repackageCmd := &cobra.Command{
+		Use:   "repackage [package...]",
+		Short: "Rebuild the .intunewin of existing packages",
+		Example: "  nexus repackage 7-zip\n" +
+			"  nexus repackage --all",
+		RunE:          run_repackage,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	repackageCmd.Flags().BoolP("all", "a", false, "Repackage every package in the packages directory")
+	rootCmd.AddCommand(repackageCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "restore [package | trash entry]",
+		Short: "Bring back a package that was replaced, or list what is in the trash",
+		Example: "  nexus restore\n" +
+			"  nexus restore 7-zip\n" +
+			"  nexus restore 7-zip_20250114-093012",
+		Args:          cobra.MaximumNArgs(1),
+		RunE:          run_restore,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:           "history <package>",
+		Short:         "List the build snapshots of a package",
+		Args:          cobra.ExactArgs(1),
+		RunE:          run_history,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "rollback <package> <snapshot>",
+		Short: "Make an earlier build snapshot of a package current again",
+		Example: "  nexus rollback 7-zip 24.08.00.0\n" +
+			"  nexus rollback 7-zip 24.09.00.0+build-2\n" +
+			"  nexus rollback my-tool build-3",
+		Args:          cobra.ExactArgs(2),
+		RunE:          run_rollback,
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	})
+
+	listCmd := &cobra.Command{
+		Use:           "list",
+		Short:         "List packages with their version, type and build state",
+		Args:          cobra.NoArgs,
+		RunE:          run_list,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	listCmd.Flags().Bool("json", false, "Print the inventory as JSON")
+	rootCmd.AddCommand(listCmd)
+
+	infoCmd := &cobra.Command{
+		Use:           "info <package>",
+		Short:         "Show the details of a package",
+		Args:          cobra.ExactArgs(1),
+		RunE:          run_info,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	infoCmd.Flags().Bool("json", false, "Print the details as JSON")
+	rootCmd.AddCommand(infoCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the download cache",
+	}
+	cacheCmd.AddCommand(&cobra.Command{
+		Use:           "list",
+		Short:         "List the cached downloads, most recently used first",
+		Args:          cobra.NoArgs,
+		RunE:          run_cache_list,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	})
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached downloads that are too old or do not fit in a size limit",
+		Example: "  nexus cache prune --max-age 30d\n" +
+			"  nexus cache prune --max-size 2G\n" +
+			"  nexus cache prune --max-size 0 --max-age 0",
+		Args:          cobra.NoArgs,
+		RunE:          run_cache_prune,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	pruneCmd.Flags().String("max-size", "", "Keep the most recently used downloads that fit in this size, such as 500M or 2G")
+	pruneCmd.Flags().String("max-age", "", "Remove downloads not used for this long, such as 30d, 2w or 12h")
+	cacheCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(cacheCmd)
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		if errors.Is(err, errInterrupted) {
+			os.Exit(130)
+		}
+		os.Exit(1)
 	}
 }
 
@@ -89,12 +268,54 @@ type model struct {
 	validationErr string
 	productCode   string
 	version       string
+	publisher     string
+	exeInfo       *pe.VersionInfo
+	msiInfo       *msi.Identity
+	appxInfo      *appx.Manifest
+	framework     *installer.Framework
 	mode          string
-	packages      []string
+	packages      []packageRef
 	packages_dir  string
 	text_input    textinput.Model
 	help          help.Model
 	keymap        keymap
+
+	// Transforms and patches to ship with an MSI, as source paths.
+	attachments       []string
+	askingAttachments bool
+
+	// A payload is a folder or archive rather than a single installer.
+	// payloadDir holds its files (an extracted archive is staged in a
+	// temporary folder) and setupFile is the entry point within it.
+	payloadDir      string
+	setupFile       string
+	setupCandidates []string
+	pickingSetup    bool
+
+	// Settings from config.json. Install arguments given on the command
+	// line replace both the configured and the detected ones.
+	settings          *config.Config
+	customInstallArgs string
+
+	// SHA-256 of the installer or archive as it arrived, for nexus.json,
+	// and the checksum it must match when one was given. The SHA-512 is
+	// only computed to check a SHA-512 checksum.
+	sourceSHA256   string
+	sourceSHA512   string
+	expectedSum    checksum.Sum
+	askingChecksum bool
+
+	// A package with the same ID is only replaced once the user agrees.
+	// It is moved to the trash when the build starts, not before.
+	confirmingOverwrite bool
+	replacing           bool
+
+	// Key of the snapshot the build was saved under in the package history.
+	snapshot string
+
+	// Authenticode signature of the installer, checked against the
+	// signature policy before the package is built around it.
+	signature *authenticode.Signature
 }
 
 type keymap struct{}
@@ -110,10 +331,11 @@ func (k keymap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{k.ShortHelp()}
 }
 
-func initial_model() model {
+func initial_model(cfg *config.Config) model {
 	m := model{
 		step:         -1,
-		packages_dir: packagesDir,
+		packages_dir: cfg.Packages(),
+		settings:     cfg,
 	}
 
 	ti := textinput.New()
@@ -135,6 +357,9 @@ func initial_model() model {
 	return m
 }
 
+// installerTypes are the choices offered in step 1.
+var installerTypes = []string{"MSI", "EXE", "MSIX"}
+
 func validateInput(source, installerType, input string) error {
 	if source == "Download File" {
 		if !strings.HasPrefix(strings.ToLower(input), "https://") {
@@ -147,6 +372,15 @@ func validateInput(source, installerType, input string) error {
 			return fmt.Errorf("invalid file path: %v", err)
 		}
 
+		info, err := os.Stat(absPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file does not exist: %s", input)
+		}
+		// Folders and archives are payloads; their setup file is picked later.
+		if (err == nil && info.IsDir()) || payload.IsArchive(absPath) {
+			return nil
+		}
+
 		ext := strings.ToLower(filepath.Ext(absPath))
 		if installerType == "MSI" && ext != ".msi" {
 			return fmt.Errorf("file must have .msi extension")
@@ -154,9 +388,8 @@ func validateInput(source, installerType, input string) error {
 		if installerType == "EXE" && ext != ".exe" {
 			return fmt.Errorf("file must have .exe extension")
 		}
-
-		if _, err := os.Stat(absPath); os.IsNotExist(err) {
-			return fmt.Errorf("file does not exist: %s", input)
+		if installerType == "MSIX" && !appx.IsPackage(absPath) {
+			return fmt.Errorf("file must have %s extension", strings.Join(appx.Extensions, ", "))
 		}
 	}
 	return nil
@@ -165,7 +398,9 @@ func validateInput(source, installerType, input string) error {
 func (m model) Init() tea.Cmd {
 	packages, _ := get_existing_packages(m.packages_dir)
 	var suggestions []string
-	suggestions = append(suggestions, packages...)
+	for _, pkg := range packages {
+		suggestions = append(suggestions, pkg.Name)
+	}
 
 	common_apps := []string{
 		"Microsoft Office",
@@ -200,6 +435,257 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// askingPackageName reports whether step 2 is waiting for the package name.
+// Local installers are picked first so their product name can be offered
+// as the default; downloads are named before the URL is entered.
+func (m model) askingPackageName() bool {
+	if m.packageName != "" {
+		return false
+	}
+	return m.source != "Local File" || m.textInput != ""
+}
+
+func (m model) suggestedPackageName() string {
+	if m.appxInfo != nil {
+		return m.appxInfo.Title()
+	}
+	if m.msiInfo != nil {
+		return m.msiInfo.ProductName
+	}
+	if m.exeInfo != nil {
+		return m.exeInfo.Name()
+	}
+	return ""
+}
+
+func (m *model) applyMSIIdentity(id *msi.Identity) {
+	m.msiInfo = id
+	m.productCode = id.ProductCode
+	m.version = id.ProductVersion
+	m.publisher = id.Manufacturer
+}
+
+func (m *model) applyVersionInfo(info *pe.VersionInfo) {
+	m.exeInfo = info
+	m.version = info.Version()
+	m.publisher = info.CompanyName
+}
+
+func (m *model) applyAppxManifest(manifest *appx.Manifest) {
+	m.appxInfo = manifest
+	m.version = manifest.Version
+	m.publisher = manifest.PublisherName()
+}
+
+// installerExtension keeps the extension of MSIX/AppX packages, since
+// bundles must not be renamed to .msix; other installers are named after
+// their type.
+func (m model) installerExtension() string {
+	source := m.textInput
+	if u, err := url.Parse(source); err == nil && m.source == "Download File" {
+		source = u.Path
+	}
+	if m.source == "Download File" && payload.IsArchive(source) {
+		return strings.ToLower(filepath.Ext(source))
+	}
+	if m.installerType == "MSIX" && appx.IsPackage(source) {
+		return strings.ToLower(filepath.Ext(source))
+	}
+	return "." + strings.ToLower(m.installerType)
+}
+
+// installerFileName is where the installer lives in the package: the setup
+// file of a payload, or the single installer named after the package.
+func (m model) installerFileName() string {
+	if m.setupFile != "" {
+		return filepath.FromSlash(m.setupFile)
+	}
+	return sanitize_package_name(m.packageName) + m.installerExtension()
+}
+
+// setupExtensions are the files that can be the entry point of a payload.
+func setupExtensions(installerType string) []string {
+	switch installerType {
+	case "MSI":
+		return []string{".msi"}
+	case "MSIX":
+		return appx.Extensions
+	}
+	return []string{".exe"}
+}
+
+// stagePayload makes a local folder or archive available for picking the
+// setup file. Archives are extracted to a temporary folder.
+func (m *model) stagePayload(source string) error {
+	abs_source, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+
+	dir := abs_source
+	if payload.IsArchive(abs_source) {
+		if dir, err = os.MkdirTemp("", "nexus-payload-*"); err != nil {
+			return fmt.Errorf("failed to create staging folder: %v", err)
+		}
+		if _, err := payload.Extract(abs_source, dir); err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("failed to extract archive: %v", err)
+		}
+	}
+
+	files, err := payload.Files(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read payload: %v", err)
+	}
+	candidates := payload.SetupCandidates(files, setupExtensions(m.installerType)...)
+	if len(candidates) == 0 {
+		if dir != abs_source {
+			os.RemoveAll(dir)
+		}
+		return fmt.Errorf("no %s file found in %s", strings.Join(setupExtensions(m.installerType), ", "), source)
+	}
+
+	m.payloadDir = dir
+	m.setupFile = ""
+	m.setupCandidates = candidates
+	if len(candidates) == 1 {
+		m.setupFile = candidates[0]
+	} else {
+		m.pickingSetup = true
+		m.cursor = 0
+	}
+	return nil
+}
+
+// cleanupPayload removes the staging folder of an extracted archive.
+func (m model) cleanupPayload() {
+	if m.payloadDir != "" && m.source == "Local File" && payload.IsArchive(m.textInput) {
+		os.RemoveAll(m.payloadDir)
+	}
+}
+
+// detectInstaller reads the product details of the chosen installer and
+// offers its product name as the package name.
+func (m model) detectInstaller() (tea.Model, tea.Cmd) {
+	m.readSetupMetadata()
+	m.text_input.Reset()
+	m.text_input.SetValue(m.suggestedPackageName())
+	m.text_input.CursorEnd()
+	return m, nil
+}
+
+// readSetupMetadata reads the product details of the chosen installer
+// before it is copied into the package, ignoring anything unreadable.
+func (m *model) readSetupMetadata() {
+	setup_path := m.textInput
+	if m.payloadDir != "" {
+		setup_path = filepath.Join(m.payloadDir, filepath.FromSlash(m.setupFile))
+	}
+
+	switch m.installerType {
+	case "MSI":
+		if id, err := getMSIIdentity(setup_path); err == nil {
+			m.applyMSIIdentity(id)
+		}
+	case "MSIX":
+		if manifest, err := appx.ReadManifest(setup_path); err == nil {
+			m.applyAppxManifest(manifest)
+		}
+	case "EXE":
+		if info, err := pe.ReadVersionInfo(setup_path); err == nil {
+			m.applyVersionInfo(info)
+		}
+		if framework, err := installer.Detect(setup_path); err == nil {
+			m.framework = &framework
+		}
+	}
+}
+
+// finishSourceInput is called once the installer and package name are
+// known. It asks for the checksum the vendor publishes for the installer,
+// which can be skipped.
+func (m model) finishSourceInput() (tea.Model, tea.Cmd) {
+	m.askingChecksum = true
+	m.text_input.Reset()
+	m.text_input.SetValue(m.expectedSum.String())
+	m.text_input.CursorEnd()
+	m.text_input.Focus()
+	return m, nil
+}
+
+// finishChecksumInput asks for MSI attachments, the last question before
+// the package directory is checked.
+func (m model) finishChecksumInput() (tea.Model, tea.Cmd) {
+	if m.installerType == "MSI" {
+		m.askingAttachments = true
+		m.text_input.Reset()
+		m.text_input.SetValue(strings.Join(m.attachments, ";"))
+		m.text_input.Focus()
+		return m, nil
+	}
+	return m.preparePackageDir()
+}
+
+// parseAttachments splits a ;-separated list of .mst and .msp paths.
+func parseAttachments(value string) ([]string, error) {
+	var attachments []string
+	for _, part := range strings.Split(value, ";") {
+		part = strings.Trim(strings.TrimSpace(part), `"`)
+		if part == "" {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(part))
+		if ext != ".mst" && ext != ".msp" {
+			return nil, fmt.Errorf("%s is not a transform (.mst) or patch (.msp)", part)
+		}
+		abs_path, err := filepath.Abs(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file path: %v", err)
+		}
+		if _, err := os.Stat(abs_path); err != nil {
+			return nil, fmt.Errorf("file does not exist: %s", part)
+		}
+		attachments = append(attachments, abs_path)
+	}
+	return attachments, nil
+}
+
+// package_has_msi reports whether a package directory holds an MSI.
+func package_has_msi(package_dir string) bool {
+	entries, err := os.ReadDir(package_dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".msi") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m model) preparePackageDir() (tea.Model, tea.Cmd) {
+	sanitized_name := sanitize_package_name(m.packageName)
+	package_dir := filepath.Join(m.packages_dir, sanitized_name)
+
+	if _, err := os.Stat(package_dir); err == nil && !m.replacing {
+		m.confirmingOverwrite = true
+		m.outputDir = package_dir
+		m.cursor = 0
+		m.validationErr = ""
+		m.text_input.Blur()
+		return m, nil
+	}
+
+	m.outputDir = package_dir
+	m.step++
+	m.typing = false
+	m.cursor = 0
+	m.validationErr = ""
+	m.text_input.Blur()
+	return m, nil
+}
+
 func get_path_suggestions(current_path string) []string {
 	var suggestions []string
 
@@ -259,7 +745,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case tea.KeyEnter:
 				input := m.text_input.Value()
 				if input == "" {
-					input = packagesDir
+					input = config.DefaultPackagesDir()
 				}
 
 				if err := os.MkdirAll(input, 0755); err != nil {
@@ -291,12 +777,122 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		if m.step == 2 && m.mode != "Repackage Application" && m.packageName == "" {
+		if m.step == 2 && m.pickingSetup {
+			switch msg.String() {
+			case "up", "k":
+				if m.cursor > 0 {
+					m.cursor--
+				}
+			case "down", "j":
+				if m.cursor < len(m.setupCandidates)-1 {
+					m.cursor++
+				}
+			case "enter":
+				m.setupFile = m.setupCandidates[m.cursor]
+				m.pickingSetup = false
+				m.cursor = 0
+				if m.packageName == "" {
+					return m.detectInstaller()
+				}
+				return m.finishSourceInput()
+			}
+			return m, nil
+		}
+
+		if m.step == 2 && m.confirmingOverwrite {
+			switch msg.String() {
+			case "up", "k":
+				if m.cursor > 0 {
+					m.cursor--
+				}
+			case "down", "j":
+				if m.cursor < 1 {
+					m.cursor++
+				}
+			case "enter":
+				m.confirmingOverwrite = false
+				if m.cursor == 1 {
+					m.replacing = true
+					return m.preparePackageDir()
+				}
+				m.text_input.Reset()
+				m.text_input.SetValue(m.packageName)
+				m.text_input.CursorEnd()
+				m.text_input.Focus()
+				m.packageName = ""
+				m.outputDir = ""
+				m.cursor = 0
+			}
+			return m, nil
+		}
+
+		if m.step == 2 && m.askingChecksum {
+			switch msg.Type {
+			case tea.KeyEnter:
+				sum, err := checksum.Parse(m.text_input.Value())
+				if err != nil {
+					m.validationErr = err.Error()
+					return m, nil
+				}
+				m.expectedSum = sum
+				m.askingChecksum = false
+				m.validationErr = ""
+				m.text_input.Reset()
+				return m.finishChecksumInput()
+			default:
+				var cmd tea.Cmd
+				m.text_input, cmd = m.text_input.Update(msg)
+				return m, cmd
+			}
+		}
+
+		if m.step == 2 && m.askingAttachments {
+			switch msg.Type {
+			case tea.KeyEnter:
+				attachments, err := parseAttachments(m.text_input.Value())
+				if err != nil {
+					m.validationErr = err.Error()
+					return m, nil
+				}
+				m.attachments = attachments
+				m.askingAttachments = false
+				m.validationErr = ""
+				m.text_input.Reset()
+				if m.mode == "Repackage Application" {
+					m.step = 3
+					m.cursor = 0
+					return m, nil
+				}
+				return m.preparePackageDir()
+			default:
+				if msg.String() == "tab" {
+					value := m.text_input.Value()
+					prefix, current := "", value
+					if i := strings.LastIndex(value, ";"); i >= 0 {
+						prefix, current = value[:i+1], value[i+1:]
+					}
+					var suggestions []string
+					for _, suggestion := range get_path_suggestions(current) {
+						suggestions = append(suggestions, prefix+suggestion)
+					}
+					m.text_input.SetSuggestions(suggestions)
+				}
+
+				var cmd tea.Cmd
+				m.text_input, cmd = m.text_input.Update(msg)
+				return m, cmd
+			}
+		}
+
+		if m.step == 2 && m.mode != "Repackage Application" && m.askingPackageName() {
 			switch msg.Type {
 			case tea.KeyEnter:
 				m.packageName = m.text_input.Value()
 				m.text_input.Reset()
 				m.text_input.Focus()
+				if m.textInput != "" {
+					return m.finishSourceInput()
+				}
 				return m, nil
 			default:
 				var cmd tea.Cmd
@@ -305,7 +901,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
-		if m.step == 2 && m.mode != "Repackage Application" && m.packageName != "" {
+		if m.step == 2 && m.mode != "Repackage Application" && !m.askingPackageName() {
 			switch msg.Type {
 			case tea.KeyEnter:
 				input := m.text_input.Value()
@@ -314,39 +910,29 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
+				m.cleanupPayload()
 				m.textInput = input
+				m.validationErr = ""
+				m.payloadDir = ""
+				m.setupFile = ""
 
-				sanitized_name := sanitize_package_name(m.packageName)
-				package_dir := filepath.Join(m.packages_dir, sanitized_name)
-
-				if _, err := os.Stat(package_dir); err == nil {
-					entries, err := os.ReadDir(filepath.Dir(package_dir))
-					if err == nil {
-						prefix := filepath.Base(package_dir)
-						for _, entry := range entries {
-							if strings.HasPrefix(entry.Name(), prefix) {
-								os.RemoveAll(filepath.Join(filepath.Dir(package_dir), entry.Name()))
-							}
+				if m.source == "Local File" {
+					if info, err := os.Stat(input); err == nil && (info.IsDir() || payload.IsArchive(input)) {
+						if err := m.stagePayload(input); err != nil {
+							m.validationErr = err.Error()
+							return m, nil
+						}
+						if m.pickingSetup {
+							return m, nil
 						}
-					}
-					if err := os.RemoveAll(package_dir); err != nil {
-						m.err = fmt.Errorf("failed to remove existing package directory: %v", err)
-						return m, tea.Quit
 					}
 				}
 
-				if err := os.MkdirAll(package_dir, 0755); err != nil {
-					m.err = err
-					return m, tea.Quit
+				if m.packageName == "" {
+					return m.detectInstaller()
 				}
 
-				m.outputDir = package_dir
-				m.step++
-				m.typing = false
-				m.cursor = 0
-				m.validationErr = ""
-				m.text_input.Blur()
-				return m, nil
+				return m.finishSourceInput()
 			default:
 				if msg.String() == "tab" {
 					suggestions := get_path_suggestions(m.text_input.Value())
@@ -363,7 +949,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			switch msg.Type {
 			case tea.KeyEnter:
 				if m.textInput == "" {
-					m.textInput = packagesDir
+					m.textInput = config.DefaultPackagesDir()
 				}
 
 				if err := os.MkdirAll(m.textInput, 0755); err != nil {
@@ -404,9 +990,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			case "enter":
 				if m.cursor == 0 {
-					m.packages_dir = packagesDir
+					m.packages_dir = config.DefaultPackagesDir()
 
-					if err := save_config(packagesDir); err != nil {
+					if err := save_config(""); err != nil {
 						m.validationErr = fmt.Sprintf("Failed to save configuration: %v", err)
 						return m, nil
 					}
@@ -416,7 +1002,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				} else {
 					m.typing = true
 					m.text_input.Reset()
-					m.text_input.SetValue(packagesDir)
+					m.text_input.SetValue(config.DefaultPackagesDir())
 					m.text_input.Focus()
 				}
 			}
@@ -453,35 +1039,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
-				sanitized_name := sanitize_package_name(m.packageName)
-				package_dir := filepath.Join(m.packages_dir, sanitized_name)
-
-				if _, err := os.Stat(package_dir); err == nil {
-					entries, err := os.ReadDir(filepath.Dir(package_dir))
-					if err == nil {
-						prefix := filepath.Base(package_dir)
-						for _, entry := range entries {
-							if strings.HasPrefix(entry.Name(), prefix) {
-								os.RemoveAll(filepath.Join(filepath.Dir(package_dir), entry.Name()))
-							}
-						}
-					}
-					if err := os.RemoveAll(package_dir); err != nil {
-						m.err = fmt.Errorf("failed to remove existing package directory: %v", err)
-						return m, tea.Quit
-					}
-				}
-
-				if err := os.MkdirAll(package_dir, 0755); err != nil {
-					m.err = err
-					return m, tea.Quit
-				}
-				m.outputDir = package_dir
-				m.step++
-				m.typing = false
-				m.cursor = 0
-				m.validationErr = ""
-				return m, nil
+				return m.preparePackageDir()
 			case tea.KeyBackspace:
 				if len(m.textInput) > 0 {
 					m.textInput = m.textInput[:len(m.textInput)-1]
@@ -503,10 +1061,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			case "enter":
 				if len(m.packages) > 0 {
-					m.packageName = m.packages[m.cursor]
-					sanitized_name := sanitize_package_name(m.packageName)
-					package_dir := filepath.Join(m.packages_dir, sanitized_name)
+					m.packageName = m.packages[m.cursor].Name
+					package_dir := filepath.Join(m.packages_dir, m.packages[m.cursor].ID)
 					m.outputDir = package_dir
+					if package_has_msi(package_dir) {
+						m.askingAttachments = true
+						m.text_input.Reset()
+						m.text_input.Focus()
+						return m, nil
+					}
 					m.step = 3
 					m.cursor = 0
 					return m, nil
@@ -526,9 +1089,6 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.cursor == 0 {
 					return m, tea.Quit
 				} else {
-					if m.outputDir != "" {
-						os.RemoveAll(m.outputDir)
-					}
 					m.step = 0
 					m.cursor = 0
 					m.source = ""
@@ -536,6 +1096,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.textInput = ""
 					m.typing = false
 					m.outputDir = ""
+					m.version = ""
+					m.productCode = ""
+					m.publisher = ""
+					m.exeInfo = nil
+					m.msiInfo = nil
+					m.appxInfo = nil
+					m.attachments = nil
+					m.replacing = false
+					m.cleanupPayload()
+					m.payloadDir = ""
+					m.setupFile = ""
+					m.setupCandidates = nil
+					m.framework = nil
 					return m, nil
 				}
 			}
@@ -551,10 +1124,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					if m.cursor < 2 {
 						m.cursor++
 					}
-				case 0, 1:
+				case 0:
 					if m.cursor < 1 {
 						m.cursor++
 					}
+				case 1:
+					if m.cursor < len(installerTypes)-1 {
+						m.cursor++
+					}
 				}
 			case "enter":
 				switch m.step {
@@ -588,7 +1165,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.step++
 					m.cursor = 0
 				case 1:
-					m.installerType = []string{"MSI", "EXE"}[m.cursor]
+					m.installerType = installerTypes[m.cursor]
 					m.step++
 					m.cursor = 0
 				}
@@ -598,30 +1175,147 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func getScriptContent(installerType, packageName, version string) (install, uninstall string) {
-	install = installScriptTemplate
-	install = strings.ReplaceAll(install, "<APP_TITLE>", packageName)
-	if version == "" {
-		version = "1.0"
-	}
-	install = strings.ReplaceAll(install, "<VERSION>", version)
-	install = strings.ReplaceAll(install, "<INSTALLER_TYPE>", installerType)
+// psEscape makes a value safe to embed in a double-quoted PowerShell string.
+func psEscape(value string) string {
+	return strings.NewReplacer("`", "``", "\"", "`\"", "$", "`$").Replace(value)
+}
+
+// scriptInfo carries what the generated Install.ps1 and Uninstall.ps1 need
+// to know about the package.
+type scriptInfo struct {
+	installerType string
+	installerFile string
+	packageName   string
+	version       string
+	publisher     string
+	installArgs   string
+	uninstallArgs string
+	company       string
+	// EXE only: the name the application is registered under, and whether
+	// the packaged setup file is what uninstalls it.
+	productName        string
+	uninstallWithSetup bool
+	// MSI only.
+	productCode string
+	upgradeCode string
+	platform    string
+	transforms  []string
+	patches     []string
+	// MSIX only.
+	identityName string
+}
 
-	defaultArgs := "/qn /norestart"
-	if installerType == "EXE" {
-		defaultArgs = "/silent"
+func (m model) scriptInfo() scriptInfo {
+	info := scriptInfo{
+		installerType: m.installerType,
+		installerFile: strings.ReplaceAll(m.installerFileName(), "/", "\\"),
+		packageName:   m.packageName,
+		version:       m.version,
+		publisher:     m.publisher,
+		installArgs:   m.installArgs(),
+		uninstallArgs: m.uninstallArgs(),
+		company:       m.settings.CompanyName(),
 	}
-	install = strings.ReplaceAll(install, "<INSTALL_ARGS>", defaultArgs)
+	if m.msiInfo != nil {
+		info.productCode = m.msiInfo.ProductCode
+		info.upgradeCode = m.msiInfo.UpgradeCode
+		info.platform = m.msiInfo.Platform
+	}
+	info.transforms, info.patches = splitAttachments(m.attachments)
+	if info.productName = m.packageName; m.exeInfo != nil && m.exeInfo.Name() != "" {
+		info.productName = m.exeInfo.Name()
+	}
+	if m.framework != nil {
+		info.uninstallWithSetup = m.framework.UninstallWithSetup
+	}
+	if m.appxInfo != nil {
+		info.identityName = m.appxInfo.Name
+		info.platform = m.appxInfo.Architecture
+	}
+	return info
+}
 
-	if installerType == "MSI" {
-		uninstall = fmt.Sprintf(`
-$company = "Nexus"
-$app_title = "%s"
-$logging_path = "C:\ProgramData\$company\$app_title"
-$script_name = (Get-Item $PSCommandPath).Basename
-$log_file = "$logging_path\$script_name.log"
+// splitAttachments returns the file names of the transforms and patches
+// among attachments, keeping their order.
+func splitAttachments(attachments []string) (transforms, patches []string) {
+	for _, attachment := range attachments {
+		name := filepath.Base(attachment)
+		if strings.EqualFold(filepath.Ext(name), ".msp") {
+			patches = append(patches, name)
+		} else {
+			transforms = append(transforms, name)
+		}
+	}
+	return
+}
 
-function write_log {
+// installArgs returns the silent switches for the installer: the
+// configured msiexec arguments for MSIs, the detected framework's for EXEs
+// and the configured EXE arguments when the framework is unknown. MSIX
+// packages take none.
+func (m model) installArgs() string {
+	if m.installerType == "MSIX" {
+		return ""
+	}
+	if m.customInstallArgs != "" {
+		return m.customInstallArgs
+	}
+	if m.installerType == "MSI" {
+		return m.settings.MSIInstallArgs()
+	}
+	if m.framework != nil && m.framework.Name != installer.Unknown.Name {
+		return m.framework.InstallArgs
+	}
+	if m.settings.EXEArgs != "" {
+		return m.settings.EXEArgs
+	}
+	return installer.Unknown.InstallArgs
+}
+
+func (m model) uninstallArgs() string {
+	if m.installerType == "MSIX" {
+		return ""
+	}
+	if m.installerType == "MSI" {
+		return "/qn /norestart"
+	}
+	if m.framework != nil {
+		return m.framework.UninstallArgs
+	}
+	return installer.Unknown.UninstallArgs
+}
+
+func getScriptContent(info scriptInfo) (install, uninstall string) {
+	packageName, version, publisher := info.packageName, info.version, info.publisher
+
+	install = installScriptTemplate
+	install = strings.ReplaceAll(install, "<APP_TITLE>", psEscape(packageName))
+	if version == "" {
+		version = "1.0"
+	}
+	install = strings.ReplaceAll(install, "<VERSION>", psEscape(version))
+	install = strings.ReplaceAll(install, "<PUBLISHER>", psEscape(publisher))
+	install = strings.ReplaceAll(install, "<INSTALLER_TYPE>", info.installerType)
+	install = strings.ReplaceAll(install, "<INSTALLER_FILE>", psEscape(info.installerFile))
+	install = strings.ReplaceAll(install, "<INSTALL_ARGS>", psEscape(info.installArgs))
+	install = strings.ReplaceAll(install, "<PRODUCT_CODE>", psEscape(info.productCode))
+	install = strings.ReplaceAll(install, "<UPGRADE_CODE>", psEscape(info.upgradeCode))
+	install = strings.ReplaceAll(install, "<PLATFORM>", psEscape(info.platform))
+	install = strings.ReplaceAll(install, "<TRANSFORMS>", psEscape(strings.Join(info.transforms, ";")))
+	install = strings.ReplaceAll(install, "<PATCHES>", psEscape(strings.Join(info.patches, ";")))
+	install = strings.ReplaceAll(install, "<COMPANY>", psEscape(info.company))
+
+	if info.installerType == "MSI" {
+		uninstall = fmt.Sprintf(`
+$company = "<COMPANY>"
+$app_title = "%s"
+$version = "%s"
+$publisher = "%s"
+$logging_path = "C:\ProgramData\$company\$app_title"
+$script_name = (Get-Item $PSCommandPath).Basename
+$log_file = "$logging_path\$script_name.log"
+
+function write_log {
     param ([string]$log_string)
     $timestamp = Get-Date
     $formatted_log = "$timestamp $log_string"
@@ -633,24 +1327,93 @@ function write_log {
     }
 }
 
-write_log "Starting uninstall of $app_title"
-$product_code = "%s" # To be replaced with actual product code
+write_log "Starting uninstall of $app_title $version"
+$product_code = "%s"
+$upgrade_code = "%s"
+$uninstall_args = "%s"
+
+# Anything installed under the same upgrade code is this application,
+# whichever version of it is on the machine.
+$product_codes = @($product_code)
+if ($upgrade_code) {
+    try {
+        $windows_installer = New-Object -ComObject WindowsInstaller.Installer
+        $related = @($windows_installer.RelatedProducts($upgrade_code))
+        if ($related.Count -gt 0) {
+            $product_codes = $related
+        }
+    } catch {
+        write_log "Could not query products for upgrade code $($upgrade_code): $($_.Exception.Message)"
+    }
+}
+
 try {
-    $process = Start-Process "msiexec.exe" -ArgumentList "/x $product_code /qn /norestart" -Wait -PassThru
-    if ($process.ExitCode -eq 0) {
-        write_log "Successfully uninstalled $app_title"
-    } else {
-        write_log "Uninstall failed with exit code: $($process.ExitCode)"
-        exit 1
+    foreach ($code in $product_codes) {
+        write_log "Removing product $code"
+        $process = Start-Process "msiexec.exe" -ArgumentList "/x $code $uninstall_args" -Wait -PassThru
+        if ($process.ExitCode -eq 0 -or $process.ExitCode -eq 3010 -or $process.ExitCode -eq 1605) {
+            write_log "Successfully uninstalled $app_title ($code)"
+        } else {
+            write_log "Uninstall failed with exit code: $($process.ExitCode)"
+            exit 1
+        }
+    }
+} catch {
+    write_log "Error during uninstall: $($_.Exception.Message)"
+    exit 1
+}`, psEscape(packageName), psEscape(version), psEscape(publisher), psEscape(info.productCode), psEscape(info.upgradeCode), psEscape(info.uninstallArgs))
+	} else if info.installerType == "MSIX" {
+		uninstall = fmt.Sprintf(`
+$company = "<COMPANY>"
+$app_title = "%s"
+$version = "%s"
+$publisher = "%s"
+$logging_path = "C:\ProgramData\$company\$app_title"
+$script_name = (Get-Item $PSCommandPath).Basename
+$log_file = "$logging_path\$script_name.log"
+
+function write_log {
+    param ([string]$log_string)
+    $timestamp = Get-Date
+    $formatted_log = "$timestamp $log_string"
+    try {   
+        Add-content $log_file -value $formatted_log -ErrorAction SilentlyContinue
+    }
+    catch {
+        Write-Host $formatted_log
+    }
+}
+
+write_log "Starting uninstall of $app_title $version"
+$identity_name = "%s"
+try {
+    # Remove the provisioned package first so it is not installed again
+    # for users who sign in later, then remove it from existing users.
+    $provisioned = Get-AppxProvisionedPackage -Online | Where-Object { $_.DisplayName -eq $identity_name }
+    foreach ($package in $provisioned) {
+        write_log "Removing provisioned package $($package.PackageName)"
+        Remove-AppxProvisionedPackage -Online -PackageName $package.PackageName -AllUsers -ErrorAction Stop | Out-Null
     }
+    $installed = Get-AppxPackage -AllUsers -Name $identity_name
+    foreach ($package in $installed) {
+        write_log "Removing package $($package.PackageFullName)"
+        Remove-AppxPackage -Package $package.PackageFullName -AllUsers -ErrorAction Stop
+    }
+    write_log "Successfully uninstalled $app_title"
 } catch {
     write_log "Error during uninstall: $($_.Exception.Message)"
     exit 1
-}`, packageName, "{PRODUCT_CODE}")
+}`, psEscape(packageName), psEscape(version), psEscape(publisher), psEscape(info.identityName))
 	} else {
+		var setupFile string
+		if info.uninstallWithSetup {
+			setupFile = info.installerFile
+		}
 		uninstall = fmt.Sprintf(`
-$company = "Nexus"
+$company = "<COMPANY>"
 $app_title = "%s"
+$version = "%s"
+$publisher = "%s"
 $logging_path = "C:\ProgramData\$company\$app_title"
 $script_name = (Get-Item $PSCommandPath).Basename
 $log_file = "$logging_path\$script_name.log"
@@ -667,11 +1430,67 @@ function write_log {
     }
 }
 
-write_log "Starting uninstall of $app_title"
-$uninstall_path = "%s" # To be replaced with actual uninstall path
+write_log "Starting uninstall of $app_title $version"
+$product_name = "%s"
+$uninstall_args = "%s"
+# Set when the setup file in the package is what removes the application,
+# so the switches are meant for it rather than for an installed uninstaller.
+$setup_file = "%s"
+
+# Splits an uninstall command line into the program and its arguments.
+function split_command {
+    param ([string]$command)
+    if ($command -match '^\s*"([^"]+)"\s*(.*)$') {
+        return $matches[1], $matches[2]
+    }
+    if ($command -match '^\s*(.+?\.exe)\s*(.*)$') {
+        return $matches[1], $matches[2]
+    }
+    return $command, ""
+}
+
+# Finds the Uninstall registry entry of the application by its name, in
+# the 64-bit and the 32-bit view.
+function find_uninstall_entry {
+    $keys = @(
+        "HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall\*",
+        "HKLM:\SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall\*"
+    )
+    Get-ItemProperty $keys -ErrorAction SilentlyContinue |
+        Where-Object { $_.DisplayName -and ($_.DisplayName -eq $product_name -or $_.DisplayName.StartsWith("$product_name ")) } |
+        Select-Object -First 1
+}
+
 try {
-    $process = Start-Process $uninstall_path -ArgumentList "/silent" -Wait -PassThru
-    if ($process.ExitCode -eq 0) {
+    if ($setup_file) {
+        $uninstall_path = Join-Path $PSScriptRoot $setup_file
+        $arguments = $uninstall_args
+    } else {
+        $entry = find_uninstall_entry
+        if (-not $entry) {
+            write_log "No uninstall entry found for $product_name"
+            exit 1
+        }
+        if ($entry.QuietUninstallString) {
+            # Already silent, so no switches are added.
+            $uninstall_path, $arguments = split_command $entry.QuietUninstallString
+        } else {
+            $uninstall_path, $arguments = split_command $entry.UninstallString
+            if ($uninstall_path -match 'msiexec(\.exe)?$') {
+                $arguments = ($arguments -replace '/I', '/X') + " /qn /norestart"
+            } else {
+                $arguments = "$arguments $uninstall_args".Trim()
+            }
+        }
+    }
+
+    write_log "Running $uninstall_path $arguments"
+    $start = @{ FilePath = $uninstall_path; Wait = $true; PassThru = $true }
+    if ($arguments) {
+        $start.ArgumentList = $arguments
+    }
+    $process = Start-Process @start
+    if ($process.ExitCode -eq 0 -or $process.ExitCode -eq 3010) {
         write_log "Successfully uninstalled $app_title"
     } else {
         write_log "Uninstall failed with exit code: $($process.ExitCode)"
@@ -680,14 +1499,33 @@ try {
 } catch {
     write_log "Error during uninstall: $($_.Exception.Message)"
     exit 1
-}`, packageName, "C:\\Program Files\\AppName\\uninstall.exe")
+}`, psEscape(packageName), psEscape(version), psEscape(publisher), psEscape(info.productName), psEscape(info.uninstallArgs), psEscape(setupFile))
 	}
+	uninstall = strings.ReplaceAll(uninstall, "<COMPANY>", psEscape(info.company))
 
 	return
 }
 
-func createPackageScripts(outputDir, packageName, installerType string) error {
-	install, uninstall := getScriptContent(installerType, packageName, "1.0")
+// getDetectionScript returns an Intune custom detection script for MSIX
+// packages: the app counts as installed when any user has this version or
+// a later one.
+func getDetectionScript(info scriptInfo) string {
+	return fmt.Sprintf(`$identity_name = "%s"
+$version = "%s"
+
+$package = Get-AppxPackage -AllUsers -Name $identity_name |
+    Where-Object { [version]$_.Version -ge [version]$version } |
+    Select-Object -First 1
+if ($package) {
+    Write-Output "Detected $($package.PackageFullName)"
+    exit 0
+}
+exit 1
+`, psEscape(info.identityName), psEscape(info.version))
+}
+
+func createPackageScripts(outputDir string, info scriptInfo) error {
+	install, uninstall := getScriptContent(info)
 
 	installPath := filepath.Join(outputDir, "Install.ps1")
 	if err := os.WriteFile(installPath, []byte(install), 0644); err != nil {
@@ -699,6 +1537,13 @@ func createPackageScripts(outputDir, packageName, installerType string) error {
 		return fmt.Errorf("failed to create uninstall script: %v", err)
 	}
 
+	if info.installerType == "MSIX" {
+		detectionPath := filepath.Join(outputDir, "Detection.ps1")
+		if err := os.WriteFile(detectionPath, []byte(getDetectionScript(info)), 0644); err != nil {
+			return fmt.Errorf("failed to create detection script: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -713,7 +1558,7 @@ func (m model) View() string {
 		s += "Set Packages Directory:\n\n"
 		if m.typing {
 			m.text_input.Prompt = "Enter custom packages directory path: "
-			m.text_input.Placeholder = packagesDir
+			m.text_input.Placeholder = config.DefaultPackagesDir()
 			s += m.text_input.View()
 
 			if m.validationErr != "" {
@@ -752,7 +1597,7 @@ func (m model) View() string {
 		if len(recent_packages) > 0 {
 			s += "\n\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("#FF875F")).Render("Recent packages:")
 			for _, pkg := range recent_packages {
-				s += fmt.Sprintf("\n  • %s", pkg)
+				s += fmt.Sprintf("\n  • %s", pkg.Name)
 			}
 		}
 	case 0:
@@ -768,8 +1613,7 @@ func (m model) View() string {
 		}
 	case 1:
 		s += "Select Installer Type:\n\n"
-		choices := []string{"MSI", "EXE"}
-		for i, choice := range choices {
+		for i, choice := range installerTypes {
 			cursor := " "
 			if m.cursor == i {
 				cursor = "▸"
@@ -778,32 +1622,85 @@ func (m model) View() string {
 			s += fmt.Sprintf("%s %s\n", cursor, choice)
 		}
 	case 2:
-		if m.mode == "Repackage Application" {
+		if m.confirmingOverwrite {
+			s += fmt.Sprintf("A package named '%s' already exists:\n", filepath.Base(m.outputDir))
+			s += fmt.Sprintf("  %s\n\n", m.outputDir)
+			s += "Replacing it moves the current package to the trash, where\n"
+			s += "'nexus restore' can bring it back.\n\n"
+			choices := []string{"No, choose another name", "Yes, replace this package"}
+			for i, choice := range choices {
+				cursor := " "
+				if m.cursor == i {
+					cursor = "▸"
+					choice = selected_style.Render(choice)
+				}
+				s += fmt.Sprintf("%s %s\n", cursor, choice)
+			}
+		} else if m.pickingSetup {
+			s += "Select the setup file to run:\n\n"
+			for i, candidate := range m.setupCandidates {
+				cursor := " "
+				if m.cursor == i {
+					cursor = "▸"
+					candidate = selected_style.Render(candidate)
+				}
+				s += fmt.Sprintf("%s %s\n", cursor, candidate)
+			}
+		} else if m.askingChecksum {
+			s += "Enter the SHA-256 or SHA-512 the vendor publishes for this file, to refuse\n"
+			s += "the build if the installer does not match. Press Enter to skip.\n\n"
+			m.text_input.Prompt = "Expected checksum: "
+			m.text_input.Placeholder = "hex digest, optionally prefixed with sha256: or sha512:"
+			s += m.text_input.View()
+
+			if m.validationErr != "" {
+				s += "\n\n" + lipgloss.NewStyle().
+					Foreground(lipgloss.Color("#FF0000")).
+					Render("Error: "+m.validationErr)
+			}
+		} else if m.askingAttachments {
+			s += "Attach MSI transforms (.mst) or patches (.msp), in the order they apply.\n"
+			s += "Separate several files with ';', or press Enter for none.\n\n"
+			m.text_input.Prompt = "Transforms and patches: "
+			m.text_input.Placeholder = "C:\\path\\to\\vendor.mst;C:\\path\\to\\update.msp"
+			s += m.text_input.View()
+
+			if m.validationErr != "" {
+				s += "\n\n" + lipgloss.NewStyle().
+					Foreground(lipgloss.Color("#FF0000")).
+					Render("Error: "+m.validationErr)
+			}
+		} else if m.mode == "Repackage Application" {
 			s += "Select package to repackage:\n\n"
 			if len(m.packages) == 0 {
 				s += "No packages found."
 			} else {
+				id_style := lipgloss.NewStyle().Foreground(lipgloss.Color("#767676"))
 				for i, pkg := range m.packages {
 					cursor := " "
+					name := pkg.Name
 					if m.cursor == i {
 						cursor = "▸"
-						pkg = selected_style.Render(pkg)
+						name = selected_style.Render(name)
 					}
-					s += fmt.Sprintf("%s %s\n", cursor, pkg)
+					s += fmt.Sprintf("%s %s %s\n", cursor, name, id_style.Render(pkg.ID))
 				}
 			}
-		} else if m.packageName == "" {
+		} else if m.askingPackageName() {
+			if name := m.suggestedPackageName(); name != "" {
+				s += fmt.Sprintf("Detected: %s %s (%s)\n\n", name, m.version, m.publisher)
+			}
 			s += m.text_input.View()
 		} else {
-			label := "path to"
+			label, alternatives := "path to", ", folder or archive"
 			if m.source == "Download File" {
-				label = "download URL for"
+				label, alternatives = "download URL for", " or archive"
 				m.text_input.Placeholder = "https://example.com/installer.exe"
 			} else {
 				m.text_input.Placeholder = "C:\\path\\to\\installer.exe"
 			}
 
-			m.text_input.Prompt = fmt.Sprintf("Enter %s %s file: ", label, m.installerType)
+			m.text_input.Prompt = fmt.Sprintf("Enter %s %s file%s: ", label, m.installerType, alternatives)
 			s += m.text_input.View()
 
 			if m.validationErr != "" {
@@ -823,16 +1720,59 @@ func (m model) View() string {
 		if m.mode == "Repackage Application" {
 			s += fmt.Sprintf("%s• Operation: Repackage Existing Application\n", indent)
 			s += fmt.Sprintf("%s• Package Directory: %s\n", indent, m.outputDir)
+			for _, attachment := range m.attachments {
+				s += fmt.Sprintf("%s• Attach: %s\n", indent, describeAttachment(attachment, m.productCode))
+			}
 		} else {
 			s += fmt.Sprintf("%s• Type: %s\n", indent, m.installerType)
+			if name := m.suggestedPackageName(); name != "" {
+				s += fmt.Sprintf("%s• Product: %s\n", indent, name)
+				s += fmt.Sprintf("%s• Version: %s\n", indent, m.version)
+				if m.publisher != "" {
+					s += fmt.Sprintf("%s• Publisher: %s\n", indent, m.publisher)
+				}
+			}
+			if m.msiInfo != nil {
+				s += fmt.Sprintf("%s• Product Code: %s\n", indent, m.msiInfo.ProductCode)
+				if m.msiInfo.UpgradeCode != "" {
+					s += fmt.Sprintf("%s• Upgrade Code: %s\n", indent, m.msiInfo.UpgradeCode)
+				}
+				s += fmt.Sprintf("%s• Language: %s\n", indent, m.msiInfo.ProductLanguage)
+				s += fmt.Sprintf("%s• Platform: %s\n", indent, m.msiInfo.Platform)
+			}
+			if m.appxInfo != nil {
+				s += fmt.Sprintf("%s• Identity: %s\n", indent, m.appxInfo.Name)
+				s += fmt.Sprintf("%s• Architecture: %s\n", indent, strings.Join(m.appxInfo.Architectures, ", "))
+			}
+			for _, attachment := range m.attachments {
+				s += fmt.Sprintf("%s• Attach: %s\n", indent, describeAttachment(attachment, m.productCode))
+			}
+			if m.installerType == "EXE" {
+				if m.framework != nil {
+					s += fmt.Sprintf("%s• Framework: %s\n", indent, m.framework.Name)
+					s += fmt.Sprintf("%s• Silent Switches: %s\n", indent, m.installArgs())
+				} else if m.source == "Download File" {
+					s += fmt.Sprintf("%s• Framework: detected after download\n", indent)
+				}
+			}
+
+			if m.replacing {
+				s += fmt.Sprintf("%s• Replaces: %s (moved to the trash)\n", indent, m.outputDir)
+			}
 
 			s += lipgloss.NewStyle().Bold(true).Render("\nSource")
 			s += fmt.Sprintf("\n%s• Type: %s\n", indent, m.source)
 			if m.source == "Local File" {
 				s += fmt.Sprintf("%s• Path: %s\n", indent, m.textInput)
+				if m.setupFile != "" {
+					s += fmt.Sprintf("%s• Setup File: %s\n", indent, m.setupFile)
+				}
 			} else {
 				s += fmt.Sprintf("%s• URL: %s\n", indent, m.textInput)
 			}
+			if !m.expectedSum.IsZero() {
+				s += fmt.Sprintf("%s• Expected %s: %s\n", indent, m.expectedSum.Algorithm, m.expectedSum.Hex)
+			}
 		}
 
 		s += lipgloss.NewStyle().Bold(true).Render("\nConfirmation")
@@ -892,437 +1832,2011 @@ func copyFileToDir(source, destDir, filename string) error {
 	return nil
 }
 
-func getMSIProductCode(msiPath string) (string, string, error) {
-	msiPathW, err := syscall.UTF16PtrFromString(msiPath)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to convert path: %v", err)
-	}
-
-	var handle syscall.Handle
-	persist, _ := syscall.UTF16PtrFromString("0")
-	if err := msi.OpenDatabase(msiPathW, persist, &handle); err != nil {
-		return "", "", fmt.Errorf("failed to open MSI database: %v", err)
+// copyAttachments copies the transforms and patches into the package next
+// to the installer, keeping their file names.
+func copyAttachments(m model, indent string) error {
+	fmt.Printf("%s• Copying transforms and patches...\n", indent)
+	for _, attachment := range m.attachments {
+		fmt.Printf("%s  - %s\n", indent, describeAttachment(attachment, m.productCode))
+		if err := copyFileToDir(attachment, m.outputDir, filepath.Base(attachment)); err != nil {
+			return err
+		}
 	}
-	defer msi.CloseHandle(handle)
+	return nil
+}
 
-	productCode, err := getMSIProperty(handle, "ProductCode")
+// updateScriptAttachments adds attachments to the $transforms and $patches
+// variables of an existing Install.ps1, leaving the rest of the script and
+// any customizations in it untouched.
+func updateScriptAttachments(outputDir string, attachments []string) error {
+	script_path := filepath.Join(outputDir, "Install.ps1")
+	data, err := os.ReadFile(script_path)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get product code: %v", err)
+		return fmt.Errorf("failed to read install script: %v", err)
 	}
 
-	version, err := getMSIProperty(handle, "ProductVersion")
-	if err != nil {
-		return productCode, "", fmt.Errorf("failed to get version: %v", err)
-	}
+	content := string(data)
+	transforms, patches := splitAttachments(attachments)
+	for _, variable := range []struct {
+		name  string
+		files []string
+	}{{"transforms", transforms}, {"patches", patches}} {
+		if len(variable.files) == 0 {
+			continue
+		}
 
-	return productCode, version, nil
-}
+		pattern := regexp.MustCompile(`(?m)^\$` + variable.name + ` = "([^"]*)"`)
+		match := pattern.FindStringSubmatchIndex(content)
+		if match == nil {
+			return fmt.Errorf("Install.ps1 has no $%s variable, create the package again to attach files", variable.name)
+		}
 
-func getMSIProperty(handle syscall.Handle, property string) (string, error) {
-	var view syscall.Handle
-	query := fmt.Sprintf("SELECT `Value` FROM `Property` WHERE `Property` = '%s'", property)
-	queryW, _ := syscall.UTF16PtrFromString(query)
-	if err := msi.DatabaseOpenView(handle, queryW, &view); err != nil {
-		return "", fmt.Errorf("failed to open view: %v", err)
+		var files []string
+		for _, file := range strings.Split(content[match[2]:match[3]], ";") {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+		for _, file := range variable.files {
+			if file = psEscape(file); !contains(files, file) {
+				files = append(files, file)
+			}
+		}
+		content = content[:match[2]] + strings.Join(files, ";") + content[match[3]:]
 	}
-	defer msi.CloseHandle(view)
 
-	if err := msi.ViewExecute(view, 0); err != nil {
-		return "", fmt.Errorf("failed to execute view: %v", err)
+	if err := os.WriteFile(script_path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to update install script: %v", err)
 	}
+	return nil
+}
 
-	var record syscall.Handle
-	if err := msi.ViewFetch(view, &record); err != nil {
-		return "", fmt.Errorf("failed to fetch record: %v", err)
+// getMSIIdentity reads the product identity of an MSI: its codes, name,
+// manufacturer, language and target platform.
+func getMSIIdentity(msiPath string) (*msi.Identity, error) {
+	db, err := msi.Open(msiPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MSI database: %v", err)
 	}
-	defer msi.CloseHandle(record)
+	defer db.Close()
 
-	var buf [39]uint16
-	bufLen := uint32(len(buf))
-	if err := msi.RecordGetString(record, 1, &buf[0], &bufLen); err != nil {
-		return "", fmt.Errorf("failed to get property value: %v", err)
+	id, err := db.Identity()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product identity: %v", err)
 	}
 
-	return syscall.UTF16ToString(buf[:]), nil
+	return id, nil
 }
 
-func run_interactive(cmd *cobra.Command, args []string) {
-	if err := ensureNexusDirs(); err != nil {
-		fmt.Printf("Error setting up Nexus directories: %v\n", err)
-		return
-	}
+func printMSIIdentity(indent string, id *msi.Identity) {
+	fmt.Printf("%s  - Product: %s\n", indent, id.ProductName)
+	fmt.Printf("%s  - Manufacturer: %s\n", indent, id.Manufacturer)
+	fmt.Printf("%s  - Product Code: %s\n", indent, id.ProductCode)
+	fmt.Printf("%s  - Upgrade Code: %s\n", indent, id.UpgradeCode)
+	fmt.Printf("%s  - Version: %s\n", indent, id.ProductVersion)
+	fmt.Printf("%s  - Language: %s\n", indent, id.ProductLanguage)
+	fmt.Printf("%s  - Platform: %s\n", indent, id.Platform)
+}
 
-	if err := ensureIntuneUtil(); err != nil {
-		fmt.Printf("Error setting up Intune tools: %v\n", err)
-		return
+// describeAttachment summarises a transform or patch from its summary
+// information, warning when it does not apply to the package's product.
+func describeAttachment(path, productCode string) string {
+	name := filepath.Base(path)
+	if strings.EqualFold(filepath.Ext(path), ".msp") {
+		patch, err := msi.ReadPatchInfo(path)
+		if err != nil {
+			return fmt.Sprintf("%s (patch, unreadable: %v)", name, err)
+		}
+		s := fmt.Sprintf("%s (patch %s, targets %s)", name, patch.PatchCode, strings.Join(patch.TargetProductCodes, ", "))
+		if productCode != "" && !patch.Targets(productCode) {
+			s += " - warning: does not target this product"
+		}
+		return s
 	}
 
-	packages_dir, err := load_config()
+	transform, err := msi.ReadTransformInfo(path)
 	if err != nil {
-		fmt.Printf("Error loading configuration: %v\n", err)
-		packages_dir = packagesDir
+		return fmt.Sprintf("%s (transform, unreadable: %v)", name, err)
 	}
-
-	m := initial_model()
-	m.packages_dir = packages_dir
-
-	p := tea.NewProgram(m)
-	final_model, err := p.Run()
-	if err != nil {
-		fmt.Printf("Error running program: %v\n", err)
-		return
+	s := fmt.Sprintf("%s (transform for %s %s)", name, transform.TargetProductCode, transform.TargetVersion)
+	if productCode != "" && !strings.EqualFold(transform.TargetProductCode, productCode) {
+		s += " - warning: does not target this product"
 	}
+	return s
+}
 
-	finalModel := final_model.(model)
-	if finalModel.step == 3 && finalModel.cursor == 0 {
-		fmt.Println("\n" + titleStyle.Render("Creating Package"))
-		indent := "    "
-		sectionStyle := lipgloss.NewStyle().Bold(true)
-
-		sanitized_name := sanitize_package_name(finalModel.packageName)
-		intunewinFile := fmt.Sprintf("%s.intunewin", sanitized_name)
-		installerFile := fmt.Sprintf("%s.%s",
-			sanitized_name,
-			strings.ToLower(finalModel.installerType))
-
-		if finalModel.mode == "Repackage Application" {
-			fmt.Println("\n" + sectionStyle.Render("Actions:"))
-			fmt.Printf("%s• Analyzing existing package...\n", indent)
-			fmt.Printf("%s  - Package directory: %s\n", indent, finalModel.outputDir)
-
-			// Clean up existing .intunewin files
-			fmt.Printf("%s• Cleaning up existing package files...\n", indent)
-			files, err := os.ReadDir(finalModel.outputDir)
-			if err != nil {
-				fmt.Printf("Error reading package directory: %v\n", err)
-				return
-			}
-
-			// Delete any existing .intunewin files
-			for _, file := range files {
-				if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".intunewin") {
-					intunewin_path := filepath.Join(finalModel.outputDir, file.Name())
-					fmt.Printf("%s  - Removing: %s\n", indent, file.Name())
-					if err := os.Remove(intunewin_path); err != nil {
-						fmt.Printf("%s  - Warning: Failed to remove %s: %v\n", indent, file.Name(), err)
-					}
-				}
-			}
-
-			// Find the installer file
-			var installer_path string
-			var installer_file string
-			for _, file := range files {
-				if !file.IsDir() && (strings.HasSuffix(strings.ToLower(file.Name()), ".msi") ||
-					strings.HasSuffix(strings.ToLower(file.Name()), ".exe")) {
-					installer_path = filepath.Join(finalModel.outputDir, file.Name())
-					installer_file = file.Name()
-					fmt.Printf("%s  - Found installer: %s\n", indent, installer_file)
-					break
-				}
-			}
-
-			if installer_path == "" {
-				fmt.Printf("Error: No installer file found in package directory\n")
-				return
-			}
+func printAppxManifest(indent string, manifest *appx.Manifest) {
+	fmt.Printf("%s  - Display Name: %s\n", indent, manifest.Title())
+	fmt.Printf("%s  - Identity: %s\n", indent, manifest.Name)
+	fmt.Printf("%s  - Publisher: %s\n", indent, manifest.Publisher)
+	fmt.Printf("%s  - Version: %s\n", indent, manifest.Version)
+	fmt.Printf("%s  - Architecture: %s\n", indent, strings.Join(manifest.Architectures, ", "))
+	if manifest.Bundle {
+		fmt.Printf("%s  - Bundle: yes\n", indent)
+	}
+}
 
-			if strings.HasSuffix(strings.ToLower(installer_file), ".msi") {
-				finalModel.installerType = "MSI"
-			} else {
-				finalModel.installerType = "EXE"
-			}
+// intunewinFileName is the name the .intunewin gets next to its setup file.
+func intunewinFileName(setupFile string) string {
+	name := filepath.Base(setupFile)
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".intunewin"
+}
 
-			// Add a small delay to ensure file operations are complete
-			time.Sleep(500 * time.Millisecond)
+// script_installer_file returns the $installer_file an existing Install.ps1
+// runs, or "" for scripts that predate the variable.
+func script_installer_file(package_dir string) string {
+	return filepath.FromSlash(strings.ReplaceAll(script_variable(package_dir, "installer_file"), "\\", "/"))
+}
 
-			// Extract MSI metadata if applicable
-			if finalModel.installerType == "MSI" {
-				product_code, version, err := getMSIProductCode(installer_path)
-				if err != nil {
-					fmt.Printf("%s• Warning: Could not extract MSI metadata: %v\n", indent, err)
-					fmt.Printf("%s  - You may need to manually set detection rules in Intune\n", indent)
-				} else {
-					finalModel.productCode = product_code
-					finalModel.version = version
-					fmt.Printf("%s• Successfully extracted MSI metadata\n", indent)
-					fmt.Printf("%s  - Product Code: %s\n", indent, product_code)
-					fmt.Printf("%s  - Version: %s\n", indent, version)
-				}
-			}
+// script_variable returns the value a top-level variable is set to in the
+// Install.ps1 of a package, or "" when it is not set there.
+func script_variable(package_dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(package_dir, "Install.ps1"))
+	if err != nil {
+		return ""
+	}
+	match := regexp.MustCompile(`(?m)^\$` + regexp.QuoteMeta(name) + ` = "([^"]*)"`).FindStringSubmatch(string(data))
+	if match == nil {
+		return ""
+	}
+	return strings.NewReplacer("``", "`", "`\"", "\"", "`$", "$").Replace(match[1])
+}
 
-			// Generate new IntuneWin package
-			fmt.Printf("%s• Generating IntuneWin package...\n", indent)
-			fmt.Printf("%s  - Source: %s\n", indent, installer_path)
-			fmt.Printf("%s  - Output: %s\n", indent, finalModel.outputDir)
+// find_package_installer returns the installer of a package, relative to
+// its directory: the one Install.ps1 runs, or else the first top-level
+// installer.
+func find_package_installer(package_dir string) (string, error) {
+	if setup := script_installer_file(package_dir); setup != "" {
+		if _, err := os.Stat(filepath.Join(package_dir, setup)); err == nil {
+			return setup, nil
+		}
+	}
 
-			args := []string{
-				"-c", finalModel.outputDir,
-				"-s", installer_path,
-				"-o", finalModel.outputDir,
-				"-q",
-			}
-			cmd := exec.Command(intuneUtilPath, args...)
-			if output, err := cmd.CombinedOutput(); err != nil {
-				fmt.Printf("%s  - Error generating IntuneWin package: %v\n%s\n", indent, err, output)
-				return
-			}
-			fmt.Printf("%s  - IntuneWin package created successfully\n", indent)
-
-			// Completion message
-			fmt.Printf("%s• Package creation complete\n", indent)
-			fmt.Printf("%s  - IntuneWin file: %s\n", indent, intunewinFile)
-		} else if finalModel.source == "Local File" {
-			fmt.Println("\n" + sectionStyle.Render("Actions:"))
-			fmt.Printf("%s• Preparing package directory...\n", indent)
-			fmt.Printf("%s  - Creating: %s\n", indent, finalModel.outputDir)
-
-			fmt.Printf("%s• Copying installer file...\n", indent)
-			fmt.Printf("%s  - Source: %s\n", indent, finalModel.textInput)
-			fmt.Printf("%s  - Destination: %s\n", indent, filepath.Join(finalModel.outputDir, installerFile))
-
-			if err := copyFileToDir(finalModel.textInput, finalModel.outputDir, installerFile); err != nil {
-				fmt.Printf("Error copying installer: %v\n", err)
-				return
-			}
+	files, err := os.ReadDir(package_dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read package directory: %v", err)
+	}
+	for _, file := range files {
+		if !file.IsDir() && installerTypeFor(file.Name()) != "" {
+			return file.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no installer file found in package directory")
+}
 
-			time.Sleep(500 * time.Millisecond)
+// setupPicker lets the user choose the setup file of a downloaded archive.
+type setupPicker struct {
+	candidates []string
+	cursor     int
+	chosen     bool
+}
 
-			if finalModel.installerType == "MSI" {
-				fmt.Printf("%s• Extracting MSI metadata...\n", indent)
-				msiPath := filepath.Join(finalModel.outputDir, installerFile)
-				productCode, version, err := getMSIProductCode(msiPath)
-				if err != nil {
-					fmt.Printf("%s  - Warning: Could not extract MSI metadata: %v\n", indent, err)
-					fmt.Printf("%s  - You may need to manually set detection rules in Intune\n", indent)
-				} else {
-					finalModel.productCode = productCode
-					finalModel.version = version
-					fmt.Printf("%s  - Product Code: %s\n", indent, productCode)
-					fmt.Printf("%s  - Version: %s\n", indent, version)
-				}
-			}
+func (p setupPicker) Init() tea.Cmd {
+	return nil
+}
 
-			fmt.Printf("%s• Creating installation scripts...\n", indent)
-			if err := createPackageScripts(finalModel.outputDir, finalModel.packageName, finalModel.installerType); err != nil {
-				fmt.Printf("Error creating package scripts: %v\n", err)
-				return
+func (p setupPicker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "q":
+			return p, tea.Quit
+		case "up", "k":
+			if p.cursor > 0 {
+				p.cursor--
 			}
-			fmt.Printf("%s  - Install.ps1: Silent installation script\n", indent)
-			fmt.Printf("%s  - Uninstall.ps1: Clean removal script\n", indent)
-
-			fmt.Printf("%s• Generating IntuneWin package...\n", indent)
-			args := []string{
-				"-c", finalModel.outputDir,
-				"-s", filepath.Join(finalModel.outputDir, installerFile),
-				"-o", finalModel.outputDir,
-				"-q",
+		case "down", "j":
+			if p.cursor < len(p.candidates)-1 {
+				p.cursor++
 			}
-			cmd := exec.Command(intuneUtilPath, args...)
-			if output, err := cmd.CombinedOutput(); err != nil {
-				fmt.Printf("Error generating IntuneWin package: %v\n%s\n", err, output)
-				return
-			}
-
-			fmt.Printf("%s• Package creation complete\n", indent)
-			fmt.Printf("%s  - IntuneWin file: %s\n", indent, intunewinFile)
-		} else {
-			fmt.Println("\n" + sectionStyle.Render("Actions:"))
-			fmt.Printf("%s• Downloading installer file...\n", indent)
+		case "enter":
+			p.chosen = true
+			return p, tea.Quit
+		}
+	}
+	return p, nil
+}
 
-			download_path := filepath.Join(downloadsDir, installerFile)
+func (p setupPicker) View() string {
+	selected_style := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF875F"))
+	s := "\nSelect the setup file to run:\n\n"
+	for i, candidate := range p.candidates {
+		cursor := " "
+		if p.cursor == i {
+			cursor = "▸"
+			candidate = selected_style.Render(candidate)
+		}
+		s += fmt.Sprintf("%s %s\n", cursor, candidate)
+	}
+	return s
+}
 
-			fmt.Printf("%s  - URL: %s\n", indent, finalModel.textInput)
-			fmt.Printf("%s  - Temporary location: %s\n", indent, download_path)
+// pickSetupFile asks which candidate is the setup file, unless there is
+// only one.
+func pickSetupFile(candidates []string) (string, error) {
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no setup file found in the payload")
+	case 1:
+		return candidates[0], nil
+	}
 
-			if err := downloadFile(finalModel.textInput, download_path); err != nil {
-				fmt.Printf("%s  - Error downloading installer: %v\n", indent, err)
-				return
-			}
+	result, err := tea.NewProgram(setupPicker{candidates: candidates}).Run()
+	if err != nil {
+		return "", err
+	}
+	picker := result.(setupPicker)
+	if !picker.chosen {
+		return "", fmt.Errorf("no setup file selected")
+	}
+	return picker.candidates[picker.cursor], nil
+}
 
-			if _, err := os.Stat(download_path); os.IsNotExist(err) {
-				fmt.Printf("%s  - Error: Download failed, file not found\n", indent)
-				return
-			}
+// downloadView shows a download running in the background, fed by
+// downloadProgressMsg. ctrl+c cancels the download and waits for it to
+// stop.
+type downloadView struct {
+	name   string
+	indent string
+	bar    progress.Model
+	cancel context.CancelFunc
+
+	received int64
+	total    int64
+	resumed  int64 // bytes already on disk when the download started
+	started  time.Time
+
+	// Speed is smoothed over samples at least a second apart, so the ETA
+	// does not jump around with every read.
+	speed       float64
+	sampleAt    time.Time
+	sampleBytes int64
+
+	cancelling bool
+	done       bool
+}
 
-			fmt.Printf("%s  - Download complete\n", indent)
+type downloadProgressMsg struct {
+	received int64
+	total    int64
+	at       time.Time
+}
 
-			fmt.Printf("%s• Preparing package directory...\n", indent)
-			fmt.Printf("%s  - Creating: %s\n", indent, finalModel.outputDir)
+type downloadDoneMsg struct{}
 
-			fmt.Printf("%s• Copying installer to package directory...\n", indent)
-			if err := copyFileToDir(download_path, finalModel.outputDir, installerFile); err != nil {
-				fmt.Printf("%s  - Error copying installer: %v\n", indent, err)
-				return
-			}
-			fmt.Printf("%s  - Copy complete\n", indent)
+func newDownloadView(name, indent string, cancel context.CancelFunc) downloadView {
+	return downloadView{
+		name:   name,
+		indent: indent,
+		bar:    progress.New(progress.WithSolidFill("#FF875F"), progress.WithWidth(50)),
+		cancel: cancel,
+		total:  -1,
+	}
+}
 
-			time.Sleep(500 * time.Millisecond)
+func (v downloadView) Init() tea.Cmd {
+	return nil
+}
 
-			if finalModel.installerType == "MSI" {
-				fmt.Printf("%s• Extracting MSI metadata...\n", indent)
-				msiPath := filepath.Join(finalModel.outputDir, installerFile)
-				productCode, version, err := getMSIProductCode(msiPath)
-				if err != nil {
-					fmt.Printf("%s  - Warning: Could not extract MSI metadata: %v\n", indent, err)
-					fmt.Printf("%s  - You may need to manually set detection rules in Intune\n", indent)
+func (v downloadView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" && !v.cancelling {
+			v.cancelling = true
+			v.cancel()
+		}
+	case tea.WindowSizeMsg:
+		v.bar.Width = max(10, min(50, msg.Width-len(v.indent)-8))
+	case downloadProgressMsg:
+		if v.started.IsZero() {
+			v.started = msg.at
+			v.resumed = msg.received
+			v.sampleAt = msg.at
+			v.sampleBytes = msg.received
+		}
+		if elapsed := msg.at.Sub(v.sampleAt).Seconds(); elapsed >= 1 {
+			// A retry that starts over makes received go backwards.
+			if rate := float64(msg.received-v.sampleBytes) / elapsed; rate >= 0 {
+				if v.speed == 0 {
+					v.speed = rate
 				} else {
-					finalModel.productCode = productCode
-					finalModel.version = version
-					fmt.Printf("%s  - Product Code: %s\n", indent, productCode)
-					fmt.Printf("%s  - Version: %s\n", indent, version)
+					v.speed = (v.speed + rate) / 2
 				}
 			}
-
-			fmt.Printf("%s• Creating installation scripts...\n", indent)
-			if err := createPackageScripts(finalModel.outputDir, finalModel.packageName, finalModel.installerType); err != nil {
-				fmt.Printf("%s  - Error creating package scripts: %v\n", indent, err)
-				return
-			}
-			fmt.Printf("%s  - Install.ps1: Silent installation script\n", indent)
-			fmt.Printf("%s  - Uninstall.ps1: Clean removal script\n", indent)
-
-			fmt.Printf("%s• Generating IntuneWin package...\n", indent)
-			args := []string{
-				"-c", finalModel.outputDir,
-				"-s", filepath.Join(finalModel.outputDir, installerFile),
-				"-o", finalModel.outputDir,
-				"-q",
-			}
-			cmd := exec.Command(intuneUtilPath, args...)
-			if output, err := cmd.CombinedOutput(); err != nil {
-				fmt.Printf("%s  - Error generating IntuneWin package: %v\n%s\n", indent, err, output)
-				return
-			}
-			fmt.Printf("%s  - IntuneWin package created successfully\n", indent)
-
-			fmt.Printf("%s• Package creation complete\n", indent)
-			fmt.Printf("%s  - IntuneWin file: %s\n", indent, intunewinFile)
-		}
-
-		fmt.Println("\n" + titleStyle.Render("Package Complete"))
-
-		fmt.Println("\n" + sectionStyle.Render("Summary:"))
-		fmt.Printf("%s• Name: %s\n", indent, finalModel.packageName)
-		if finalModel.version != "" {
-			fmt.Printf("%s• Version: %s\n", indent, finalModel.version)
+			v.sampleAt = msg.at
+			v.sampleBytes = msg.received
 		}
-		fmt.Printf("%s• Source: %s\n", indent, finalModel.textInput)
-		if finalModel.installerType == "MSI" {
-			fmt.Printf("%s• Product Code: %s\n", indent, finalModel.productCode)
-		}
-
-		fmt.Println("\n" + sectionStyle.Render("Location:"))
-		fmt.Printf("%s• Installer File: %s\n", indent, installerFile)
-		fmt.Printf("%s• IntuneWin File: %s\n", indent, intunewinFile)
-		fmt.Printf("%s• Package Directory: %s\n", indent, finalModel.outputDir)
-
-		fmt.Println("\n" + sectionStyle.Render("Intune Configuration:"))
-
-		fmt.Printf("%s• Install Script: Install.ps1\n", indent)
-		fmt.Printf("%s• Uninstall Script: Uninstall.ps1\n", indent)
+		v.received = msg.received
+		v.total = msg.total
+	case downloadDoneMsg:
+		v.done = true
+		return v, tea.Quit
+	}
+	return v, nil
+}
 
-		fmt.Println("\n" + sectionStyle.Render("Intune Detection Method:"))
-		if finalModel.installerType == "MSI" {
-			fmt.Printf("%s• MSI Product Code:\n", indent)
-			fmt.Printf("%s  - Property: ProductCode\n", indent)
-			fmt.Printf("%s  - Value: %s\n", indent, finalModel.productCode)
-			if finalModel.version != "" {
-				fmt.Printf("%s• Version Detection:\n", indent)
-				fmt.Printf("%s  - Property: ProductVersion\n", indent)
-				fmt.Printf("%s  - Value: %s\n", indent, finalModel.version)
-				fmt.Printf("%s  - Operator: Greater than or equal to\n", indent)
-			}
-		} else {
-			fmt.Printf("%s• Use custom detection script or file existence\n", indent)
-		}
+func (v downloadView) View() string {
+	if v.done {
+		return ""
+	}
+	s := fmt.Sprintf("\n%sDownloading %s\n\n", v.indent, v.name)
+	if v.total > 0 {
+		s += v.indent + v.bar.ViewAs(float64(v.received)/float64(v.total)) + "\n"
+	}
 
-		fmt.Println("\n" + sectionStyle.Render("Customizing Installation:"))
-		fmt.Printf("%s• Installation Arguments:\n", indent)
-		if finalModel.installerType == "MSI" {
-			fmt.Printf("%s  Current: /qn /norestart (silent install, no restart)\n", indent)
-		} else {
-			fmt.Printf("%s  Current: /silent (silent install)\n", indent)
+	status := formatBytes(v.received)
+	if v.total > 0 {
+		status += " of " + formatBytes(v.total)
+	}
+	if v.speed > 0 {
+		status += " • " + formatBytes(int64(v.speed)) + "/s"
+		if v.total > v.received {
+			eta := time.Duration(float64(v.total-v.received) / v.speed * float64(time.Second))
+			status += " • " + eta.Round(time.Second).String() + " left"
 		}
-		fmt.Printf("%s  To modify: Open Install.ps1 and update $install_args\n", indent)
+	}
+	s += v.indent + status + "\n\n"
 
-		fmt.Printf("\n%s• Custom Installation Steps:\n", indent)
-		fmt.Printf("%s  1. Open Install.ps1 in the package directory\n", indent)
-		fmt.Printf("%s  2. Add your custom PowerShell code:\n", indent)
-		fmt.Printf("%s     - Before install_application() for pre-install tasks\n", indent)
-		fmt.Printf("%s     - After install_application() for post-install tasks\n", indent)
-		fmt.Printf("%s  3. After making changes, repackage the application using:\n", indent)
-		fmt.Printf("%s     - Select 'Repackage Application' from main menu\n", indent)
-		fmt.Printf("%s     - Choose the modified package to create new IntuneWin file\n", indent)
-		fmt.Println()
+	hint := "ctrl+c to cancel"
+	if v.cancelling {
+		hint = "Cancelling..."
 	}
+	return s + v.indent + lipgloss.NewStyle().Foreground(lipgloss.Color("#626262")).Render(hint) + "\n"
 }
 
-func ensureNexusDirs() error {
-	dirs := []string{nexusDir, intuneUtilDir, packagesDir, downloadsDir}
-	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %v", dir, err)
+// downloadWithProgress runs the download under a downloadView. Retries and
+// resumes are printed above the progress bar.
+func downloadWithProgress(ctx context.Context, url, dest string, opts download.Options, indent string) (download.Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := tea.NewProgram(newDownloadView(filepath.Base(dest), indent, cancel))
+	var last time.Time
+	opts.Progress = func(received, total int64) {
+		if now := time.Now(); now.Sub(last) >= 100*time.Millisecond || received == total {
+			last = now
+			p.Send(downloadProgressMsg{received: received, total: total, at: now})
 		}
 	}
-	return nil
-}
-
-func downloadFile(url, filepath string) error {
-	dir := path.Dir(filepath)
-	indent := "      "
-
-	fmt.Printf("%s- Creating directory: %s\n", indent, dir)
+	opts.Logf = func(format string, args ...any) {
+		p.Println(indent + "- " + fmt.Sprintf(format, args...))
+	}
 
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	var result download.Result
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		result, err = download.File(ctx, url, dest, opts)
+		done <- err
+		p.Send(downloadDoneMsg{})
+	}()
+
+	final, runErr := p.Run()
+	cancel()
+	err := <-done
+	if runErr != nil && err == nil {
+		err = runErr
 	}
 
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return fmt.Errorf("directory creation failed, path still doesn't exist: %s", dir)
+	view, _ := final.(downloadView)
+	if view.cancelling {
+		fmt.Printf("%s- Cancelled, the partial download is kept and resumes on the next build\n", indent)
+		return result, fmt.Errorf("download cancelled")
 	}
+	if err == nil && !view.started.IsZero() {
+		elapsed := time.Since(view.started)
+		fmt.Printf("%s- Received %s in %s (%s/s)\n", indent, formatBytes(view.received-view.resumed), elapsed.Round(100*time.Millisecond),
+			formatBytes(int64(float64(view.received-view.resumed)/max(elapsed.Seconds(), 0.001))))
+	}
+	return result, err
+}
 
-	fmt.Printf("%s- Opening file for writing: %s\n", indent, filepath)
-	out, err := os.Create(filepath)
+func run_interactive(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to create file: %v", err)
+		fmt.Printf("Error loading configuration: %v\n", err)
+	}
+
+	if err := ensureNexusDirs(cfg); err != nil {
+		return fmt.Errorf("failed to set up Nexus directories: %v", err)
+	}
+
+	m := initial_model(cfg)
+
+	p := tea.NewProgram(m)
+	final_model, err := p.Run()
+	if err != nil {
+		return fmt.Errorf("error running program: %v", err)
+	}
+
+	finalModel := final_model.(model)
+	defer finalModel.cleanupPayload()
+	if finalModel.err != nil {
+		return finalModel.err
+	}
+	if finalModel.step != 3 || finalModel.cursor != 0 {
+		return nil
+	}
+
+	finalModel, err = build_package(finalModel, cfg.Downloads(), pickSetupFile)
+	if err != nil {
+		return err
+	}
+	print_package_summary(finalModel)
+	return nil
+}
+
+// build_package runs the copy, metadata, script and intunewin steps for a
+// confirmed model and returns it with the installer's details filled in.
+// choose_setup picks the setup file of a downloaded archive.
+//
+// The package is built in a staging directory and only moved into place
+// once every step has succeeded, so a failed or interrupted build leaves
+// the previous package as it was. An interrupt stops the build at the next
+// step; a second one exits at once.
+func build_package(m model, downloads_dir string, choose_setup func([]string) (string, error)) (model, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	fmt.Println("\n" + titleStyle.Render("Creating Package"))
+	fmt.Println("\n" + lipgloss.NewStyle().Bold(true).Render("Actions:"))
+	indent := "    "
+
+	staged, err := stage_package_dir(m, indent)
+	if err != nil {
+		return m, err
+	}
+
+	// The manifest is written into the staging directory too, so the
+	// package is never in place without the nexus.json that describes it.
+	package_dir := m.outputDir
+	m.outputDir = staged.Path
+	err = build_staged(ctx, &m, downloads_dir, choose_setup, indent)
+	if err == nil {
+		err = interrupted(ctx)
+	}
+	if err == nil {
+		fmt.Printf("%s• Recording the build...\n", indent)
+		err = write_package_manifest(m, package_dir, indent)
+	}
+	m.outputDir = package_dir
+	if err != nil {
+		staged.Discard()
+		if ctx.Err() != nil {
+			err = errInterrupted
+			fmt.Printf("\n%s• Build interrupted, partial output removed\n", indent)
+		} else {
+			fmt.Printf("%s• Build failed, partial output removed\n", indent)
+		}
+		if _, statErr := os.Stat(package_dir); statErr == nil {
+			fmt.Printf("%s  - The previous package is unchanged\n", indent)
+		}
+		return m, err
+	}
+
+	if err := swap_package_dir(m, staged, indent); err != nil {
+		staged.Discard()
+		return m, err
+	}
+	return snapshot_build(m, indent), nil
+}
+
+// errInterrupted is returned by a build stopped with ctrl+c.
+var errInterrupted = errors.New("build interrupted")
+
+// interrupted returns errInterrupted once ctx is cancelled. Build steps
+// check it before they start, so an interrupt never leaves a step half
+// done in the staging directory.
+func interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// build_staged runs the build steps in the staging directory, stopping
+// before the next step once ctx is cancelled.
+func build_staged(ctx context.Context, m *model, downloads_dir string, choose_setup func([]string) (string, error), indent string) error {
+	if m.mode == "Repackage Application" {
+		return repackage_package(ctx, m, indent)
+	}
+
+	var err error
+	if m.source == "Local File" {
+		err = copy_local_source(m, indent)
+	} else {
+		err = download_source(ctx, m, downloads_dir, choose_setup, indent)
+	}
+	if err != nil {
+		return err
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if err := check_signature(m, filepath.Join(m.outputDir, m.installerFileName()), indent); err != nil {
+		return err
+	}
+
+	read_installer_metadata(m, filepath.Join(m.outputDir, m.installerFileName()), indent)
+
+	if len(m.attachments) > 0 {
+		if err := interrupted(ctx); err != nil {
+			return err
+		}
+		if err := copyAttachments(*m, indent); err != nil {
+			return fmt.Errorf("failed to copy attachments: %v", err)
+		}
+	}
+
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("%s• Creating installation scripts...\n", indent)
+	if err := createPackageScripts(m.outputDir, m.scriptInfo()); err != nil {
+		return fmt.Errorf("failed to create package scripts: %v", err)
+	}
+	fmt.Printf("%s  - Install.ps1: Silent installation script\n", indent)
+	fmt.Printf("%s  - Uninstall.ps1: Clean removal script\n", indent)
+
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	return generate_intunewin(*m, indent)
+}
+
+// snapshot_build keeps a snapshot of a package that was just moved into
+// place in its history. The build itself is already done by then, so a
+// failed snapshot is only a warning.
+func snapshot_build(m model, indent string) model {
+	pm, err := manifest.Read(m.outputDir)
+	var snapshot history.Snapshot
+	if err == nil {
+		snapshot, err = history.Save(m.outputDir, history.Key(pm))
+	}
+	if err != nil {
+		fmt.Printf("%s• Warning: Failed to keep a snapshot of the build: %v\n", indent, err)
+		return m
+	}
+	m.snapshot = snapshot.Key
+	fmt.Printf("%s• Saved a snapshot of the build\n", indent)
+	fmt.Printf("%s  - %s\n", indent, filepath.Join(history.DirName, snapshot.Key))
+	return m
+}
+
+// write_package_manifest records the package in its nexus.json. Rebuilds
+// keep when the package was created and where it came from, and take the
+// install arguments from Install.ps1 since that is what actually runs.
+// The build number follows on from the history of the package in
+// package_dir, which is where the build will end up.
+func write_package_manifest(m model, package_dir, indent string) error {
+	pm, err := manifest.Read(m.outputDir)
+	if err != nil {
+		pm = &manifest.Manifest{Created: time.Now()}
+	}
+
+	pm.DisplayName = m.packageName
+	pm.InstallerType = m.installerType
+	pm.InstallerFile = filepath.ToSlash(m.installerFileName())
+	pm.Version = m.version
+	pm.Publisher = m.publisher
+	pm.ProductCode = m.productCode
+	if m.msiInfo != nil {
+		pm.UpgradeCode = m.msiInfo.UpgradeCode
+	}
+	if m.mode == "Repackage Application" {
+		if args := script_variable(m.outputDir, "install_args"); args != "" {
+			pm.InstallArgs = args
+		}
+	} else {
+		pm.Source = m.textInput
+		pm.SHA256 = m.sourceSHA256
+		pm.SHA512 = m.sourceSHA512
+		pm.Checksum = m.expectedSum.String()
+		pm.InstallArgs = m.installArgs()
+		pm.UninstallArgs = m.uninstallArgs()
+		pm.Attachments = nil
+	}
+	for _, attachment := range m.attachments {
+		if name := filepath.Base(attachment); !contains(pm.Attachments, name) {
+			pm.Attachments = append(pm.Attachments, name)
+		}
+	}
+	pm.Signature = nil
+	if sig := m.signature; sig != nil {
+		pm.Signature = &manifest.Signature{
+			Status:    sig.Status,
+			Problem:   sig.Problem,
+			Signer:    sig.Subject,
+			Issuer:    sig.Issuer,
+			Timestamp: sig.Timestamp,
+		}
+	}
+	pm.Build = max(pm.Build, history.LatestBuild(package_dir)) + 1
+	pm.Built = time.Now()
+
+	if err := pm.Write(m.outputDir); err != nil {
+		return err
+	}
+	fmt.Printf("%s  - Manifest: %s\n", indent, manifest.FileName)
+	return nil
+}
+
+// stage_package_dir creates the staging directory for a build. A rebuild
+// starts from a copy of the package; a new package starts empty, and may
+// only replace an existing one if the user agreed.
+func stage_package_dir(m model, indent string) (*stage.Dir, error) {
+	repackaging := m.mode == "Repackage Application"
+	if _, err := os.Stat(m.outputDir); err == nil && !repackaging && !m.replacing {
+		return nil, fmt.Errorf("package %s already exists", m.outputDir)
+	}
+
+	staged, err := stage.New(m.outputDir)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s• Preparing package directory...\n", indent)
+	fmt.Printf("%s  - Package: %s\n", indent, m.outputDir)
+	fmt.Printf("%s  - Staging in: %s\n", indent, staged.Path)
+
+	if repackaging {
+		if err := staged.Copy(history.DirName); err != nil {
+			staged.Discard()
+			return nil, err
+		}
+	}
+	return staged, nil
+}
+
+// swap_package_dir moves a finished build into place. A package that is
+// replaced goes to the trash; a package that is rebuilt is set aside and
+// removed once the new build is in place. Either way its build history
+// stays with the package.
+func swap_package_dir(m model, staged *stage.Dir, indent string) error {
+	repackaging := m.mode == "Repackage Application"
+	var entry trash.Entry
+	previous, err := staged.Commit(func(dir string) (string, error) {
+		if repackaging {
+			aside := staged.Path + ".previous"
+			return aside, os.Rename(dir, aside)
+		}
+		var err error
+		entry, err = trash.Move(dir, m.settings.Trash())
+		return entry.Path, err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s• Moving the build into place...\n", indent)
+	fmt.Printf("%s  - %s\n", indent, m.outputDir)
+	if previous == "" {
+		return nil
+	}
+	if repackaging {
+		if err := os.RemoveAll(previous); err != nil {
+			fmt.Printf("%s  - Warning: Failed to remove the previous build: %v\n", indent, err)
+		}
+		return nil
+	}
+	fmt.Printf("%s• Moved the existing package to the trash\n", indent)
+	fmt.Printf("%s  - %s\n", indent, entry.Path)
+	fmt.Printf("%s  - Bring it back with: nexus restore %s\n", indent, entry.Name)
+	return nil
+}
+
+// repackage_package rebuilds the intunewin of an existing package from the
+// installer and scripts already in its directory.
+func repackage_package(ctx context.Context, m *model, indent string) error {
+	fmt.Printf("%s• Analyzing existing package...\n", indent)
+	fmt.Printf("%s  - Package directory: %s\n", indent, m.outputDir)
+
+	// Clean up existing .intunewin files
+	fmt.Printf("%s• Cleaning up existing package files...\n", indent)
+	files, err := os.ReadDir(m.outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to read package directory: %v", err)
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".intunewin") {
+			intunewin_path := filepath.Join(m.outputDir, file.Name())
+			fmt.Printf("%s  - Removing: %s\n", indent, file.Name())
+			if err := os.Remove(intunewin_path); err != nil {
+				fmt.Printf("%s  - Warning: Failed to remove %s: %v\n", indent, file.Name(), err)
+			}
+		}
+	}
+
+	var installer_file string
+	if pm, err := manifest.Read(m.outputDir); err == nil {
+		fmt.Printf("%s  - Reading %s\n", indent, manifest.FileName)
+		if pm.DisplayName != "" {
+			m.packageName = pm.DisplayName
+		}
+		m.textInput = pm.Source
+		m.sourceSHA256 = pm.SHA256
+		m.sourceSHA512 = pm.SHA512
+		m.installerType = pm.InstallerType
+		if _, err := os.Stat(filepath.Join(m.outputDir, filepath.FromSlash(pm.InstallerFile))); pm.InstallerFile != "" && err == nil {
+			installer_file = filepath.FromSlash(pm.InstallerFile)
+		}
+	} else if !os.IsNotExist(err) {
+		fmt.Printf("%s  - Warning: %v\n", indent, err)
+	}
+
+	if installer_file == "" {
+		if installer_file, err = find_package_installer(m.outputDir); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%s  - Found installer: %s\n", indent, installer_file)
+	m.setupFile = filepath.ToSlash(installer_file)
+	if m.installerType == "" {
+		m.installerType = installerTypeFor(installer_file)
+	}
+
+	// Add a small delay to ensure file operations are complete
+	time.Sleep(500 * time.Millisecond)
+
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	if err := check_signature(m, filepath.Join(m.outputDir, installer_file), indent); err != nil {
+		return err
+	}
+
+	read_installer_metadata(m, filepath.Join(m.outputDir, installer_file), indent)
+
+	if len(m.attachments) > 0 {
+		if err := copyAttachments(*m, indent); err != nil {
+			return fmt.Errorf("failed to copy attachments: %v", err)
+		}
+		if err := updateScriptAttachments(m.outputDir, m.attachments); err != nil {
+			return err
+		}
+		fmt.Printf("%s  - Install.ps1 updated with the new transforms and patches\n", indent)
+	}
+
+	if err := interrupted(ctx); err != nil {
+		return err
+	}
+	return generate_intunewin(*m, indent)
+}
+
+// copy_local_source copies a local installer, folder or extracted archive
+// into the package directory.
+func copy_local_source(m *model, indent string) error {
+	if m.payloadDir != "" {
+		fmt.Printf("%s• Copying payload...\n", indent)
+		fmt.Printf("%s  - Source: %s\n", indent, m.textInput)
+		files, err := payload.Extract(m.payloadDir, m.outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to copy payload: %v", err)
+		}
+		fmt.Printf("%s  - Copied %d files\n", indent, len(files))
+		fmt.Printf("%s  - Setup file: %s\n", indent, m.installerFileName())
+
+		// A folder has no single file to hash, so its setup file stands in.
+		source_file := m.textInput
+		if info, err := os.Stat(source_file); err == nil && info.IsDir() {
+			source_file = filepath.Join(m.outputDir, m.installerFileName())
+		}
+		return hash_source(m, source_file, indent)
+	}
+
+	installerFile := m.installerFileName()
+	fmt.Printf("%s• Copying installer file...\n", indent)
+	fmt.Printf("%s  - Source: %s\n", indent, m.textInput)
+	fmt.Printf("%s  - Destination: %s\n", indent, filepath.Join(m.outputDir, installerFile))
+
+	if err := copyFileToDir(m.textInput, m.outputDir, installerFile); err != nil {
+		return fmt.Errorf("failed to copy installer: %v", err)
+	}
+	return hash_source(m, filepath.Join(m.outputDir, installerFile), indent)
+}
+
+// hash_source records the SHA-256 of the installer as it arrived and
+// refuses the build when it does not match the expected checksum.
+func hash_source(m *model, source_file, indent string) error {
+	sum, err := manifest.HashFile(source_file)
+	if err != nil {
+		return err
+	}
+	m.sourceSHA256 = sum
+	fmt.Printf("%s  - SHA-256: %s\n", indent, sum)
+
+	if m.expectedSum.IsZero() {
+		return nil
+	}
+	if m.expectedSum.Algorithm == checksum.SHA512 {
+		if sum, err = checksum.File(source_file, checksum.SHA512); err != nil {
+			return err
+		}
+		m.sourceSHA512 = sum
+		fmt.Printf("%s  - SHA-512: %s\n", indent, sum)
+	}
+	if err := m.expectedSum.Check(sum); err != nil {
+		return fmt.Errorf("refusing to build %s, the installer is not the expected one: %v", m.packageName, err)
+	}
+	fmt.Printf("%s  - Matches the expected %s\n", indent, m.expectedSum.Algorithm)
+	return nil
+}
+
+// check_signature verifies the Authenticode signature of the installer and
+// refuses the build when the signature policy does not allow it. MSIX
+// packages are left to Windows, which will not install one whose signature
+// does not check out.
+func check_signature(m *model, installer_path, indent string) error {
+	fmt.Printf("%s• Checking signature...\n", indent)
+	if m.installerType == "MSIX" {
+		fmt.Printf("%s  - MSIX packages are verified by Windows when they are installed\n", indent)
+		return nil
+	}
+
+	policy := authenticode.Policy{Level: m.settings.SignatureLevel(), Publishers: m.settings.Publishers()}
+	if !authenticode.Supported(installer_path) {
+		fmt.Printf("%s  - Signatures of %s files are not checked\n", indent, filepath.Ext(installer_path))
+		if err := policy.Check(&authenticode.Signature{Status: authenticode.Unsigned}); err != nil {
+			return fmt.Errorf("refusing to build %s, its signature cannot be checked (signature_policy is %s)", m.packageName, policy.Level)
+		}
+		return nil
+	}
+
+	roots, err := m.settings.CodeSigningRoots()
+	if err != nil {
+		return err
+	}
+	sig, err := authenticode.Verify(installer_path, roots)
+	if err != nil {
+		return fmt.Errorf("failed to check signature: %v", err)
+	}
+	m.signature = sig
+
+	fmt.Printf("%s  - Status: %s\n", indent, describeSignature(sig.Status, sig.Problem))
+	if sig.Subject != "" {
+		fmt.Printf("%s  - Signer: %s\n", indent, sig.Subject)
+		fmt.Printf("%s  - Issuer: %s\n", indent, sig.Issuer)
+	}
+	if !sig.Timestamp.IsZero() {
+		fmt.Printf("%s  - Timestamp: %s\n", indent, sig.Timestamp.Local().Format("2006-01-02 15:04:05"))
+	} else if sig.Status != authenticode.Unsigned {
+		fmt.Printf("%s  - Timestamp: none\n", indent)
+	}
+
+	if err := policy.Check(sig); err != nil {
+		return fmt.Errorf("refusing to build %s, %v", m.packageName, err)
+	}
+	return nil
+}
+
+// describeSignature says in a few words what the signature check found.
+func describeSignature(status, problem string) string {
+	switch status {
+	case authenticode.Trusted:
+		return "signed by a trusted publisher"
+	case authenticode.Untrusted:
+		return "signed, but not trusted (" + problem + ")"
+	case authenticode.Invalid:
+		return "invalid signature (" + problem + ")"
+	}
+	return "not signed"
+}
+
+// download_source downloads the installer or archive and puts it in the
+// package directory.
+func download_source(ctx context.Context, m *model, downloads_dir string, choose_setup func([]string) (string, error), indent string) error {
+	fmt.Printf("%s• Downloading installer file...\n", indent)
+	fmt.Printf("%s  - URL: %s\n", indent, m.textInput)
+
+	download_path, err := fetch_cached(ctx, m, cache.Open(downloads_dir), indent)
+	if err != nil {
+		return err
+	}
+
+	if err := hash_source(m, download_path, indent); err != nil {
+		return err
+	}
+
+	if !payload.IsArchive(download_path) {
+		fmt.Printf("%s• Copying installer to package directory...\n", indent)
+		if err := copyFileToDir(download_path, m.outputDir, m.installerFileName()); err != nil {
+			return fmt.Errorf("failed to copy installer: %v", err)
+		}
+		fmt.Printf("%s  - Copy complete\n", indent)
+		return nil
+	}
+
+	fmt.Printf("%s• Extracting payload to package directory...\n", indent)
+	files, err := payload.Extract(download_path, m.outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to extract archive: %v", err)
+	}
+	fmt.Printf("%s  - Extracted %d files\n", indent, len(files))
+
+	setup, err := choose_setup(payload.SetupCandidates(files, setupExtensions(m.installerType)...))
+	if err != nil {
+		return err
+	}
+	m.setupFile = setup
+	fmt.Printf("%s  - Setup file: %s\n", indent, setup)
+	return nil
+}
+
+// fetch_cached returns the cached copy of the installer URL, revalidated
+// with the server, or downloads it into the cache when it is missing or has
+// changed.
+func fetch_cached(ctx context.Context, m *model, c *cache.Cache, indent string) (string, error) {
+	url := m.textInput
+	cached := c.Lookup(url)
+	if cached != nil {
+		fmt.Printf("%s  - Cached copy from %s, checking for changes\n", indent, cached.Fetched.Local().Format("2006-01-02 15:04"))
+	}
+
+	download_path := c.DownloadPath(url, m.installerExtension())
+	result, err := downloadFile(ctx, m.settings, url, download_path, cached)
+	if err != nil {
+		return "", fmt.Errorf("failed to download installer: %v", err)
+	}
+
+	if result.NotModified {
+		if err := c.Verify(cached); err != nil {
+			fmt.Printf("%s  - Warning: %v, downloading it again\n", indent, err)
+			if err := c.Remove(url); err != nil {
+				return "", fmt.Errorf("failed to update download cache: %v", err)
+			}
+			return fetch_cached(ctx, m, c, indent)
+		}
+		if err := c.Touch(cached, result.ETag, result.LastModified); err != nil {
+			return "", fmt.Errorf("failed to update download cache: %v", err)
+		}
+		fmt.Printf("%s  - Not modified, using the cached copy\n", indent)
+		return c.Path(cached), nil
+	}
+
+	if _, err := os.Stat(download_path); os.IsNotExist(err) {
+		return "", fmt.Errorf("download failed, file not found")
+	}
+	entry, err := c.Store(url, download_path, result.ETag, result.LastModified)
+	if err != nil {
+		return "", fmt.Errorf("failed to update download cache: %v", err)
+	}
+	fmt.Printf("%s  - Download complete\n", indent)
+	fmt.Printf("%s  - Cached as: %s\n", indent, c.Path(entry))
+	return c.Path(entry), nil
+}
+
+// read_installer_metadata fills in the product details from the installer
+// in the package. Unreadable metadata is reported but does not stop the
+// build.
+func read_installer_metadata(m *model, installer_path, indent string) {
+	if m.installerType == "MSI" {
+		fmt.Printf("%s• Extracting MSI metadata...\n", indent)
+		id, err := getMSIIdentity(installer_path)
+		if err != nil {
+			fmt.Printf("%s  - Warning: Could not extract MSI metadata: %v\n", indent, err)
+			fmt.Printf("%s  - You may need to manually set detection rules in Intune\n", indent)
+		} else {
+			m.applyMSIIdentity(id)
+			printMSIIdentity(indent, id)
+		}
+	} else if m.installerType == "MSIX" {
+		fmt.Printf("%s• Reading package manifest...\n", indent)
+		manifest, err := appx.ReadManifest(installer_path)
+		if err != nil {
+			fmt.Printf("%s  - Warning: Could not read package manifest: %v\n", indent, err)
+		} else {
+			m.applyAppxManifest(manifest)
+			printAppxManifest(indent, manifest)
+		}
+	} else {
+		fmt.Printf("%s• Reading EXE version information...\n", indent)
+		info, err := pe.ReadVersionInfo(installer_path)
+		if err != nil {
+			fmt.Printf("%s  - Warning: Could not read version information: %v\n", indent, err)
+		} else {
+			m.applyVersionInfo(info)
+			fmt.Printf("%s  - Product: %s\n", indent, info.Name())
+			fmt.Printf("%s  - Company: %s\n", indent, info.CompanyName)
+			fmt.Printf("%s  - File Version: %s\n", indent, info.FileVersion)
+			fmt.Printf("%s  - Product Version: %s\n", indent, m.version)
+		}
+
+		fmt.Printf("%s• Detecting installer framework...\n", indent)
+		framework, err := installer.Detect(installer_path)
+		if err != nil {
+			fmt.Printf("%s  - Warning: Could not inspect installer: %v\n", indent, err)
+		} else {
+			m.framework = &framework
+			fmt.Printf("%s  - Framework: %s\n", indent, framework.Name)
+			if framework.Evidence != "" {
+				fmt.Printf("%s  - Detected by: %s\n", indent, framework.Evidence)
+			}
+		}
+		fmt.Printf("%s  - Silent install: %s\n", indent, m.installArgs())
+		fmt.Printf("%s  - Silent uninstall: %s\n", indent, m.uninstallArgs())
+	}
+}
+
+func generate_intunewin(m model, indent string) error {
+	fmt.Printf("%s• Generating IntuneWin package...\n", indent)
+	if err := buildIntuneWin(m, filepath.Join(m.outputDir, m.installerFileName())); err != nil {
+		return fmt.Errorf("failed to generate IntuneWin package: %v", err)
+	}
+	fmt.Printf("%s  - IntuneWin package created successfully\n", indent)
+
+	fmt.Printf("%s• Package creation complete\n", indent)
+	fmt.Printf("%s  - IntuneWin file: %s\n", indent, intunewinFileName(m.installerFileName()))
+	return nil
+}
+
+// print_package_summary prints everything needed to set the package up in
+// Intune.
+func print_package_summary(m model) {
+	indent := "    "
+	sectionStyle := lipgloss.NewStyle().Bold(true)
+	installerFile := m.installerFileName()
+	intunewinFile := intunewinFileName(installerFile)
+
+	fmt.Println("\n" + titleStyle.Render("Package Complete"))
+
+	fmt.Println("\n" + sectionStyle.Render("Summary:"))
+	fmt.Printf("%s• Name: %s\n", indent, m.packageName)
+	fmt.Printf("%s• Package ID: %s\n", indent, filepath.Base(m.outputDir))
+	if m.version != "" {
+		fmt.Printf("%s• Version: %s\n", indent, m.version)
+	}
+	if m.publisher != "" {
+		fmt.Printf("%s• Publisher: %s\n", indent, m.publisher)
+	}
+	fmt.Printf("%s• Source: %s\n", indent, m.textInput)
+	if m.sourceSHA256 != "" {
+		fmt.Printf("%s• SHA-256: %s\n", indent, m.sourceSHA256)
+	}
+	if m.sourceSHA512 != "" {
+		fmt.Printf("%s• SHA-512: %s\n", indent, m.sourceSHA512)
+	}
+	if !m.expectedSum.IsZero() {
+		fmt.Printf("%s• Checksum: matches the expected %s\n", indent, m.expectedSum.Algorithm)
+	}
+	if sig := m.signature; sig != nil {
+		fmt.Printf("%s• Signature: %s\n", indent, describeSignature(sig.Status, sig.Problem))
+		if sig.Subject != "" {
+			fmt.Printf("%s  - Signer: %s\n", indent, sig.Subject)
+			fmt.Printf("%s  - Issuer: %s\n", indent, sig.Issuer)
+		}
+		if !sig.Timestamp.IsZero() {
+			fmt.Printf("%s  - Timestamp: %s\n", indent, sig.Timestamp.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	if m.installerType == "MSI" {
+		fmt.Printf("%s• Product Code: %s\n", indent, m.productCode)
+		if id := m.msiInfo; id != nil {
+			fmt.Printf("%s• Upgrade Code: %s\n", indent, id.UpgradeCode)
+			fmt.Printf("%s• Language: %s\n", indent, id.ProductLanguage)
+			fmt.Printf("%s• Platform: %s\n", indent, id.Platform)
+		}
+	}
+	if manifest := m.appxInfo; manifest != nil {
+		fmt.Printf("%s• Identity: %s\n", indent, manifest.Name)
+		fmt.Printf("%s• Architecture: %s\n", indent, strings.Join(manifest.Architectures, ", "))
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Location:"))
+	fmt.Printf("%s• Installer File: %s\n", indent, installerFile)
+	for _, attachment := range m.attachments {
+		fmt.Printf("%s• Attached: %s\n", indent, describeAttachment(attachment, m.productCode))
+	}
+	fmt.Printf("%s• IntuneWin File: %s\n", indent, intunewinFile)
+	fmt.Printf("%s• Package Directory: %s\n", indent, m.outputDir)
+	if m.snapshot != "" {
+		fmt.Printf("%s• Snapshot: %s (nexus rollback %s %s)\n", indent, filepath.Join(history.DirName, m.snapshot), filepath.Base(m.outputDir), m.snapshot)
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Intune Configuration:"))
+
+	fmt.Printf("%s• Install Script: Install.ps1\n", indent)
+	fmt.Printf("%s• Uninstall Script: Uninstall.ps1\n", indent)
+	if m.installerType == "MSIX" {
+		fmt.Printf("%s• Detection Script: Detection.ps1\n", indent)
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Intune Detection Method:"))
+	if m.installerType == "MSI" {
+		fmt.Printf("%s• MSI Product Code:\n", indent)
+		fmt.Printf("%s  - Property: ProductCode\n", indent)
+		fmt.Printf("%s  - Value: %s\n", indent, m.productCode)
+		if m.version != "" {
+			fmt.Printf("%s• Version Detection:\n", indent)
+			fmt.Printf("%s  - Property: ProductVersion\n", indent)
+			fmt.Printf("%s  - Value: %s\n", indent, m.version)
+			fmt.Printf("%s  - Operator: Greater than or equal to\n", indent)
+		}
+	} else if m.installerType == "MSIX" {
+		fmt.Printf("%s• Custom Detection Script: Detection.ps1\n", indent)
+		if m.appxInfo != nil {
+			fmt.Printf("%s  - Package: %s\n", indent, m.appxInfo.Name)
+			fmt.Printf("%s  - Version: %s or later, any user\n", indent, m.version)
+		}
+	} else {
+		fmt.Printf("%s• Use custom detection script or file existence\n", indent)
+		if m.exeInfo != nil && m.version != "" {
+			fmt.Printf("%s• Registry Detection (Uninstall key of %s):\n", indent, m.exeInfo.Name())
+			fmt.Printf("%s  - Value: DisplayVersion\n", indent)
+			fmt.Printf("%s  - Version: %s\n", indent, m.version)
+			fmt.Printf("%s  - Operator: Greater than or equal to\n", indent)
+		}
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Customizing Installation:"))
+	fmt.Printf("%s• Installation Arguments:\n", indent)
+	if m.customInstallArgs != "" && m.installerType != "MSIX" {
+		fmt.Printf("%s  Current: %s (given on the command line)\n", indent, m.installArgs())
+	} else if m.installerType == "MSI" && m.installArgs() == config.DefaultMSIArgs {
+		fmt.Printf("%s  Current: /qn /norestart (silent install, no restart)\n", indent)
+	} else if m.installerType == "MSI" {
+		fmt.Printf("%s  Current: %s (msi_args setting)\n", indent, m.installArgs())
+		if transforms, patches := splitAttachments(m.attachments); len(transforms) > 0 || len(patches) > 0 {
+			if len(transforms) > 0 {
+				fmt.Printf("%s  Transforms: TRANSFORMS=%s\n", indent, strings.Join(transforms, ";"))
+			}
+			if len(patches) > 0 {
+				fmt.Printf("%s  Patches: PATCH=%s\n", indent, strings.Join(patches, ";"))
+			}
+			fmt.Printf("%s  To modify: update $transforms and $patches in Install.ps1\n", indent)
+		}
+	} else if m.installerType == "MSIX" {
+		fmt.Printf("%s  Current: none (provisioned with Add-AppxProvisionedPackage)\n", indent)
+	} else if m.framework != nil && m.framework.Name != installer.Unknown.Name {
+		fmt.Printf("%s  Current: %s (%s silent install)\n", indent, m.installArgs(), m.framework.Name)
+	} else {
+		fmt.Printf("%s  Current: %s (silent install, framework not recognised)\n", indent, m.installArgs())
+	}
+	fmt.Printf("%s  To modify: Open Install.ps1 and update $install_args\n", indent)
+
+	fmt.Printf("\n%s• Custom Installation Steps:\n", indent)
+	fmt.Printf("%s  1. Open Install.ps1 in the package directory\n", indent)
+	fmt.Printf("%s  2. Add your custom PowerShell code:\n", indent)
+	fmt.Printf("%s     - Before install_application() for pre-install tasks\n", indent)
+	fmt.Printf("%s     - After install_application() for post-install tasks\n", indent)
+	fmt.Printf("%s  3. After making changes, repackage the application using:\n", indent)
+	fmt.Printf("%s     - Select 'Repackage Application' from main menu\n", indent)
+	fmt.Printf("%s     - Choose the modified package to create new IntuneWin file\n", indent)
+	fmt.Println()
+}
+
+// installerTypeFor guesses the installer type from a file name.
+func installerTypeFor(name string) string {
+	switch {
+	case strings.EqualFold(filepath.Ext(name), ".msi"):
+		return "MSI"
+	case strings.EqualFold(filepath.Ext(name), ".exe"):
+		return "EXE"
+	case appx.IsPackage(name):
+		return "MSIX"
+	}
+	return ""
+}
+
+// flagSetupChooser picks the setup file named by --setup, or the only
+// candidate when there is just one, since there is nobody to ask.
+func flagSetupChooser(setup string) func([]string) (string, error) {
+	return func(candidates []string) (string, error) {
+		if len(candidates) == 0 {
+			return "", fmt.Errorf("no setup file found in the payload")
+		}
+		if setup == "" {
+			if len(candidates) == 1 {
+				return candidates[0], nil
+			}
+			return "", fmt.Errorf("the payload has several setup files, choose one with --setup: %s", strings.Join(candidates, ", "))
+		}
+		for _, candidate := range candidates {
+			if strings.EqualFold(candidate, filepath.ToSlash(setup)) {
+				return candidate, nil
+			}
+		}
+		return "", fmt.Errorf("%s is not a setup file in the payload, choose one of: %s", setup, strings.Join(candidates, ", "))
+	}
+}
+
+func run_new(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	source, _ := cmd.Flags().GetString("source")
+	installer_type, _ := cmd.Flags().GetString("type")
+	install_args, _ := cmd.Flags().GetString("install-args")
+	output_dir, _ := cmd.Flags().GetString("output-dir")
+	setup, _ := cmd.Flags().GetString("setup")
+	attach, _ := cmd.Flags().GetStringSlice("attach")
+	force, _ := cmd.Flags().GetBool("force")
+	expected, _ := cmd.Flags().GetString("checksum")
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %v", err)
+	}
+	if err := ensureNexusDirs(cfg); err != nil {
+		return fmt.Errorf("failed to set up Nexus directories: %v", err)
+	}
+	if output_dir == "" {
+		output_dir = cfg.Packages()
+	}
+
+	m := initial_model(cfg)
+	m.mode = "New Application Package"
+	m.packages_dir = output_dir
+	m.customInstallArgs = install_args
+	if m.expectedSum, err = checksum.Parse(expected); err != nil {
+		return err
+	}
+
+	lower := strings.ToLower(source)
+	file_name := source
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		m.source = "Download File"
+		m.textInput = source
+		if u, err := url.Parse(source); err == nil {
+			file_name = u.Path
+		}
+	} else {
+		m.source = "Local File"
+		if m.textInput, err = filepath.Abs(source); err != nil {
+			return fmt.Errorf("invalid file path: %v", err)
+		}
+	}
+
+	if installer_type == "" {
+		installer_type = installerTypeFor(file_name)
+		if installer_type == "" && setup != "" {
+			installer_type = installerTypeFor(setup)
+		}
+		if installer_type == "" {
+			return fmt.Errorf("cannot tell the installer type of %s, set it with --type", source)
+		}
+	}
+	m.installerType = strings.ToUpper(installer_type)
+	if !contains(installerTypes, m.installerType) {
+		return fmt.Errorf("unknown installer type %s, expected one of %s", installer_type, strings.Join(installerTypes, ", "))
+	}
+
+	if m.source == "Local File" {
+		if err := validateInput(m.source, m.installerType, m.textInput); err != nil {
+			return err
+		}
+		defer func() { m.cleanupPayload() }()
+
+		info, err := os.Stat(m.textInput)
+		if err != nil {
+			return fmt.Errorf("failed to read source: %v", err)
+		}
+		if info.IsDir() || payload.IsArchive(m.textInput) {
+			if err := m.stagePayload(m.textInput); err != nil {
+				return err
+			}
+			if m.setupFile, err = flagSetupChooser(setup)(m.setupCandidates); err != nil {
+				return err
+			}
+			m.pickingSetup = false
+		}
+		m.readSetupMetadata()
+	}
+
+	if len(attach) > 0 {
+		if m.installerType != "MSI" {
+			return fmt.Errorf("transforms and patches can only be attached to MSI packages")
+		}
+		if m.attachments, err = parseAttachments(strings.Join(attach, ";")); err != nil {
+			return err
+		}
+	}
+
+	m.packageName = strings.TrimSpace(name)
+	if m.packageName == "" {
+		m.packageName = m.suggestedPackageName()
+	}
+	if sanitize_package_name(m.packageName) == "" {
+		return fmt.Errorf("cannot tell the package name of %s, set it with --name", source)
+	}
+
+	m.outputDir = filepath.Join(output_dir, sanitize_package_name(m.packageName))
+	if _, err := os.Stat(m.outputDir); err == nil && !force {
+		return fmt.Errorf("package %s already exists, use --force to replace it", m.outputDir)
+	}
+	m.replacing = force
+
+	if m, err = build_package(m, cfg.Downloads(), flagSetupChooser(setup)); err != nil {
+		return err
+	}
+	print_package_summary(m)
+	return nil
+}
+
+func run_repackage(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	if all == (len(args) > 0) {
+		return fmt.Errorf("name the packages to repackage, or use --all")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %v", err)
+	}
+	packages_dir := cfg.Packages()
+
+	var ids []string
+	for _, name := range args {
+		ids = append(ids, resolve_package_id(packages_dir, name))
+	}
+	if all {
+		packages, err := get_existing_packages(packages_dir)
+		if err != nil {
+			return err
+		}
+		if len(packages) == 0 {
+			return fmt.Errorf("no packages found in %s", packages_dir)
+		}
+		for _, pkg := range packages {
+			ids = append(ids, pkg.ID)
+		}
+	}
+
+	type result struct {
+		m   model
+		err error
+	}
+	var results []result
+	failed := 0
+	for _, id := range ids {
+		m := initial_model(cfg)
+		m.mode = "Repackage Application"
+		m.packages_dir = packages_dir
+		m.outputDir = filepath.Join(packages_dir, id)
+		m.packageName = package_display_name(m.outputDir)
+
+		if info, err := os.Stat(m.outputDir); err != nil || !info.IsDir() {
+			err = fmt.Errorf("package not found in %s", packages_dir)
+			results = append(results, result{m, err})
+			failed++
+			continue
+		}
+
+		m, err := build_package(m, cfg.Downloads(), flagSetupChooser(""))
+		if err != nil {
+			fmt.Printf("    • Error: %v\n", err)
+			failed++
+		}
+		results = append(results, result{m, err})
+		if errors.Is(err, errInterrupted) {
+			break
+		}
+	}
+
+	fmt.Println("\n" + titleStyle.Render("Repackage Summary"))
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tTYPE\tVERSION\tINTUNEWIN\tRESULT")
+	for _, r := range results {
+		status := "ok"
+		intunewin_file := intunewinFileName(r.m.installerFileName())
+		if r.err != nil {
+			status = "failed: " + r.err.Error()
+			intunewin_file = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", filepath.Base(r.m.outputDir), r.m.installerType, r.m.version, intunewin_file, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if last := results[len(results)-1]; errors.Is(last.err, errInterrupted) {
+		return fmt.Errorf("\n%w after %d of %d packages", errInterrupted, len(results)-1, len(ids))
+	}
+	if failed > 0 {
+		return fmt.Errorf("\n%d of %d packages failed to repackage", failed, len(results))
+	}
+	return nil
+}
+
+func run_restore(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		entries, err := trash.List(cfg.Trash())
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("The trash is empty")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ENTRY\tPACKAGE\tNAME\tDELETED")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Name, entry.ID, package_display_name(entry.Path), entry.Deleted.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	}
+
+	entry, err := trash.Find(cfg.Trash(), args[0])
+	if err != nil {
+		entry, err = trash.Find(cfg.Trash(), sanitize_package_name(args[0]))
+	}
+	if err != nil {
+		return err
+	}
+
+	indent := "    "
+	package_dir := filepath.Join(cfg.Packages(), entry.ID)
+	var current trash.Entry
+	if _, err := os.Stat(package_dir); err == nil {
+		current, err = trash.Move(package_dir, cfg.Trash())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("• Moved the current package to the trash\n")
+		fmt.Printf("%s- %s\n", indent, current.Name)
+	}
+
+	if err := trash.Restore(entry, package_dir); err != nil {
+		return err
+	}
+	if current.Path != "" {
+		if err := history.Carry(current.Path, package_dir); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("• Restored %s\n", package_display_name(package_dir))
+	fmt.Printf("%s- From: %s (deleted %s)\n", indent, entry.Name, entry.Deleted.Format("2006-01-02 15:04:05"))
+	fmt.Printf("%s- To: %s\n", indent, package_dir)
+	return nil
+}
+
+// find_package_dir returns the directory of the named package, which must
+// exist.
+func find_package_dir(packages_dir, name string) (string, error) {
+	package_dir := filepath.Join(packages_dir, resolve_package_id(packages_dir, name))
+	if info, err := os.Stat(package_dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("package %s not found in %s", name, packages_dir)
+	}
+	return package_dir, nil
+}
+
+func run_history(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	package_dir, err := find_package_dir(cfg.Packages(), args[0])
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := history.List(package_dir)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		fmt.Printf("%s has no build snapshots yet; they are saved on every build\n", package_display_name(package_dir))
+		return nil
+	}
+
+	current := 0
+	if pm, err := manifest.Read(package_dir); err == nil {
+		current = pm.Build
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tBUILD\tBUILT\tTYPE\tINTUNEWIN\tCURRENT")
+	for _, s := range snapshots {
+		build, built, installer_type, intunewin_file, marker := "-", "-", "-", "-", ""
+		if pm := s.Manifest; pm != nil {
+			build = fmt.Sprint(pm.Build)
+			built = pm.Built.Format("2006-01-02 15:04")
+			installer_type = pm.InstallerType
+			name := intunewinFileName(filepath.FromSlash(pm.InstallerFile))
+			if _, err := os.Stat(filepath.Join(s.Path, name)); err == nil {
+				intunewin_file = name
+			}
+			if pm.Build == current {
+				marker = "*"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Key, build, built, installer_type, intunewin_file, marker)
+	}
+	return w.Flush()
+}
+
+func run_rollback(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	package_dir, err := find_package_dir(cfg.Packages(), args[0])
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := history.Find(package_dir, args[1])
+	if err != nil {
+		return err
+	}
+
+	// The current build is normally in the history already, but it is
+	// saved again so hand edits since the build are not lost.
+	indent := "    "
+	if pm, err := manifest.Read(package_dir); err == nil && history.Key(pm) != snapshot.Key {
+		saved, err := history.Save(package_dir, history.Key(pm))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("• Saved the current build as %s\n", saved.Key)
+	}
+
+	if err := history.Restore(package_dir, snapshot); err != nil {
+		return err
 	}
-	defer out.Close()
+	fmt.Printf("• Rolled %s back to %s\n", package_display_name(package_dir), snapshot.Key)
+	if pm := snapshot.Manifest; pm != nil {
+		fmt.Printf("%s- Build %d, built %s\n", indent, pm.Build, pm.Built.Format("2006-01-02 15:04:05"))
+		fmt.Printf("%s- IntuneWin file: %s\n", indent, intunewinFileName(filepath.FromSlash(pm.InstallerFile)))
+	}
+	fmt.Printf("%s- Package directory: %s\n", indent, package_dir)
+	return nil
+}
+
+func run_list(cmd *cobra.Command, args []string) error {
+	as_json, _ := cmd.Flags().GetBool("json")
 
-	resp, err := http.Get(url)
+	cfg, err := config.Load()
 	if err != nil {
-		return fmt.Errorf("failed to download file: %v", err)
+		return err
+	}
+	packages, err := list_packages(cfg.Packages())
+	if err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	if as_json {
+		return print_json(packages)
+	}
+	if len(packages) == 0 {
+		fmt.Printf("No packages in %s\n", cfg.Packages())
+		return nil
 	}
 
-	size := resp.ContentLength
-	fmt.Printf("%s- Downloading %s (%d bytes)...\n", indent, path.Base(filepath), size)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tNAME\tTYPE\tVERSION\tPRODUCT CODE\tMODIFIED\tINTUNEWIN")
+	for _, pkg := range packages {
+		intunewin := "no"
+		if pkg.IntuneWin != "" {
+			intunewin = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", pkg.ID, pkg.Name, pkg.InstallerType, pkg.Version,
+			pkg.ProductCode, pkg.Modified.Format("2006-01-02 15:04"), intunewin)
+	}
+	return w.Flush()
+}
 
-	_, err = io.Copy(out, resp.Body)
+func run_cache_list(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	c := cache.Open(cfg.Downloads())
+	entries, err := c.Entries()
 	if err != nil {
-		return fmt.Errorf("failed to save downloaded file: %v", err)
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("No cached downloads in %s\n", c.Dir())
+		return nil
 	}
 
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tSIZE\tFETCHED\tLAST USED\tSHA256")
+	for _, e := range entries {
+		total += e.Size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.URL, formatBytes(e.Size), e.Fetched.Local().Format("2006-01-02 15:04"),
+			e.Used.Local().Format("2006-01-02 15:04"), e.SHA256[:12])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nTotal: %s in %s\n", formatBytes(total), c.Dir())
 	return nil
 }
 
-func ensureIntuneUtil() error {
-	if _, err := os.Stat(intuneUtilPath); err == nil {
+func run_cache_prune(cmd *cobra.Command, args []string) error {
+	max_size_flag, _ := cmd.Flags().GetString("max-size")
+	max_age_flag, _ := cmd.Flags().GetString("max-age")
+	if max_size_flag == "" && max_age_flag == "" {
+		return fmt.Errorf("set --max-size, --max-age or both")
+	}
+
+	var max_size int64 = -1
+	var max_age time.Duration = -1
+	var err error
+	if max_size_flag != "" {
+		if max_size, err = cache.ParseSize(max_size_flag); err != nil {
+			return err
+		}
+	}
+	if max_age_flag != "" {
+		if max_age, err = cache.ParseAge(max_age_flag); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	pruned, err := cache.Open(cfg.Downloads()).Prune(max_size, max_age)
+	if err != nil {
+		return fmt.Errorf("failed to prune download cache: %v", err)
+	}
+	if pruned.Entries == 0 && pruned.Files == 0 {
+		fmt.Println("Nothing to prune")
 		return nil
 	}
+	fmt.Printf("Removed %d cached downloads and %d files, freeing %s\n", pruned.Entries, pruned.Files, formatBytes(pruned.Bytes))
+	return nil
+}
+
+func run_info(cmd *cobra.Command, args []string) error {
+	as_json, _ := cmd.Flags().GetBool("json")
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	package_dir, err := find_package_dir(cfg.Packages(), args[0])
+	if err != nil {
+		return err
+	}
+
+	pkg, err := read_package_info(package_dir)
+	if err != nil {
+		return err
+	}
+	if as_json {
+		return print_json(pkg)
+	}
+
+	indent := "    "
+	sectionStyle := lipgloss.NewStyle().Bold(true)
+	fmt.Println(titleStyle.Render(pkg.Name))
+
+	fmt.Println("\n" + sectionStyle.Render("Package:"))
+	fmt.Printf("%s• ID: %s\n", indent, pkg.ID)
+	fmt.Printf("%s• Directory: %s\n", indent, pkg.Directory)
+	if !pkg.Created.IsZero() {
+		fmt.Printf("%s• Created: %s\n", indent, pkg.Created.Format("2006-01-02 15:04:05"))
+	}
+	if !pkg.Built.IsZero() {
+		fmt.Printf("%s• Last Built: %s (build %d)\n", indent, pkg.Built.Format("2006-01-02 15:04:05"), pkg.Build)
+	}
+	if len(pkg.History) > 0 {
+		fmt.Printf("%s• History: %s\n", indent, strings.Join(pkg.History, ", "))
+	}
+	fmt.Printf("%s• Modified: %s\n", indent, pkg.Modified.Format("2006-01-02 15:04:05"))
+	if pkg.IntuneWin != "" {
+		fmt.Printf("%s• IntuneWin File: %s (%s)\n", indent, pkg.IntuneWin, formatBytes(pkg.IntuneWinSize))
+	} else {
+		fmt.Printf("%s• IntuneWin File: not built\n", indent)
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Installer:"))
+	if pkg.InstallerFile == "" {
+		fmt.Printf("%s• No installer found\n", indent)
+	} else {
+		fmt.Printf("%s• File: %s\n", indent, pkg.InstallerFile)
+		fmt.Printf("%s• Type: %s\n", indent, pkg.InstallerType)
+	}
+	if pkg.Version != "" {
+		fmt.Printf("%s• Version: %s\n", indent, pkg.Version)
+	}
+	if pkg.Publisher != "" {
+		fmt.Printf("%s• Publisher: %s\n", indent, pkg.Publisher)
+	}
+	if pkg.ProductCode != "" {
+		fmt.Printf("%s• Product Code: %s\n", indent, pkg.ProductCode)
+	}
+	if pkg.UpgradeCode != "" {
+		fmt.Printf("%s• Upgrade Code: %s\n", indent, pkg.UpgradeCode)
+	}
+	if pkg.InstallArgs != "" {
+		fmt.Printf("%s• Install Arguments: %s\n", indent, pkg.InstallArgs)
+	}
+	if pkg.UninstallArgs != "" {
+		fmt.Printf("%s• Uninstall Arguments: %s\n", indent, pkg.UninstallArgs)
+	}
+	for _, attachment := range pkg.Attachments {
+		fmt.Printf("%s• Attached: %s\n", indent, attachment)
+	}
+	if pkg.Source != "" {
+		fmt.Printf("%s• Source: %s\n", indent, pkg.Source)
+	}
+	if pkg.SHA256 != "" {
+		fmt.Printf("%s• SHA-256: %s\n", indent, pkg.SHA256)
+	}
+	if pkg.SHA512 != "" {
+		fmt.Printf("%s• SHA-512: %s\n", indent, pkg.SHA512)
+	}
+	if pkg.Checksum != "" {
+		fmt.Printf("%s• Pinned Checksum: %s\n", indent, pkg.Checksum)
+	}
+	if sig := pkg.Signature; sig != nil {
+		fmt.Printf("%s• Signature: %s\n", indent, describeSignature(sig.Status, sig.Problem))
+		if sig.Signer != "" {
+			fmt.Printf("%s  - Signer: %s\n", indent, sig.Signer)
+			fmt.Printf("%s  - Issuer: %s\n", indent, sig.Issuer)
+		}
+		if !sig.Timestamp.IsZero() {
+			fmt.Printf("%s  - Timestamp: %s\n", indent, sig.Timestamp.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	fmt.Println("\n" + sectionStyle.Render("Files:"))
+	for _, file := range pkg.Files {
+		fmt.Printf("%s• %s\n", indent, file)
+	}
+	return nil
+}
+
+func print_json(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func run_config_list(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Configuration file: %s\n\n", config.Path())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tDESCRIPTION")
+	for _, key := range config.Keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", key.Name, key.Value(cfg), key.Source(cfg), key.Description)
+	}
+	return w.Flush()
+}
+
+func run_config_get(cmd *cobra.Command, args []string) error {
+	key, err := config.LookupKey(args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key.Value(cfg))
+	return nil
+}
+
+func run_config_set(cmd *cobra.Command, args []string) error {
+	key, err := config.LookupKey(args[0])
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err := key.Set(cfg, args[1]); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %v", err)
+	}
+
+	if key.Stored(cfg) == "" {
+		fmt.Printf("%s reset to the default: %s\n", key.Name, key.Value(cfg))
+	} else {
+		fmt.Printf("%s set to %s\n", key.Name, key.Value(cfg))
+	}
+	if source := key.Source(cfg); source != "config.json" && source != "default" {
+		fmt.Printf("Note: %s is set and takes precedence\n", source)
+	}
+	return nil
+}
+
+func run_inspect(cmd *cobra.Command, args []string) error {
+	extract_dir, _ := cmd.Flags().GetString("extract")
+
+	pkg, err := intunewin.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer pkg.Close()
+
+	indent := "    "
+	sectionStyle := lipgloss.NewStyle().Bold(true)
+	info := pkg.Info
+
+	fmt.Println(titleStyle.Render(filepath.Base(args[0])))
+
+	fmt.Println("\n" + sectionStyle.Render("Package:"))
+	fmt.Printf("%s• Name: %s\n", indent, info.Name)
+	fmt.Printf("%s• Setup File: %s\n", indent, info.SetupFile)
+	fmt.Printf("%s• Unencrypted Size: %s\n", indent, formatBytes(info.UnencryptedContentSize))
+	fmt.Printf("%s• Encrypted Size: %s\n", indent, formatBytes(pkg.EncryptedSize()))
+	fmt.Printf("%s• Tool Version: %s\n", indent, info.ToolVersion)
+
+	fmt.Println("\n" + sectionStyle.Render("Encryption:"))
+	fmt.Printf("%s• Profile: %s\n", indent, info.EncryptionInfo.ProfileIdentifier)
+	fmt.Printf("%s• Digest Algorithm: %s\n", indent, info.EncryptionInfo.FileDigestAlgorithm)
+	fmt.Printf("%s• File Digest: %s\n", indent, info.EncryptionInfo.FileDigest)
+
+	if msi_info := info.MsiInfo; msi_info != nil {
+		fmt.Println("\n" + sectionStyle.Render("MSI Info:"))
+		fmt.Printf("%s• Product Code: %s\n", indent, msi_info.MsiProductCode)
+		fmt.Printf("%s• Product Version: %s\n", indent, msi_info.MsiProductVersion)
+		if msi_info.MsiUpgradeCode != "" {
+			fmt.Printf("%s• Upgrade Code: %s\n", indent, msi_info.MsiUpgradeCode)
+		}
+		if msi_info.MsiPackageCode != "" {
+			fmt.Printf("%s• Package Code: %s\n", indent, msi_info.MsiPackageCode)
+		}
+		if msi_info.MsiPublisher != "" {
+			fmt.Printf("%s• Publisher: %s\n", indent, msi_info.MsiPublisher)
+		}
+		fmt.Printf("%s• Execution Context: %s\n", indent, msi_info.MsiExecutionContext)
+		fmt.Printf("%s• Requires Reboot: %t\n", indent, msi_info.MsiRequiresReboot)
+	}
+
+	if extract_dir != "" {
+		fmt.Println("\n" + sectionStyle.Render("Extraction:"))
+		fmt.Printf("%s• Decrypting payload...\n", indent)
+		files, err := pkg.Extract(extract_dir)
+		if err != nil {
+			return fmt.Errorf("failed to extract package: %v", err)
+		}
+		fmt.Printf("%s  - HMAC and file digest verified\n", indent)
+		fmt.Printf("%s• Extracted %d files to %s\n", indent, len(files), extract_dir)
+		for _, file := range files {
+			fmt.Printf("%s  - %s\n", indent, file)
+		}
+	}
+
+	fmt.Println()
+	return nil
+}
+
+// run_msi prints the Property table of an MSI, or the result of a query
+// when one is given.
+func run_msi(cmd *cobra.Command, args []string) error {
+	db, err := msi.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open MSI database: %v", err)
+	}
+	defer db.Close()
+
+	query := "SELECT `Property`, `Value` FROM `Property` ORDER BY `Property`"
+	if len(args) == 2 {
+		query = args[1]
+	}
+
+	table, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var header []string
+	for _, column := range table.Columns {
+		header = append(header, column.Name)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range table.Rows {
+		var fields []string
+		for _, value := range row {
+			if value == nil {
+				value = ""
+			}
+			fields = append(fields, fmt.Sprint(value))
+		}
+		fmt.Fprintln(w, strings.Join(fields, "\t"))
+	}
+	return w.Flush()
+}
 
-	fmt.Println("Downloading IntuneWinAppUtil.exe...")
-	if err := downloadFile(intuneUtilUrl, intuneUtilPath); err != nil {
-		return fmt.Errorf("failed to download IntuneWinAppUtil: %v", err)
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
 	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
 
+func ensureNexusDirs(cfg *config.Config) error {
+	for _, dir := range cfg.Dirs() {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", dir, err)
+		}
+	}
 	return nil
 }
 
+// downloadFile downloads url to filepath through the configured proxy,
+// resuming and retrying as the download settings allow. In a terminal the
+// transfer is shown with a progress bar and ctrl+c cancels it. cached, when
+// set, is the copy already in the cache; the request is then conditional
+// and the server may answer that it has not changed.
+func downloadFile(ctx context.Context, cfg *config.Config, url, filepath string, cached *cache.Entry) (download.Result, error) {
+	indent := "      "
+
+	fmt.Printf("%s- Downloading to: %s%s\n", indent, filepath, download.PartialSuffix)
+	fmt.Printf("%s- Retries: %d, connect timeout: %s, read timeout: %s\n", indent, cfg.RetryLimit(), cfg.DialTimeout(), cfg.StallTimeout())
+
+	opts := download.Options{
+		Client:       cfg.HTTPClient(),
+		Retries:      cfg.RetryLimit(),
+		StallTimeout: cfg.StallTimeout(),
+		Logf: func(format string, args ...any) {
+			fmt.Printf(indent+"- "+format+"\n", args...)
+		},
+	}
+	if cached != nil {
+		opts.ETag = cached.ETag
+		opts.LastModified = cached.LastModified
+	}
+	if !term.IsTerminal(os.Stdout.Fd()) {
+		return download.File(ctx, url, filepath, opts)
+	}
+	return downloadWithProgress(ctx, url, filepath, opts, indent)
+}
+
+// buildIntuneWin packs the package directory into a .intunewin file next
+// to the installer, embedding the MSI metadata when we have it.
+func buildIntuneWin(m model, setupPath string) error {
+	opts := intunewin.Options{
+		SourceDir: m.outputDir,
+		SetupFile: setupPath,
+		OutputDir: m.outputDir,
+		Exclude:   []string{history.DirName},
+	}
+
+	if m.installerType == "MSI" && m.msiInfo != nil {
+		opts.Name = m.msiInfo.ProductName
+		opts.MsiInfo = &intunewin.MsiInfo{
+			MsiProductCode:      m.msiInfo.ProductCode,
+			MsiProductVersion:   m.msiInfo.ProductVersion,
+			MsiPackageCode:      m.msiInfo.PackageCode,
+			MsiUpgradeCode:      m.msiInfo.UpgradeCode,
+			MsiPublisher:        m.msiInfo.Manufacturer,
+			MsiExecutionContext: "System",
+			MsiIsMachineInstall: true,
+		}
+	}
+
+	_, err := intunewin.Build(opts)
+	return err
+}
+
 func sanitizePackageName(name string) string {
 	name = strings.ToLower(name)
 	name = strings.ReplaceAll(name, " ", "-")
@@ -1336,148 +3850,259 @@ func sanitizePackageName(name string) string {
 	return strings.Trim(name, "-")
 }
 
-func get_existing_packages(packages_dir string) ([]string, error) {
+// packageRef names a package. ID is the slug its directory is named after
+// and Name the display name it was created with.
+type packageRef struct {
+	ID       string
+	Name     string
+	modified time.Time
+}
+
+func get_existing_packages(packages_dir string) ([]packageRef, error) {
 	if err := os.MkdirAll(packages_dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create packages directory: %v", err)
 	}
+	return scan_packages(packages_dir)
+}
 
+// scan_packages lists the packages in packages_dir, most recently modified
+// first.
+func scan_packages(packages_dir string) ([]packageRef, error) {
 	entries, err := os.ReadDir(packages_dir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read packages directory: %v", err)
 	}
 
-	type pkg_info struct {
-		name string
-		time time.Time
-	}
-
-	var packages []pkg_info
-	caser := cases.Title(language.English)
-
+	var packages []packageRef
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && !stage.IsStaging(entry.Name()) {
 			info, err := entry.Info()
 			if err != nil {
 				continue
 			}
 
-			name := entry.Name()
-			name = strings.ReplaceAll(name, "-", " ")
-			name = caser.String(name)
-
-			packages = append(packages, pkg_info{
-				name: name,
-				time: info.ModTime(),
+			packages = append(packages, packageRef{
+				ID:       entry.Name(),
+				Name:     package_display_name(filepath.Join(packages_dir, entry.Name())),
+				modified: info.ModTime(),
 			})
 		}
 	}
 
 	sort.Slice(packages, func(i, j int) bool {
-		return packages[i].time.After(packages[j].time)
+		return packages[i].modified.After(packages[j].modified)
 	})
 
-	var result []string
-	for _, pkg := range packages {
-		result = append(result, pkg.name)
+	return packages, nil
+}
+
+// package_display_name returns the name a package was created with: the
+// one in its nexus.json, or the $app_title of its Install.ps1 for packages
+// that predate the manifest, or else its ID.
+func package_display_name(package_dir string) string {
+	if pm, err := manifest.Read(package_dir); err == nil && pm.DisplayName != "" {
+		return pm.DisplayName
 	}
+	if title := script_variable(package_dir, "app_title"); title != "" {
+		return title
+	}
+	return filepath.Base(package_dir)
+}
 
-	return result, nil
+// resolve_package_id finds the package a name given on the command line
+// refers to: an ID as it is, or a display name by its slug.
+func resolve_package_id(packages_dir, name string) string {
+	if info, err := os.Stat(filepath.Join(packages_dir, name)); err == nil && info.IsDir() {
+		return name
+	}
+	return sanitize_package_name(name)
 }
 
 func sanitize_package_name(name string) string {
 	return sanitizePackageName(name)
 }
 
-func load_config() (string, error) {
-	config_path := filepath.Join(nexusDir, "config.json")
-	if _, err := os.Stat(config_path); os.IsNotExist(err) {
-		return packagesDir, nil
-	}
-
-	data, err := os.ReadFile(config_path)
+// save_config stores the packages directory in config.json, keeping the
+// other settings. An empty path goes back to the default.
+func save_config(packages_dir string) error {
+	cfg, err := config.Load()
 	if err != nil {
-		return packagesDir, err
-	}
-
-	var config struct {
-		PackagesDir string `json:"packages_dir"`
-	}
-
-	if err := json.Unmarshal(data, &config); err != nil {
-		return packagesDir, err
-	}
-
-	if config.PackagesDir == "" {
-		return packagesDir, nil
+		return err
 	}
-
-	return config.PackagesDir, nil
+	cfg.PackagesDir = packages_dir
+	return cfg.Save()
 }
 
-func save_config(packages_dir string) error {
-	config_path := filepath.Join(nexusDir, "config.json")
-
-	config := struct {
-		PackagesDir string `json:"packages_dir"`
-	}{
-		PackagesDir: packages_dir,
+func get_recent_packages(packages_dir string, count int) ([]packageRef, error) {
+	if _, err := os.Stat(packages_dir); os.IsNotExist(err) {
+		return nil, nil
 	}
 
-	data, err := json.Marshal(config)
+	packages, err := scan_packages(packages_dir)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(packages) > count {
+		packages = packages[:count]
 	}
 
-	return os.WriteFile(config_path, data, 0644)
+	return packages, nil
 }
 
-func get_recent_packages(packages_dir string, count int) ([]string, error) {
-	if _, err := os.Stat(packages_dir); os.IsNotExist(err) {
-		return nil, nil
-	}
+// packageInfo is what nexus list and nexus info report about a package.
+type packageInfo struct {
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	Directory     string              `json:"directory"`
+	InstallerType string              `json:"installer_type,omitempty"`
+	InstallerFile string              `json:"installer_file,omitempty"`
+	Version       string              `json:"version,omitempty"`
+	Publisher     string              `json:"publisher,omitempty"`
+	ProductCode   string              `json:"product_code,omitempty"`
+	UpgradeCode   string              `json:"upgrade_code,omitempty"`
+	InstallArgs   string              `json:"install_args,omitempty"`
+	UninstallArgs string              `json:"uninstall_args,omitempty"`
+	Source        string              `json:"source,omitempty"`
+	SHA256        string              `json:"sha256,omitempty"`
+	SHA512        string              `json:"sha512,omitempty"`
+	Checksum      string              `json:"checksum,omitempty"`
+	Attachments   []string            `json:"attachments,omitempty"`
+	Signature     *manifest.Signature `json:"signature,omitempty"`
+	Build         int                 `json:"build,omitempty"`
+	Created       time.Time           `json:"created,omitzero"`
+	Built         time.Time           `json:"built,omitzero"`
+	Modified      time.Time           `json:"modified"`
+	IntuneWin     string              `json:"intunewin,omitempty"`
+	IntuneWinSize int64               `json:"intunewin_size,omitempty"`
+	Files         []string            `json:"files,omitempty"`
+	History       []string            `json:"history,omitempty"`
+}
 
+// list_packages reads every package in the packages directory, most
+// recently modified first.
+func list_packages(packages_dir string) ([]packageInfo, error) {
 	entries, err := os.ReadDir(packages_dir)
+	if os.IsNotExist(err) {
+		return []packageInfo{}, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read packages directory: %v", err)
 	}
 
-	type pkg_info struct {
-		name string
-		time time.Time
+	packages := []packageInfo{}
+	for _, entry := range entries {
+		if !entry.IsDir() || stage.IsStaging(entry.Name()) {
+			continue
+		}
+		pkg, err := read_package_info(filepath.Join(packages_dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		pkg.Files = nil
+		packages = append(packages, pkg)
 	}
 
-	var packages []pkg_info
-	caser := cases.Title(language.English)
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Modified.After(packages[j].Modified)
+	})
+	return packages, nil
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
+// read_package_info describes the package in package_dir from its
+// nexus.json, or from the installer and scripts it holds when it has none.
+// A package without a recognisable installer is still described, just with
+// less detail.
+func read_package_info(package_dir string) (packageInfo, error) {
+	stat, err := os.Stat(package_dir)
+	if err != nil {
+		return packageInfo{}, err
+	}
 
-			name := entry.Name()
-			name = strings.ReplaceAll(name, "-", " ")
-			name = caser.String(name)
+	id := filepath.Base(package_dir)
+	pkg := packageInfo{
+		ID:        id,
+		Name:      package_display_name(package_dir),
+		Directory: package_dir,
+		Modified:  stat.ModTime(),
+	}
 
-			packages = append(packages, pkg_info{
-				name: name,
-				time: info.ModTime(),
-			})
+	if pkg.Files, err = payload.Files(package_dir); err != nil {
+		return pkg, fmt.Errorf("failed to read package directory: %v", err)
+	}
+	files := pkg.Files[:0]
+	for _, file := range pkg.Files {
+		if !strings.HasPrefix(file, history.DirName+"/") {
+			files = append(files, file)
+		}
+	}
+	pkg.Files = files
+	for _, file := range pkg.Files {
+		if strings.Contains(file, "/") || !strings.EqualFold(path.Ext(file), ".intunewin") {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(package_dir, file)); err == nil {
+			pkg.IntuneWin = file
+			pkg.IntuneWinSize = info.Size()
 		}
 	}
 
-	sort.Slice(packages, func(i, j int) bool {
-		return packages[i].time.After(packages[j].time)
-	})
+	if snapshots, err := history.List(package_dir); err == nil {
+		for _, s := range snapshots {
+			pkg.History = append(pkg.History, s.Key)
+		}
+	}
 
-	var recent []string
-	for i, pkg := range packages {
-		if i >= count {
-			break
+	if pm, err := manifest.Read(package_dir); err == nil {
+		if pm.DisplayName != "" {
+			pkg.Name = pm.DisplayName
 		}
-		recent = append(recent, pkg.name)
+		pkg.Build = pm.Build
+		pkg.InstallerType = pm.InstallerType
+		pkg.InstallerFile = pm.InstallerFile
+		pkg.Version = pm.Version
+		pkg.Publisher = pm.Publisher
+		pkg.ProductCode = pm.ProductCode
+		pkg.UpgradeCode = pm.UpgradeCode
+		pkg.InstallArgs = pm.InstallArgs
+		pkg.UninstallArgs = pm.UninstallArgs
+		pkg.Source = pm.Source
+		pkg.SHA256 = pm.SHA256
+		pkg.SHA512 = pm.SHA512
+		pkg.Checksum = pm.Checksum
+		pkg.Attachments = pm.Attachments
+		pkg.Signature = pm.Signature
+		pkg.Created = pm.Created
+		pkg.Built = pm.Built
+		return pkg, nil
 	}
 
-	return recent, nil
+	installer_file, err := find_package_installer(package_dir)
+	if err != nil {
+		return pkg, nil
+	}
+	installer_path := filepath.Join(package_dir, installer_file)
+	pkg.InstallerFile = filepath.ToSlash(installer_file)
+	pkg.InstallerType = installerTypeFor(installer_file)
+	pkg.InstallArgs = script_variable(package_dir, "install_args")
+
+	switch pkg.InstallerType {
+	case "MSI":
+		if id, err := getMSIIdentity(installer_path); err == nil {
+			pkg.Version = id.ProductVersion
+			pkg.Publisher = id.Manufacturer
+			pkg.ProductCode = id.ProductCode
+			pkg.UpgradeCode = id.UpgradeCode
+		}
+	case "MSIX":
+		if manifest, err := appx.ReadManifest(installer_path); err == nil {
+			pkg.Version = manifest.Version
+			pkg.Publisher = manifest.PublisherName()
+		}
+	case "EXE":
+		if info, err := pe.ReadVersionInfo(installer_path); err == nil {
+			pkg.Version = info.Version()
+			pkg.Publisher = info.CompanyName
+		}
+	}
+	return pkg, nil
 }
@@ -57,7 +57,9 @@ function install_application {
     [string]$installer_path,
     [string]$app_name,
     [string]$installer_type,
-    [string]$install_args
+    [string]$install_args,
+    [string]$transforms,
+    [string]$patches
   )
 
   write_log "Starting $app_name installation..."
@@ -68,7 +70,20 @@ function install_application {
         $install_args = "/qn /norestart"
       }
 
-      $process = Start-Process "msiexec.exe" -ArgumentList "/i `"$installer_path`" $install_args" -Wait -PassThru
+      # Transforms and patches ship next to the installer; msiexec needs
+      # their full paths
+      $msi_args = "/i `"$installer_path`""
+      if (-not [string]::IsNullOrEmpty($transforms)) {
+        $transform_paths = ($transforms -split ';' | ForEach-Object { Join-Path $PSScriptRoot $_ }) -join ';'
+        $msi_args += " TRANSFORMS=`"$transform_paths`""
+      }
+      if (-not [string]::IsNullOrEmpty($patches)) {
+        $patch_paths = ($patches -split ';' | ForEach-Object { Join-Path $PSScriptRoot $_ }) -join ';'
+        $msi_args += " PATCH=`"$patch_paths`""
+      }
+
+      write_log "msiexec.exe $msi_args $install_args"
+      $process = Start-Process "msiexec.exe" -ArgumentList "$msi_args $install_args" -Wait -PassThru
 
       switch ($process.ExitCode) {
         0 { write_log "Successfully installed $app_name" }
@@ -80,6 +95,12 @@ function install_application {
         }
       }
     }
+    elseif ($installer_type -eq "MSIX") {
+      # Provisioning installs the package for every user, including users
+      # who sign in later
+      Add-AppxProvisionedPackage -Online -PackagePath $installer_path -SkipLicense -ErrorAction Stop | Out-Null
+      write_log "Successfully provisioned $app_name"
+    }
     else {
       if ([string]::IsNullOrEmpty($install_args)) {
         $install_args = "/silent"
@@ -106,16 +127,23 @@ function install_application {
 ##*===============================================
 ##* VARIABLES
 ##*===============================================
-$company = "Nexus"
+$company = "<COMPANY>" # To be replaced during package creation
 $app_title = "<APP_TITLE>" # To be replaced during package creation
 $version = "<VERSION>" # To be replaced during package creation
+$publisher = "<PUBLISHER>" # To be replaced during package creation
 $installer_type = "<INSTALLER_TYPE>" # To be replaced during package creation
+$installer_file = "<INSTALLER_FILE>" # To be replaced during package creation
 $install_args = "<INSTALL_ARGS>" # To be replaced during package creation
+$product_code = "<PRODUCT_CODE>" # MSI only, to be replaced during package creation
+$upgrade_code = "<UPGRADE_CODE>" # MSI only, to be replaced during package creation
+$transforms = "<TRANSFORMS>" # MSI only, ;-separated .mst files in the package
+$patches = "<PATCHES>" # MSI only, ;-separated .msp files in the package
+$platform = "<PLATFORM>" # To be replaced during package creation
 $script_name = (Get-Item $PSCommandPath).Basename
 $script_full_name = (Get-Item $PSCommandPath).Name
 $logging_path = "C:\ProgramData\$company\$app_title"
 $log_file = "$logging_path\$script_name.log"
-$installer_path = "$logging_path\$script_name.$($installer_type.ToLower())"
+$installer_path = "$PSScriptRoot\$installer_file"
 
 ##*===============================================
 ##* MAIN EXECUTION
@@ -135,15 +163,28 @@ write_log "App Name: $app_title"
 write_log "Installer Type: $installer_type"
 write_log "Install Args: $install_args"
 write_log "Installer Version: $version"
+write_log "Publisher: $publisher"
+write_log "Product Code: $product_code"
+write_log "Upgrade Code: $upgrade_code"
+write_log "Platform: $platform"
+write_log "Transforms: $transforms"
+write_log "Patches: $patches"
 write_log "Computer Name: $($computer_name)"
 write_log "Computer Info: $($computer_info | Out-String)"
 write_log "User Info: $($user_info.UserFull) $($user_info.User) $($user_info.SID)"
 write_log "==================== Information Gathering Finished ===================="
 
+# A 64-bit package cannot be installed on a 32-bit system
+if (($platform -eq "x64" -or $platform -eq "arm64") -and -not [Environment]::Is64BitOperatingSystem) {
+  write_log "$app_title requires a 64-bit operating system"
+  write_log "==================== Installation Failed ===================="
+  exit 1
+}
+
 # Perform installation
 write_log "==================== Installation Starting ===================="
 try {
-  install_application -installer_path $installer_path -app_name $app_title -installer_type $installer_type -install_args $install_args
+  install_application -installer_path $installer_path -app_name $app_title -installer_type $installer_type -install_args $install_args -transforms $transforms -patches $patches
   write_log "==================== Installation Completed Successfully ===================="
 }
 catch {